@@ -26,6 +26,7 @@ import (
 "encoding/json"
 "strings"
 "github.com/hyperledger/fabric/core/chaincode/shim"
+"github.com/mukutb/TCM-new/amount"
 )
 
 // ManageAccounts example simple Chaincode implementation
@@ -34,6 +35,9 @@ type ManageAccounts struct {
 
 var AccountIndexStr = "_AccountIndex"				//name for the key/value that will store a list of all known RQv's
 var SecurityIndexStr = "_SecurityIndex"
+var AccountAdminStr = "_AccountAdmin"				//name for the key/value that will store who may publish security ratings
+// Transaction certificate attribute naming the caller
+var CallerAttribute = "enrollmentId"
 
 type Accounts struct{
 	AccountID string `json:"accountId"`
@@ -59,6 +63,9 @@ type Securities struct {
 	EffectivePercentage string `json:"Effective Value"`
 	EffectiveValueChanged string `json:"Effective Value Changed"`
 	Currency            string `json:"Currency"`
+	Issuer              string `json:"Issuer"`
+	MaturityDate        string `json:"Maturity Date"`
+	Rating              string `json:"Rating"`
 }
 // ============================================================================================================================
 // Main - start the chaincode for Account management
@@ -75,8 +82,8 @@ func main() {
 func (t *ManageAccounts) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 	var msg string
 	var err error
-	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting ' ' as an argument\", \"code\" : \"503\"}"
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting the administrator as an argument\", \"code\" : \"503\"}"
 		err = stub.SetEvent("errEvent", []byte(errMsg))
 		if err != nil {
 			return nil, err
@@ -96,6 +103,17 @@ func (t *ManageAccounts) Init(stub shim.ChaincodeStubInterface, function string,
 	if err != nil {
 		return nil, err
 	}
+	// A reset keeps the administrator set at deployment, nobody can take it over by invoking init
+	adminAsBytes, err := stub.GetState(AccountAdminStr)
+	if err != nil {
+		return nil, errors.New("Failed to get account administrator")
+	}
+	if len(adminAsBytes) == 0 {
+		err = stub.PutState(AccountAdminStr, []byte(strings.TrimSpace(args[0])))
+		if err != nil {
+			return nil, err
+		}
+	}
 	tosend := "{ \"message\" : \"ManageAccounts chaincode is deployed successfully.\", \"code\" : \"200\"}"
 	err = stub.SetEvent("evtsender", []byte(tosend))
 	if err != nil {
@@ -103,6 +121,20 @@ func (t *ManageAccounts) Init(stub shim.ChaincodeStubInterface, function string,
 	} 
 	return nil, nil
 }
+// caller_is_admin - whether the transaction certificate of the caller names the account administrator
+func caller_is_admin(stub shim.ChaincodeStubInterface) (bool, error) {
+	adminAsBytes, err := stub.GetState(AccountAdminStr)
+	if err != nil {
+		return false, errors.New("Failed to get account administrator")
+	}
+	callerAsBytes, err := stub.ReadCertAttribute(CallerAttribute)
+	if err != nil {
+		fmt.Println("Failed to read " + CallerAttribute + " of the caller: " + err.Error())
+		return false, nil
+	}
+	_caller := strings.TrimSpace(string(callerAsBytes))
+	return _caller != "" && _caller == string(adminAsBytes), nil
+}
 // ============================================================================================================================
 // Run - Our entry Accountint for Invocations - [LEGACY] obc-peer 4/25/2016
 // ============================================================================================================================
@@ -131,6 +163,12 @@ func (t *ManageAccounts) Invoke(stub shim.ChaincodeStubInterface, function strin
 		return t.update_security(stub, args)
 	}else if function == "delete_security" {									
 		return t.delete_security(stub, args)
+	}else if function == "transfer_securities" {								//move securities between two accounts
+		return t.transfer_securities(stub, args)
+	}else if function == "revalue_securities" {								//store new market values for an account's securities
+		return t.revalue_securities(stub, args)
+	}else if function == "update_rating" {									//store a new credit rating for a security in every account holding it
+		return t.update_rating(stub, args)
 	}
 	fmt.Println("invoke did not find func: " + function)
 	errMsg := "{ \"message\" : \"Received unknown function invocation\", \"code\" : \"503\"}"
@@ -567,8 +605,8 @@ func (t *ManageAccounts) create_Account(stub shim.ChaincodeStubInterface, args [
 // ============================================================================================================================
 func (t *ManageAccounts) add_security(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	var err error
-	if len(args) !=  12{
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 12\", \"code\" : \"503\"}"
+	if len(args) !=  15{
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 15\", \"code\" : \"503\"}"
 		err = stub.SetEvent("errEvent", []byte(errMsg))
 		if err != nil {
 			return nil, err
@@ -589,7 +627,32 @@ func (t *ManageAccounts) add_security(stub shim.ChaincodeStubInterface, args []s
 	_effectivePercentage	:= args[9]
 	_effectiveValueinUSD	:= args[10]
 	_currency			    := args[11]
+	_issuer			        := args[12]
+	_maturityDate			:= args[13]
+	_rating			        := args[14]
 	
+	// Quantity and value have to be readable decimals, they are added to what is already held
+	quantityToAdd, err := amount.ParseQuantity(_securityQuantity)
+	if err == nil && quantityToAdd.Sign() <= 0 {
+		err = errors.New("Quantity " + _securityQuantity + " has to be positive")
+	}
+	if err != nil {
+		errMsg := "{ \"security\" : \""+_accountNumber+"-"+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		} 
+		return nil, nil
+	}
+	valueToAdd, err := amount.ParseAmount(_totalValue, "")
+	if err != nil {
+		errMsg := "{ \"security\" : \""+_accountNumber+"-"+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		} 
+		return nil, nil
+	}
 
 	SecurityAsBytes, err := stub.GetState(_accountNumber+"-"+_securityId)
 		if err != nil {
@@ -599,30 +662,31 @@ func (t *ManageAccounts) add_security(stub shim.ChaincodeStubInterface, args []s
 	json.Unmarshal(SecurityAsBytes, &res)
 	// update already existing securities
 	if res.SecurityId == _securityId{
-		securityQuantity1, errBool := strconv.ParseFloat(res.SecuritiesQuantity, 64)
-		if errBool != nil {
-			fmt.Println(errBool)
+		securityQuantity, err := amount.ParseQuantity(res.SecuritiesQuantity)
+		if err == nil {
+			securityQuantity, err = securityQuantity.Add(quantityToAdd)
 		}
-		securityQuantity2, errBool2 := strconv.ParseFloat(_securityQuantity, 64)
-		if errBool2 != nil {
-			fmt.Println(errBool2)
+		totalValue, err2 := amount.ParseAmount(res.TotalValue, "")
+		if err2 == nil {
+			totalValue, err2 = totalValue.Add(valueToAdd)
 		}
-		securityQuantity1 += securityQuantity2
-		res.SecuritiesQuantity = strconv.FormatFloat(securityQuantity1, 'f', 2, 64)
-		fmt.Println("SecuritiesQuantity: ",res.SecuritiesQuantity)
-		totalValue1, errBool3 := strconv.ParseFloat(res.TotalValue, 64)
-		if errBool3 != nil {
-			fmt.Println(errBool3)
+		if err == nil {
+			err = err2
 		}
-		totalValue2, errBool1 := strconv.ParseFloat(_totalValue, 64)
-		if errBool1 != nil {
-			fmt.Println(errBool1)
+		if err != nil {
+			errMsg := "{ \"security\" : \""+_accountNumber+"-"+_securityId+"\", \"message\" : \"Holding could not be added to: "+err.Error()+"\", \"code\" : \"503\"}"
+			err = stub.SetEvent("errEvent", []byte(errMsg))
+			if err != nil {
+				return nil, err
+			} 
+			return nil, nil
 		}
-		totalValue1 += totalValue2
-		res.TotalValue = strconv.FormatFloat(totalValue1, 'f', 2, 64)
+		res.SecuritiesQuantity = securityQuantity.String()
+		fmt.Println("SecuritiesQuantity: ",res.SecuritiesQuantity)
+		res.TotalValue = totalValue.String()
 		fmt.Println("TotalValue: ",res.TotalValue)
 		var temp[] string
-        temp = append(temp, res.SecurityId,res.AccountNumber,_securityName,res.SecuritiesQuantity,_securityType,_collateralForm,res.TotalValue,_valuePercentage,_mtm,_effectivePercentage,_effectiveValueinUSD,_currency)
+        temp = append(temp, res.SecurityId,res.AccountNumber,_securityName,res.SecuritiesQuantity,_securityType,_collateralForm,res.TotalValue,_valuePercentage,_mtm,_effectivePercentage,_effectiveValueinUSD,_currency,_issuer,_maturityDate,_rating)
         t.update_security(stub, temp)
 		fmt.Println("Existing security updated successfully")
 	}else{
@@ -631,15 +695,18 @@ func (t *ManageAccounts) add_security(stub shim.ChaincodeStubInterface, args []s
 			`"Security ID": "` + _securityId + `" ,`+
 			`"Account Number": "` + _accountNumber + `" ,`+
 			`"Security Name": "` + _securityName + `" ,`+
-			`"Quantity": "` + _securityQuantity + `" ,`+
+			`"Quantity": "` + quantityToAdd.String() + `" ,`+
 			`"Security Type": "` + _securityType + `" ,`+
 			`"Collateral Form": "` + _collateralForm + `" ,`+
-			`"Total Value": "` + _totalValue + `" ,`+
+			`"Total Value": "` + valueToAdd.String() + `" ,`+
 			`"Valuation Percentage": "` + _valuePercentage + `" ,`+
 			`"Market Price": "` + _mtm + `" ,`+
 			`"Effective Value": "` + _effectivePercentage + `" ,`+
 			`"Effective Value Changed": "` + _effectiveValueinUSD + `" ,`+
-			`"Currency": "` + _currency + `"`+
+			`"Currency": "` + _currency + `" ,`+
+			`"Issuer": "` + _issuer + `" ,`+
+			`"Maturity Date": "` + _maturityDate + `" ,`+
+			`"Rating": "` + _rating + `"`+
 			`}`
 		fmt.Println("order: " + order)
 		err = stub.PutState(_accountNumber+"-"+_securityId, []byte(order))									//store Account with AccountId as key
@@ -671,25 +738,28 @@ func (t *ManageAccounts) add_security(stub shim.ChaincodeStubInterface, args []s
 			} 
 			return nil, nil
 		}
-		// Convert account's totalValue(String) to float
-		tempTotalValue1, errBool := strconv.ParseFloat(res2.TotalValue, 32)
-		if errBool != nil {
-			fmt.Println(errBool)
+		// Account total in decimal, a new account starts from nothing
+		accountTotal := amount.Zero("")
+		if strings.TrimSpace(res2.TotalValue) != "" {
+			accountTotal, err = amount.ParseAmount(res2.TotalValue, "")
+		}
+		if err == nil {
+			accountTotal, err = accountTotal.Add(valueToAdd)
 		}
-		// Convert security's totalvalue(String) to float
-		tempTotalvalue2, errBool := strconv.ParseFloat(_totalValue, 32)
-		if errBool != nil {
-			fmt.Println(errBool)
+		if err != nil {
+			errMsg := "{ \"message\" : \"Total value of "+_accountNumber+" could not be updated: "+err.Error()+"\", \"code\" : \"503\"}"
+			err = stub.SetEvent("errEvent", []byte(errMsg))
+			if err != nil {
+				return nil, err
+			} 
+			return nil, nil
 		}
 		if res2.Securities == " " || res2.Securities == "" {
 			res2.Securities = _accountNumber+"-"+_securityId
-			_tempTotal := tempTotalValue1 + tempTotalvalue2
-			res2.TotalValue = strconv.FormatFloat(_tempTotal, 'f', -1, 64)
 		}else {
 			res2.Securities = res2.Securities+ "," + _accountNumber+"-"+_securityId;
-			_tempTotal := tempTotalValue1 + tempTotalvalue2
-			res2.TotalValue = strconv.FormatFloat(_tempTotal, 'f', -1, 64)
 		}
+		res2.TotalValue = accountTotal.String()
 		order2 := 	`{`+
 			`"accountId": "` + res2.AccountID + `" ,`+
 			`"accountName": "` + res2.AccountName + `" ,`+
@@ -739,7 +809,15 @@ func (t *ManageAccounts) remove_securitiesFromAccount(stub shim.ChaincodeStubInt
 	res := Accounts{}
 	res_Security := Securities{}
 	json.Unmarshal(AccountAsBytes, &res)
-	totalValueOfTheDeletedSecurities, _ := strconv.ParseFloat(res.TotalValue,64)
+	totalValueOfTheDeletedSecurities, err := amount.ParseAmount(res.TotalValue, "")
+	if err != nil {
+		errMsg := "{ \"message\" : \"Total value of "+_accountNumber+" unreadable: "+err.Error()+"\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		} 
+		return nil, nil
+	}
 	_SecuritySplit := strings.Split(res.Securities, ",")
 	fmt.Print("_SecuritySplit: " )
 	fmt.Println(_SecuritySplit)
@@ -752,8 +830,14 @@ func (t *ManageAccounts) remove_securitiesFromAccount(stub shim.ChaincodeStubInt
 			return nil, errors.New("Failed to get Security " + _SecuritySplit[i])
 		}
 		json.Unmarshal(SecuritiesAsBytes, &res_Security)
-		valToBeRemoved, _ := strconv.ParseFloat(res_Security.TotalValue, 64)
-		totalValueOfTheDeletedSecurities = totalValueOfTheDeletedSecurities - valToBeRemoved
+		valToBeRemoved, err := amount.ParseAmount(res_Security.TotalValue, "")
+		if err == nil {
+			totalValueOfTheDeletedSecurities, err = totalValueOfTheDeletedSecurities.Sub(valToBeRemoved)
+		}
+		if err != nil {
+			// Fail the invocation, the securities already deleted come back with it
+			return nil, errors.New("Total value of " + _SecuritySplit[i] + " unreadable: " + err.Error())
+		}
 
 		//Got the info. now delete
 		err = stub.DelState(_SecuritySplit[i])													//remove the key from chaincode state
@@ -770,7 +854,7 @@ func (t *ManageAccounts) remove_securitiesFromAccount(stub shim.ChaincodeStubInt
 		//fmt.Println(_SecuritySplit[i+1])
 		fmt.Println(_SecuritySplit)
 		for x:= range _SecuritySplit{											//debug prints...
-			fmt.Println(string(x) + " - " + _SecuritySplit[x])
+			fmt.Println(strconv.Itoa(x) + " - " + _SecuritySplit[x])
 		}
 	}
 
@@ -786,7 +870,7 @@ func (t *ManageAccounts) remove_securitiesFromAccount(stub shim.ChaincodeStubInt
 		`"accountName": "` + res.AccountName + `" ,`+
 		`"accountNumber": "` + res.AccountNumber + `" ,`+
 		`"accountType": "` + res.AccountType + `" ,`+
-		`"totalValue": "` + strconv.FormatFloat(totalValueOfTheDeletedSecurities, 'f', 2, 64) + `" ,`+
+		`"totalValue": "` + totalValueOfTheDeletedSecurities.String() + `" ,`+
 		`"currency": "` + res.Currency + `" ,`+
 		`"pledger": "` + res.Pledger + `" ,`+
 		`"securities": "`+ res.Securities +`" `+
@@ -866,8 +950,8 @@ func (t *ManageAccounts) getSecurities_byAccount(stub shim.ChaincodeStubInterfac
 func (t *ManageAccounts) update_security(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
 	var err error
 	fmt.Println("Updating Security")
-	if len(args) != 12 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 12\", \"code\" : \"503\"}"
+	if len(args) != 15 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 15\", \"code\" : \"503\"}"
 		err = stub.SetEvent("errEvent", []byte(errMsg))
 		if err != nil {
 			return nil, err
@@ -906,7 +990,10 @@ func (t *ManageAccounts) update_security(stub shim.ChaincodeStubInterface, args
 			`"Market Price": "` + args[8]+ `" ,`+
 			`"Effective Value": "` + args[9]+ `" ,`+
 			`"Effective Value Changed": "` + args[10]+ `" ,`+
-			`"Currency": "` + args[11] + `"`+
+			`"Currency": "` + args[11] + `" ,`+
+			`"Issuer": "` + args[12] + `" ,`+
+			`"Maturity Date": "` + args[13] + `" ,`+
+			`"Rating": "` + args[14] + `"`+
 			`}`
 		fmt.Println(order);
 		err = stub.PutState(accountNumber + "-" + securityId, []byte(order))									//store security with id as key
@@ -977,7 +1064,7 @@ func (t *ManageAccounts) delete_security(stub shim.ChaincodeStubInterface, args
 			fmt.Println(_SecuritySplit[:i])
 			fmt.Println(_SecuritySplit)
 			for x:= range _SecuritySplit{											//debug prints...
-				fmt.Println(string(x) + " - " + _SecuritySplit[x])
+				fmt.Println(strconv.Itoa(x) + " - " + _SecuritySplit[x])
 			}
 			break
 		}
@@ -1009,3 +1096,546 @@ func (t *ManageAccounts) delete_security(stub shim.ChaincodeStubInterface, args
 	} 
 	return nil, nil
 }
+// ============================================================================================================================
+// transfer_securities - move quantities of securities from one account to another in a single invocation
+// Arguments : fromAccount, toAccount, followed by securityId, quantity pairs
+// Nothing is written unless every line can be moved, a rejected transfer returns an error so the caller's transaction fails too
+// ============================================================================================================================
+func (t *ManageAccounts) transfer_securities(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) < 4 || len(args)%2 != 0 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting fromAccount, toAccount and securityId, quantity pairs\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start transfer_securities")
+
+	_fromAccount := args[0]
+	_toAccount := args[1]
+	if _fromAccount == _toAccount {
+		return transfer_rejected(stub, "{ \"message\" : \"Cannot transfer securities from " + _fromAccount + " to itself.\", \"code\" : \"503\"}")
+	}
+
+	// Both accounts have to exist
+	fromAsBytes, err := stub.GetState(_fromAccount)
+	if err != nil {
+		return nil, errors.New("Failed to get Account " + _fromAccount)
+	}
+	from := Accounts{}
+	json.Unmarshal(fromAsBytes, &from)
+	if from.AccountNumber != _fromAccount {
+		return transfer_rejected(stub, "{ \"message\" : \""+_fromAccount+" Not Found.\", \"code\" : \"503\"}")
+	}
+	toAsBytes, err := stub.GetState(_toAccount)
+	if err != nil {
+		return nil, errors.New("Failed to get Account " + _toAccount)
+	}
+	to := Accounts{}
+	json.Unmarshal(toAsBytes, &to)
+	if to.AccountNumber != _toAccount {
+		return transfer_rejected(stub, "{ \"message\" : \""+_toAccount+" Not Found.\", \"code\" : \"503\"}")
+	}
+
+	// Quantity to move per security, the same security named twice is moved once with the sum
+	var securityIds []string
+	quantityToMove := make(map[string]amount.Amount)
+	for i := 2; i < len(args); i += 2 {
+		_quantity, err := amount.ParseQuantity(args[i+1])
+		if err != nil || _quantity.Sign() <= 0 {
+			return transfer_rejected(stub, "{ \"security\" : \""+args[i]+"\", \"message\" : \"Invalid quantity "+args[i+1]+" to transfer.\", \"code\" : \"503\"}")
+		}
+		if _, found := quantityToMove[args[i]]; !found {
+			securityIds = append(securityIds, args[i])
+			quantityToMove[args[i]] = amount.Zero("")
+		}
+		quantityToMove[args[i]], err = quantityToMove[args[i]].Add(_quantity)
+		if err != nil {
+			return transfer_rejected(stub, "{ \"security\" : \""+args[i]+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+		}
+	}
+
+	fromTotalValue, err := amount.ParseAmount(from.TotalValue, "")
+	if err != nil {
+		return transfer_rejected(stub, "{ \"message\" : \"Total value of "+_fromAccount+" unreadable: "+err.Error()+"\", \"code\" : \"503\"}")
+	}
+	toTotalValue := amount.Zero("")
+	if strings.TrimSpace(to.TotalValue) != "" {
+		toTotalValue, err = amount.ParseAmount(to.TotalValue, "")
+		if err != nil {
+			return transfer_rejected(stub, "{ \"message\" : \"Total value of "+_toAccount+" unreadable: "+err.Error()+"\", \"code\" : \"503\"}")
+		}
+	}
+	fromSecurities := security_keys(from.Securities)
+	toSecurities := security_keys(to.Securities)
+
+	// Work out both sides of every line before anything is written
+	var fromHoldings, toHoldings []Securities
+	var heldsFrom, heldsTo []amount.Amount
+	valueBefore, err := fromTotalValue.Add(toTotalValue)
+	if err != nil {
+		return transfer_rejected(stub, "{ \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+	}
+	for _, _securityId := range securityIds {
+		fromHoldingAsBytes, err := stub.GetState(_fromAccount + "-" + _securityId)
+		if err != nil {
+			return nil, errors.New("Failed to get Security " + _fromAccount + "-" + _securityId)
+		}
+		fromHolding := Securities{}
+		json.Unmarshal(fromHoldingAsBytes, &fromHolding)
+		if fromHolding.SecurityId != _securityId {
+			return transfer_rejected(stub, "{ \"security\" : \""+_fromAccount+"-"+_securityId+"\", \"message\" : \"Security not held in "+_fromAccount+".\", \"code\" : \"503\"}")
+		}
+		toHoldingAsBytes, err := stub.GetState(_toAccount + "-" + _securityId)
+		if err != nil {
+			return nil, errors.New("Failed to get Security " + _toAccount + "-" + _securityId)
+		}
+		toHolding := Securities{}
+		json.Unmarshal(toHoldingAsBytes, &toHolding)
+
+		heldFrom, err := amount.ParseQuantity(fromHolding.SecuritiesQuantity)
+		if err != nil {
+			return transfer_rejected(stub, "{ \"security\" : \""+_fromAccount+"-"+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+		}
+		valueFrom, err := amount.ParseAmount(fromHolding.TotalValue, "")
+		if err != nil {
+			return transfer_rejected(stub, "{ \"security\" : \""+_fromAccount+"-"+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+		}
+		heldTo := amount.Zero("")
+		valueTo := amount.Zero("")
+		if toHolding.SecurityId == _securityId {
+			heldTo, err = amount.ParseQuantity(toHolding.SecuritiesQuantity)
+			if err == nil {
+				valueTo, err = amount.ParseAmount(toHolding.TotalValue, "")
+			}
+			if err != nil {
+				return transfer_rejected(stub, "{ \"security\" : \""+_toAccount+"-"+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+			}
+		}
+
+		newQuantityFrom, err := heldFrom.Sub(quantityToMove[_securityId])
+		if err == nil && newQuantityFrom.Sign() < 0 {
+			return transfer_rejected(stub, "{ \"security\" : \""+_fromAccount+"-"+_securityId+"\", \"message\" : \"Transfer of "+quantityToMove[_securityId].String()+" would take the holding of "+fromHolding.SecuritiesQuantity+" negative.\", \"code\" : \"503\"}")
+		}
+		newQuantityTo, newValueTo, valueLeft := amount.Amount{}, amount.Amount{}, amount.Amount{}
+		if err == nil {
+			newQuantityTo, err = heldTo.Add(quantityToMove[_securityId])
+		}
+
+		// Value moves in proportion to the quantity, rounded once, the last of a holding takes its whole value
+		valueMoved := valueFrom
+		if err == nil && newQuantityFrom.Sign() > 0 {
+			valueMoved, err = valueFrom.Mul(quantityToMove[_securityId], valueFrom.Scale+amount.QuantityScale, amount.DefaultRounding)
+			if err == nil {
+				valueMoved, err = valueMoved.Div(heldFrom, valueFrom.Scale, amount.DefaultRounding)
+			}
+		}
+		if err == nil {
+			valueLeft, err = valueFrom.Sub(valueMoved)
+		}
+		if err == nil {
+			newValueTo, err = valueTo.Add(valueMoved)
+		}
+		if err == nil {
+			fromTotalValue, err = fromTotalValue.Sub(valueMoved)
+		}
+		if err == nil {
+			toTotalValue, err = toTotalValue.Add(valueMoved)
+		}
+		if err != nil {
+			return transfer_rejected(stub, "{ \"security\" : \""+_securityId+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+		}
+		fmt.Println(_securityId + " moving " + quantityToMove[_securityId].String() + " worth " + valueMoved.String())
+
+		if toHolding.SecurityId != _securityId {
+			// New line in the receiving account, described like the one it comes from
+			toHolding = fromHolding
+			toHolding.AccountNumber = _toAccount
+			toSecurities = append(toSecurities, _toAccount+"-"+_securityId)
+		}
+		toHolding.SecuritiesQuantity = newQuantityTo.String()
+		toHolding.TotalValue = newValueTo.String()
+		toHoldings = append(toHoldings, toHolding)
+		heldsTo = append(heldsTo, heldTo)
+
+		fromHolding.SecuritiesQuantity = newQuantityFrom.String()
+		fromHolding.TotalValue = valueLeft.String()
+		fromHoldings = append(fromHoldings, fromHolding)
+		heldsFrom = append(heldsFrom, heldFrom)
+		if newQuantityFrom.Sign() == 0 {
+			// Nothing left of it, drop it from the account
+			for i := range fromSecurities {
+				if fromSecurities[i] == _fromAccount+"-"+_securityId {
+					fromSecurities = append(fromSecurities[:i], fromSecurities[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+
+	// What is about to be written has to leave the one side and reach the other in exactly the quantities requested, and the two
+	// accounts together keep the value they had
+	err = transfer_conserved(args[2:], securityIds, heldsFrom, fromHoldings, heldsTo, toHoldings, valueBefore, fromTotalValue, toTotalValue)
+	if err != nil {
+		return transfer_rejected(stub, "{ \"fromAccount\" : \""+_fromAccount+"\", \"toAccount\" : \""+_toAccount+"\", \"message\" : \""+err.Error()+"\", \"code\" : \"503\"}")
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Commit both sides
+	for _, holding := range fromHoldings {
+		if quantity, _ := amount.ParseQuantity(holding.SecuritiesQuantity); quantity.Sign() == 0 {
+			err = stub.DelState(_fromAccount + "-" + holding.SecurityId)
+		} else {
+			err = stub.PutState(_fromAccount+"-"+holding.SecurityId, []byte(security_json(holding)))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, holding := range toHoldings {
+		err = stub.PutState(_toAccount+"-"+holding.SecurityId, []byte(security_json(holding)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	from.Securities = strings.Join(fromSecurities, ",")
+	from.TotalValue = fromTotalValue.String()
+	err = stub.PutState(_fromAccount, []byte(account_json(from)))
+	if err != nil {
+		return nil, err
+	}
+	to.Securities = strings.Join(toSecurities, ",")
+	to.TotalValue = toTotalValue.String()
+	err = stub.PutState(_toAccount, []byte(account_json(to)))
+	if err != nil {
+		return nil, err
+	}
+
+	tosend := "{ \"fromAccount\" : \"" + _fromAccount + "\", \"toAccount\" : \"" + _toAccount + "\", \"securities\" : \"" + strings.Join(securityIds, ",") + "\", \"message\" : \"Securities transferred succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end transfer_securities")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// transfer_conserved - check the holdings a transfer is about to write against the securityId, quantity pairs it was asked for
+// Per security, what leaves the sending holding and what reaches the receiving one both equal the sum requested for it, and the
+// two account totals add up to what they did before
+// ============================================================================================================================
+func transfer_conserved(pairs []string, securityIds []string, heldsFrom []amount.Amount, fromHoldings []Securities, heldsTo []amount.Amount, toHoldings []Securities, valueBefore amount.Amount, fromTotalValue amount.Amount, toTotalValue amount.Amount) error {
+	requested := make(map[string]amount.Amount)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		_quantity, err := amount.ParseQuantity(pairs[i+1])
+		if err != nil {
+			return err
+		}
+		if _, found := requested[pairs[i]]; !found {
+			requested[pairs[i]] = amount.Zero("")
+		}
+		requested[pairs[i]], err = requested[pairs[i]].Add(_quantity)
+		if err != nil {
+			return err
+		}
+	}
+	if len(requested) != len(securityIds) || len(fromHoldings) != len(securityIds) || len(toHoldings) != len(securityIds) {
+		return errors.New("Transfer covers " + strconv.Itoa(len(fromHoldings)) + " of the " + strconv.Itoa(len(requested)) + " securities requested")
+	}
+	for i, _securityId := range securityIds {
+		leftFrom, err := amount.ParseQuantity(fromHoldings[i].SecuritiesQuantity)
+		if err != nil {
+			return err
+		}
+		nowTo, err := amount.ParseQuantity(toHoldings[i].SecuritiesQuantity)
+		if err != nil {
+			return err
+		}
+		movedOut, err := heldsFrom[i].Sub(leftFrom)
+		if err != nil {
+			return err
+		}
+		movedIn, err := nowTo.Sub(heldsTo[i])
+		if err != nil {
+			return err
+		}
+		if movedOut.Cmp(requested[_securityId]) != 0 || movedIn.Cmp(requested[_securityId]) != 0 {
+			return errors.New(_securityId + " transfer not conserved: " + requested[_securityId].String() + " requested, " + movedOut.String() + " sent, " + movedIn.String() + " received")
+		}
+	}
+	valueAfter, err := fromTotalValue.Add(toTotalValue)
+	if err != nil {
+		return err
+	}
+	if valueAfter.Cmp(valueBefore) != 0 {
+		return errors.New("Transfer not conserved: accounts worth " + valueBefore.String() + " before, " + valueAfter.String() + " after")
+	}
+	return nil
+}
+
+// transfer_rejected - raise the errEvent and fail the invocation, so nothing of the transfer is committed
+func transfer_rejected(stub shim.ChaincodeStubInterface, errMsg string) ([]byte, error) {
+	fmt.Println(errMsg)
+	err := stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New(errMsg)
+}
+
+// security_keys - the account's Securities link list without the blank entries left by an empty account
+func security_keys(securities string) []string {
+	var keys []string
+	for _, key := range strings.Split(securities, ",") {
+		if strings.TrimSpace(key) != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+//build the Account json string manually
+func account_json(res Accounts) string {
+	return `{` +
+		`"accountId": "` + res.AccountID + `" ,` +
+		`"accountName": "` + res.AccountName + `" ,` +
+		`"accountNumber": "` + res.AccountNumber + `" ,` +
+		`"accountType": "` + res.AccountType + `" ,` +
+		`"totalValue": "` + res.TotalValue + `" ,` +
+		`"currency": "` + res.Currency + `" ,` +
+		`"pledger": "` + res.Pledger + `" ,` +
+		`"securities": "` + res.Securities + `" ` +
+		`}`
+}
+
+//build the Security json string manually
+func security_json(res Securities) string {
+	return `{` +
+		`"Security ID": "` + res.SecurityId + `" ,` +
+		`"Account Number": "` + res.AccountNumber + `" ,` +
+		`"Security Name": "` + res.SecuritiesName + `" ,` +
+		`"Quantity": "` + res.SecuritiesQuantity + `" ,` +
+		`"Security Type": "` + res.SecurityType + `" ,` +
+		`"Collateral Form": "` + res.CollateralForm + `" ,` +
+		`"Total Value": "` + res.TotalValue + `" ,` +
+		`"Valuation Percentage": "` + res.ValuePercentage + `" ,` +
+		`"Market Price": "` + res.MTM + `" ,` +
+		`"Effective Value": "` + res.EffectivePercentage + `" ,` +
+		`"Effective Value Changed": "` + res.EffectiveValueChanged + `" ,` +
+		`"Currency": "` + res.Currency + `" ,` +
+		`"Issuer": "` + res.Issuer + `" ,` +
+		`"Maturity Date": "` + res.MaturityDate + `" ,` +
+		`"Rating": "` + res.Rating + `"` +
+		`}`
+}
+
+// ============================================================================================================================
+// revalue_securities - store new market prices and values for securities held in an account and recompute its TotalValue
+// Arguments : accountNumber, followed by securityId, market price, valuation percentage, effective value changed, total value quintuples
+// ============================================================================================================================
+func (t *ManageAccounts) revalue_securities(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) < 6 || (len(args)-1)%5 != 0 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting accountNumber and securityId, market price, valuation percentage, effective value, total value quintuples\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start revalue_securities")
+
+	_accountNumber := args[0]
+	accountAsBytes, err := stub.GetState(_accountNumber)
+	if err != nil {
+		return nil, errors.New("Failed to get Account " + _accountNumber)
+	}
+	account := Accounts{}
+	json.Unmarshal(accountAsBytes, &account)
+	if account.AccountNumber != _accountNumber {
+		errMsg := "{ \"message\" : \"" + _accountNumber + " Not Found.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	for i := 1; i < len(args); i += 5 {
+		securityAsBytes, err := stub.GetState(_accountNumber + "-" + args[i])
+		if err != nil {
+			return nil, errors.New("Failed to get Security " + _accountNumber + "-" + args[i])
+		}
+		holding := Securities{}
+		json.Unmarshal(securityAsBytes, &holding)
+		if holding.SecurityId != args[i] {
+			// Moved out since it was priced, nothing to revalue
+			fmt.Println(args[i] + " no longer held in " + _accountNumber)
+			continue
+		}
+		// Figures are stored as decimals, one that does not read fails the whole revaluation
+		_, err = amount.ParseRate(args[i+1])
+		if err == nil {
+			_, err = amount.ParseRate(args[i+2])
+		}
+		if err == nil {
+			_, err = amount.ParseRate(args[i+3])
+		}
+		if err == nil {
+			_, err = amount.ParseAmount(args[i+4], "")
+		}
+		if err != nil {
+			return nil, errors.New("Revaluation of " + _accountNumber + "-" + args[i] + " rejected: " + err.Error())
+		}
+		holding.MTM = args[i+1]
+		holding.ValuePercentage = args[i+2]
+		holding.EffectiveValueChanged = args[i+3]
+		holding.TotalValue = args[i+4]
+		err = stub.PutState(_accountNumber+"-"+holding.SecurityId, []byte(security_json(holding)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Account total from every holding, revalued or not
+	totalValue := amount.Zero("")
+	for _, key := range security_keys(account.Securities) {
+		securityAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return nil, errors.New("Failed to get Security " + key)
+		}
+		holding := Securities{}
+		json.Unmarshal(securityAsBytes, &holding)
+		_value, err := amount.ParseAmount(holding.TotalValue, "")
+		if err == nil {
+			totalValue, err = totalValue.Add(_value)
+		}
+		if err != nil {
+			return nil, errors.New("Total value of " + key + " unreadable: " + err.Error())
+		}
+	}
+	account.TotalValue = totalValue.String()
+	err = stub.PutState(_accountNumber, []byte(account_json(account)))
+	if err != nil {
+		return nil, err
+	}
+
+	tosend := "{ \"accountNumber\" : \"" + _accountNumber + "\", \"totalValue\" : \"" + account.TotalValue + "\", \"message\" : \"Securities revalued succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end revalue_securities")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// update_rating - store a new credit rating for a security in every account holding it
+// Arguments : securityId, rating (one or more agency ratings, comma separated, e.g. "Moody's:A2")
+// Only the entries of the agencies named are replaced, an agency with an empty rating ("Moody's:") is withdrawn
+// Returns the numbers of the accounts holding the security as a json array
+// ============================================================================================================================
+func (t *ManageAccounts) update_rating(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 2 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting securityId and rating\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start update_rating")
+
+	// Ratings are published by the administrator only
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		errMsg := "{ \"message\" : \"Only the account administrator can update ratings\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	_securityId := args[0]
+	_rating := args[1]
+	var AccountIndex, holdingAccounts []string
+	AccountAsBytes, err := stub.GetState(AccountIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get Account index")
+	}
+	json.Unmarshal(AccountAsBytes, &AccountIndex)
+	for _, _accountNumber := range AccountIndex {
+		securityAsBytes, err := stub.GetState(_accountNumber + "-" + _securityId)
+		if err != nil {
+			return nil, errors.New("Failed to get Security " + _accountNumber + "-" + _securityId)
+		}
+		holding := Securities{}
+		json.Unmarshal(securityAsBytes, &holding)
+		if holding.SecurityId != _securityId {
+			continue
+		}
+		holding.Rating = merge_rating(holding.Rating, _rating)
+		err = stub.PutState(_accountNumber+"-"+_securityId, []byte(security_json(holding)))
+		if err != nil {
+			return nil, err
+		}
+		holdingAccounts = append(holdingAccounts, _accountNumber)
+	}
+	if len(holdingAccounts) == 0 {
+		holdingAccounts = []string{}
+	}
+	jsonAsBytes, _ := json.Marshal(holdingAccounts)
+
+	tosend := "{ \"securityId\" : \"" + _securityId + "\", \"rating\" : \"" + _rating + "\", \"accounts\" : " + string(jsonAsBytes) + ", \"message\" : \"Rating updated succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end update_rating")
+	return jsonAsBytes, nil
+}
+
+// ============================================================================================================================
+// merge_rating - agency ratings of Current, e.g. "S&P:AA-,Moody's:A1,Fitch:AA", with those given in Update replacing the
+// entries of the same agency. A rating without an agency replaces the entry without one; an empty rating removes the entry
+// ============================================================================================================================
+func merge_rating(Current string, Update string) string {
+	var agencies []string
+	ratings := make(map[string]string)
+	for _, list := range []string{Current, Update} {
+		for _, entry := range strings.Split(list, ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			agency, rating := "", entry
+			if i := strings.LastIndex(entry, ":"); i >= 0 {
+				agency, rating = strings.TrimSpace(entry[:i]), entry[i+1:]
+			}
+			if _, found := ratings[agency]; !found {
+				agencies = append(agencies, agency)
+			}
+			ratings[agency] = strings.TrimSpace(rating)
+		}
+	}
+	var merged []string
+	for _, agency := range agencies {
+		if ratings[agency] == "" {
+			continue
+		}
+		if agency == "" {
+			merged = append(merged, ratings[agency])
+		} else {
+			merged = append(merged, agency+":"+ratings[agency])
+		}
+	}
+	return strings.Join(merged, ",")
+}
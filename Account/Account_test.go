@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+func TestTransferConserved(t *testing.T) {
+	quantity := func(value string) amount.Amount {
+		q, err := amount.ParseQuantity(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q
+	}
+	value := func(total string) amount.Amount {
+		v, err := amount.ParseAmount(total, "EUR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	holdings := func(quantities ...string) []Securities {
+		var list []Securities
+		for _, q := range quantities {
+			list = append(list, Securities{SecuritiesQuantity: q})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name        string
+		pairs       []string
+		securityIds []string
+		heldsFrom   []string
+		from        []Securities
+		heldsTo     []string
+		to          []Securities
+		before      string
+		fromTotal   string
+		toTotal     string
+		conserved   bool
+	}{
+		{"one security", []string{"X", "3"}, []string{"X"}, []string{"10"}, holdings("7.00"), []string{"0"}, holdings("3.00"), "1000.00", "700.00", "300.00", true},
+		{"fractional quantity", []string{"X", "2.5"}, []string{"X"}, []string{"10"}, holdings("7.50"), []string{"1"}, holdings("3.50"), "1000.00", "750.00", "250.00", true},
+		{"pairs of the same security add up", []string{"X", "1", "X", "2"}, []string{"X"}, []string{"10"}, holdings("7.00"), []string{"0"}, holdings("3.00"), "1000.00", "700.00", "300.00", true},
+		{"two securities", []string{"X", "1", "Y", "4"}, []string{"X", "Y"}, []string{"5", "4"}, holdings("4.00", "0.00"), []string{"0", "2"}, holdings("1.00", "6.00"), "900.00", "400.00", "500.00", true},
+		{"less sent than requested", []string{"X", "3"}, []string{"X"}, []string{"10"}, holdings("8.00"), []string{"0"}, holdings("3.00"), "1000.00", "700.00", "300.00", false},
+		{"less received than sent", []string{"X", "3"}, []string{"X"}, []string{"10"}, holdings("7.00"), []string{"0"}, holdings("2.00"), "1000.00", "700.00", "300.00", false},
+		{"security left out", []string{"X", "1", "Y", "4"}, []string{"X"}, []string{"5"}, holdings("4.00"), []string{"0"}, holdings("1.00"), "900.00", "400.00", "500.00", false},
+		{"account totals changed", []string{"X", "3"}, []string{"X"}, []string{"10"}, holdings("7.00"), []string{"0"}, holdings("3.00"), "1000.00", "700.00", "300.01", false},
+		{"unreadable quantity", []string{"X", "three"}, []string{"X"}, []string{"10"}, holdings("7.00"), []string{"0"}, holdings("3.00"), "1000.00", "700.00", "300.00", false},
+	}
+	for _, test := range tests {
+		var heldsFrom, heldsTo []amount.Amount
+		for _, held := range test.heldsFrom {
+			heldsFrom = append(heldsFrom, quantity(held))
+		}
+		for _, held := range test.heldsTo {
+			heldsTo = append(heldsTo, quantity(held))
+		}
+		err := transfer_conserved(test.pairs, test.securityIds, heldsFrom, test.from, heldsTo, test.to, value(test.before), value(test.fromTotal), value(test.toTotal))
+		if (err == nil) != test.conserved {
+			t.Errorf("%s: transfer_conserved = %v, want conserved %v", test.name, err, test.conserved)
+		}
+	}
+}
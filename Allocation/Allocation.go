@@ -1,1452 +1,2284 @@
-/*/*
-Licensed to the Apache Software Foundation (ASF) under one
-or more contributor license agreements.  See the NOTICE file
-distributed with this work for additional information
-regarding copyright ownership.  The ASF licenses this file
-to you under the Apache License, Version 2.0 (the
-"License"); you may not use this file except in compliance
-with the License.  You may obtain a copy of the License at
-
-  http://www.apache.org/licenses/LICENSE-2.0
-
-Unless required by applicable law or agreed to in writing,
-software distributed under the License is distributed on an
-"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
-KIND, either express or implied.  See the License for the
-specific language governing permissions and limitations
-under the License.
-*/
-
-package main
-
-import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"github.com/hyperledger/fabric/core/chaincode/shim"
-	"github.com/hyperledger/fabric/core/util"
-	"math"
-	"net/http"
-	//"net/url"
-	"sort"
-	"strconv"
-)
-
-type ManageAllocations struct {
-}
-
-type Transactions struct {
-	TransactionId          string `json:"transactionId"`
-	TransactionDate        string `json:"transactionDate"`
-	DealID                 string `json:"dealId"`
-	Pledger                string `json:"pledger"`
-	Pledgee                string `json:"pledgee"`
-	RQV                    string `json:"rqv"`
-	Currency               string `json:"currency"`
-	CurrencyConversionRate string `json:"currencyConversionRate"`
-	MarginCAllDate         string `json:"marginCAllDate"`
-	AllocationStatus       string `json:"allocationStatus"`
-	TransactionStatus      string `json:"transactionStatus"`
-	ComplianceStatus      string `json:"complianceStatus"`
-	ShortFall      string `json:"shortFall"`
-}
-
-type Deals struct { // Attributes of a Allocation
-	DealID                       string `json:"dealId"`
-	Pledger                      string `json:"pledger"`
-	Pledgee                      string `json:"pledgee"`
-	MaxValue                     string `json:"maxValue"` //Maximum Value of all the securities of each Collateral Form
-	TotalValueLongBoxAccount     string `json:"totalValueLongBoxAccount"`
-	TotalValueSegregatedAccount  string `json:"totalValueSegregatedAccount"`
-	IssueDate                    string `json:"issueDate"`
-	LastSuccessfulAllocationDate string `json:"lastSuccessfulAllocationDate"`
-	Transactions                 string `json:"transactions"`
-}
-
-type Accounts struct {
-	AccountID     string `json:"accountId"`
-	AccountName   string `json:"accountName"`
-	AccountNumber string `json:"accountNumber"`
-	AccountType   string `json:"accountType"`
-	TotalValue    string `json:"totalValue"`
-	Currency      string `json:"currency"`
-	Pledger       string `json:"pledger"`
-	Securities    string `json:"securities"`
-}
-
-type Securities struct {
-	SecurityId          string `json:"Security ID"`
-	AccountNumber       string `json:"Account Number"`
-	SecuritiesName      string `json:"Security Name"`
-	SecuritiesQuantity  string `json:"Quantity"`
-	SecurityType        string `json:"Security Type"`
-	CollateralForm      string `json:"Collateral Form"`
-	TotalValue          string `json:"Total Value"`
-	ValuePercentage     string `json:"Valuation Percentage"`
-	MTM                 string `json:"Market Price"`
-	EffectivePercentage string `json:"Effective Value"`
-	EffectiveValueChanged string `json:"Effective Value Changed"`
-	Currency            string `json:"Currency"`
-}
-
-// Use as Object.Security["CommonStocks"][0]
-// Reference [Tested by Pranav] https://play.golang.org/p/JlQJF5Z14X
-type Ruleset struct {
-	Security         map[string]map[string]float64 `json:"Security"`
-	BaseCurrency     string               `json:"BaseCurrency"`
-	EligibleCurrency []string             `json:"EligibleCurrency"`
-}
-// Varaible record to be filled with the data from the JSON
-var rulesetFetched Ruleset
-
-// Used for Security Array Sort
-// Reference at https://play.golang.org/p/Rz9NCEVhGu
-type SecurityArrayStruct []Securities 
-
-func (slice SecurityArrayStruct) Len() int             { return len(slice) }
-func (slice SecurityArrayStruct) Less(i, j int) bool { // Sorting through the field 'Priority'
-	tempEffectiveValueChanged1, errBool := strconv.ParseFloat(slice[i].EffectiveValueChanged, 64)
-	if errBool != nil {
-		fmt.Println(errBool)
-	}
-	tempEffectiveValueChanged2, errBool := strconv.ParseFloat(slice[j].EffectiveValueChanged, 64)
-	if errBool != nil {
-		fmt.Println(errBool)
-	}
-	if rulesetFetched.Security[slice[i].CollateralForm]["Priority"] < rulesetFetched.Security[slice[j].CollateralForm]["Priority"]{
-		return true
-	}else if rulesetFetched.Security[slice[i].CollateralForm]["Priority"] == rulesetFetched.Security[slice[j].CollateralForm]["Priority"]{
-		if tempEffectiveValueChanged1 > tempEffectiveValueChanged2 {
-			return true	
-		}
-	}
-	return false
-}
-func (slice SecurityArrayStruct) Swap(i, j int) { slice[i], slice[j] = slice[j], slice[i] }
-
-
-// Use as Object.Rates["EUR"]
-// Reference [Tested by Pranav] https://play.golang.org/p/j5Act-jN5C
-type CurrencyConversion struct {
-	Base  string             `json:"Base Currency"`
-	Date  string             `json:"Date"`
-	Rates map[string]float64 `json:"Exchange Rates"`
-}
-
-// To be used as SecurityJSON["CommonStocks"]["Priority"] ==> 1
-var SecurityJSON = map[string]map[string]string{
-	"Govt Securities":       map[string]string{"Concentration Limit": "50", "Priority": "1", "Valuation Percentage": "95"},
-	"Govt Securities - Non EU":      map[string]string{"Concentration Limit": "10", "Priority": "2", "Valuation Percentage": "93"},
-	"Municipal Securities":      map[string]string{"Concentration Limit": "50", "Priority": "3", "Valuation Percentage": "91"},
-	"Municipal Securities - Non EU":      map[string]string{"Concentration Limit": "10", "Priority": "4", "Valuation Percentage": "89"},
-	"Corporate Bonds":       map[string]string{"Concentration Limit": "10", "Priority": "5", "Valuation Percentage": "88"},
-	"Equities":         map[string]string{"Concentration Limit": "10", "Priority": "6", "Valuation Percentage": "85"},
-	"Medium Term Notes":       map[string]string{"Concentration Limit": "10", "Priority": "7", "Valuation Percentage": "83"}}
-// ============================================================================================================================
-// Main - start the chaincode for Allocation management
-// ============================================================================================================================
-func main() {
-	err := shim.Start(new(ManageAllocations))
-	if err != nil {
-		fmt.Printf("Error starting Allocation management chaincode: %s", err)
-	}
-}
-
-// ============================================================================================================================
-// Init - reset all the things
-// ============================================================================================================================
-func (t *ManageAllocations) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	var msg string
-	var err error
-	if len(args) != 1 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting ' ' as an argument\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-	// Initialize the chaincode
-	msg = args[0]
-	// Write the state to the ledger
-	err = stub.PutState("abc", []byte(msg)) //making a test var "abc", I find it handy to read/write to it right away to test the network
-	if err != nil {
-		return nil, err
-	}
-	var empty []string
-	jsonAsBytes, _ := json.Marshal(empty) //marshal an emtpy array of strings to clear the index
-	err = stub.PutState("_init", jsonAsBytes)
-	if err != nil {
-		return nil, err
-	}
-
-	tosend := "{ \"message\" : \"ManageAllocations chaincode is deployed successfully.\", \"code\" : \"200\"}"
-	err = stub.SetEvent("evtsender", []byte(tosend))
-	if err != nil {
-		return nil, err
-	}
-	return nil, nil
-}
-
-// ============================================================================================================================
-// Run - Our entry Dealint for Invocations - [LEGACY] obc-peer 4/25/2016
-// ============================================================================================================================
-func (t *ManageAllocations) Run(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("run is running " + function)
-	return t.Invoke(stub, function, args)
-}
-
-// ============================================================================================================================
-// Invoke - Our entry Dealint for Invocations
-// ============================================================================================================================
-func (t *ManageAllocations) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("invoke is running " + function)
-
-	// Handle different functions
-	if function == "init" { // Initialize the chaincode state, used as reset
-		return t.Init(stub, "init", args)
-	} else if function == "start_allocation" { // Create a new Allocation
-		return t.start_allocation(stub, args)
-	} else if function == "LongboxAccountUpdated" { // Secondary Fire when Longbox account is updated
-		return t.LongboxAccountUpdated(stub, args)
-	}
-	fmt.Println("invoke did not find func: " + function)
-	errMsg := "{ \"message\" : \"Received unknown function invocation\", \"code\" : \"503\"}"
-	err := stub.SetEvent("errEvent", []byte(errMsg))
-	if err != nil {
-		return nil, err
-	}
-	return nil, nil
-}
-
-// ============================================================================================================================
-// Query - Our entry Dealint for Queries
-// ============================================================================================================================
-
-func (t *ManageAllocations) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
-	fmt.Println("query is running " + function)
-
-	// Handle different functions
-	/*if function == "nil" {
-		return t.nil(stub, args)
-	}*/
-	fmt.Println("Allocation does not support query functions.")
-	errMsg := "{ \"message\" : \"Allocation does not support query functions.\", \"code\" : \"503\"}"
-	err := stub.SetEvent("errEvent", []byte(errMsg))
-	if err != nil {
-		return nil, err
-	}
-	return nil, nil
-}
-
-// ============================================================================================================================
-// A used updated his :LongBox Account - create a new Allocation, store into chaincode state
-// ============================================================================================================================
-func (t *ManageAllocations) LongboxAccountUpdated(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-
-	var err error
-	if len(args) != 4 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 4\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-	fmt.Println("start LongboxAccountUpdated")
-
-	_DealChaincode := args[0]
-	_AccountName := args[1]
-	_Role := args[2]
-	_CurrentTimeStamp := args[3]
-
-	fmt.Println("args: ", args)
-	var TransactionsDataFetched []Transactions
-
-	// Fetching Attl transactions for the user
-	function := "getTransactions_byUser"
-	QueryArgs := util.ToChaincodeArgs(function, _AccountName, _Role)
-	result, err := stub.QueryChaincode(_DealChaincode, QueryArgs)
-	if err != nil {
-		errStr := fmt.Sprintf("Error in fetching Transactions from 'Deal' chaincode. Got error: %s", err.Error())
-		fmt.Printf(errStr)
-		return nil, errors.New(errStr)
-	}
-	json.Unmarshal(result, &TransactionsDataFetched)
-
-	// Timestamp to Date/Time Objest in Go and Logic behind cutoff time
-	// Ref: https://play.golang.org/p/KJRigmHzu9
-
-	_CurrentTimeStampHour, err := strconv.ParseInt(_CurrentTimeStamp, 10, 64)
-	if err != nil {
-		panic(err)
-	}
-	var newAllStatus string
-
-	for _, ValueTransaction := range TransactionsDataFetched {
-
-		if ValueTransaction.AllocationStatus == "Pending due to insufficient collateral" {
-
-			if _CurrentTimeStampHour <=18 && _CurrentTimeStampHour >= 0 {
-				// New securites are uploaded in cutoff time
-				newAllStatus = "Ready for Allocation"
-			} else {
-				// New securities not uploaded in cutoff time
-				newAllStatus = "Allocation Failed"
-			}
-
-			// Update allocation status of a transaction
-			function = "update_transaction"
-			invokeArgs := util.ToChaincodeArgs(function,
-				ValueTransaction.TransactionId,
-				ValueTransaction.TransactionDate,
-				ValueTransaction.DealID,
-				ValueTransaction.Pledger,
-				ValueTransaction.Pledgee,
-				ValueTransaction.RQV,
-				ValueTransaction.Currency,
-				"\""+ValueTransaction.CurrencyConversionRate+"\"",
-				ValueTransaction.MarginCAllDate,
-				newAllStatus,
-				ValueTransaction.TransactionStatus,
-				ValueTransaction.ComplianceStatus,
-				ValueTransaction.ShortFall)
-			fmt.Println(ValueTransaction)
-			result, err := stub.InvokeChaincode(_DealChaincode, invokeArgs)
-			if err != nil {
-				errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
-				fmt.Printf(errStr)
-				return nil, errors.New(errStr)
-			}
-			fmt.Println("Transaction hash returned: ", result)
-			fmt.Println(ValueTransaction.TransactionId + " updated with AllocationStatus as " + newAllStatus)
-
-			//Sending event call
-			tosend := "{ \"transactionId\" : \"" + ValueTransaction.TransactionId + "\", \"message\" : \"Transaction updated succcessfully with Allocation Status as " + newAllStatus + " \", \"code\" : \"200\"}"
-			err = stub.SetEvent("evtsender", []byte(tosend))
-			if err != nil {
-				return nil, err
-			}
-		} else if ValueTransaction.TransactionStatus == "Ready for Allocation" {
-			//Sending event call
-			tosend := "{ \"transactionId\" : \"" + ValueTransaction.TransactionId + "\", \"message\" : \"Transaction updated succcessfully with Allocation Status as 'Ready for Allocation' \", \"code\" : \"200\"}"
-			err = stub.SetEvent("evtsender", []byte(tosend))
-			if err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	fmt.Println("end LongboxAccountUpdated")
-	return nil, nil
-}
-
-// ============================================================================================================================
-// Start Allocation - create a new Allocation, store into chaincode state
-// ============================================================================================================================
-func (t *ManageAllocations) start_allocation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
-	var err error
-	if len(args) != 8 {
-		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 8\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-	fmt.Println("start start_allocation")
-
-	// Alloting Params
-	DealChaincode := args[0]
-	AccountChainCode := args[1]
-	APIIP := args[2]
-	DealID := args[3]
-	TransactionID := args[4]
-	PledgerLongboxAccount := args[5]
-	PledgeeSegregatedAccount := args[6]
-	MarginCallTimpestamp := args[7]
-
-	// Json to create report
-	reportInJson := `{`
-
-	//-----------------------------------------------------------------------------
-
-	// Fetch Deal details from Blockchain
-	f := "getDeal_byID"
-	queryArgs := util.ToChaincodeArgs(f, DealID)
-	dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
-	if err != nil {
-		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
-		fmt.Printf(errStr)
-		return nil, errors.New(errStr)
-	}
-	DealData := Deals{}
-	json.Unmarshal(dealAsBytes, &DealData)
-	fmt.Println(DealData)
-	if DealData.DealID == DealID {
-		fmt.Println("Deal found with DealID : " + DealID)
-	} else {
-		errMsg := "{ \"message\" : \"" + DealID + " Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-
-	Pledger := DealData.Pledger
-	Pledgee := DealData.Pledgee
-	fmt.Println("Pledger : ", Pledger)
-	fmt.Println("Pledgee : ", Pledgee)
-
-	// Fetch Transaction details from Blockchain
-	function := "getTransaction_byID"
-	queryArgs = util.ToChaincodeArgs(function, TransactionID)
-	transactionAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
-	if err != nil {
-		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
-		fmt.Printf(errStr)
-		return nil, errors.New(errStr)
-	}
-	TransactionData := Transactions{}
-	json.Unmarshal(transactionAsBytes, &TransactionData)
-	fmt.Println(TransactionData)
-	if TransactionData.TransactionId == TransactionID {
-		fmt.Println("Transaction found with TransactionID : " + TransactionID)
-	} else {
-		errMsg := "{ \"message\" : \"" + TransactionID + " Not Found.\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-	/*RQV,errBool := strconv.ParseFloat(TransactionData.RQV)*/
-	RQV, errBool := strconv.ParseFloat(TransactionData.RQV, 64)
-	if errBool != nil {
-		fmt.Println(errBool)
-	}
-
-	fmt.Println("RQV : ", RQV)
-	// RQV currency of a deal
-	RQVCurrency := TransactionData.Currency
-	fmt.Println("RQVCurrency : ", RQVCurrency)
-	//-----------------------------------------------------------------------------
-
-	reportInJson += `"Deal ID" : "` + DealID + `",`
-	reportInJson += `"Transaction ID" : "` + TransactionID + `",`
-	reportInJson += `"Margin Call Date" : "` + MarginCallTimpestamp + `",`
-	reportInJson += `"Pledgee" : "` + Pledgee + `",`
-	reportInJson += `"Pledger" : "` + Pledger + `",`
-	reportInJson += `"Pledger Longbox Account" : "` + PledgerLongboxAccount + `",`
-	reportInJson += `"Pledgee Segregated Account" : "` + PledgeeSegregatedAccount + `",`
-	reportInJson += `"RQV" : "` + strconv.FormatFloat(RQV, 'f', 2, 64) + `",`
-	reportInJson += `"Currency" : "` + TransactionData.Currency + `",`
-
-	// SecurityJSON to String https://play.golang.org/p/_C21BONfZk
-	reportInJson += `"Public Rule Set" : {"Govt Securities":{"Valuation Percentage":"95","Concentration Limit":"50","Priority":"1"},"Govt Securities - Non EU":{"Concentration Limit":"10","Priority":"2","Valuation Percentage":"93"},"Municipal Securities":{"Priority":"3","Valuation Percentage":"91","Concentration Limit":"50"},"Municipal Securities - Non EU":{"Priority":"4","Valuation Percentage":"89","Concentration Limit":"10"},"Equities":{"Valuation Percentage":"85","Concentration Limit":"10","Priority":"6"},"Corporate Bonds":{"Concentration Limit":"10","Priority":"5","Valuation Percentage":"88"},"Medium Term Notes":{"Priority":"7","Valuation Percentage":"83","Concentration Limit":"10"}},`
-	//-----------------------------------------------------------------------------
-
-	// Update allocation status to "Allocation in progress"
-	function = "update_transaction_AllocationStatus"
-	invokeArgs := util.ToChaincodeArgs(function, TransactionID, "Allocation in progress")
-	result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
-	if err != nil {
-		errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
-		fmt.Printf(errStr)
-		return nil, errors.New(errStr)
-	}
-	fmt.Print("Transaction hash returned: ")
-	fmt.Println(result)
-	fmt.Println("Successfully updated allocation status to 'Allocation in progress'")
-
-	//-----------------------------------------------------------------------------
-
-	// Fetching the Private Securtiy Ruleset based on Pledger & Pledgee
-	// Escaping the values to be put in URL
-	//PledgerESC := url.QueryEscape(Pledger)
-	//PledgeeESC := url.QueryEscape(Pledgee)
-
-	url := fmt.Sprintf("http://%s/securityRuleset/%s/%s", APIIP, Pledger, Pledgee)
-	fmt.Println("URL for Ruleset : " + url)
-
-	// Build the request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Println("Ruleset fetch error: ", err)
-		return nil, err
-	}
-
-	// For control over HTTP client headers, redirect policy, and other settings, create a Client
-	// A Client is an HTTP client
-	client := &http.Client{}
-
-	// Send the request via a client
-	// Do sends an HTTP request and returns an HTTP response
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("Do: ", err)
-		errMsg := "{ \"message\" : \"Unable to fetch Security Ruleset at " + APIIP + ".\", \"code\" : \"503\"}"
-		err = stub.SetEvent("errEvent", []byte(errMsg))
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	fmt.Println("The SecurityRuleset response is::" + strconv.Itoa(resp.StatusCode))
-
-	
-
-	// Use json.Decode for reading streams of JSON data and store it
-	if err := json.NewDecoder(resp.Body).Decode(&rulesetFetched); err != nil {
-		fmt.Println(err)
-	}
-
-	resbody, err := json.Marshal(rulesetFetched)
-	if err != nil {
-		fmt.Println(err)
-	}
-	reportInJson += `"Private Rule set" : ` + string(resbody) + `,`
-
-	// Callers should close resp.Body when done reading from it
-	// Defer the closing of the body
-	defer resp.Body.Close()
-
-	fmt.Println("Ruleset : ")
-	fmt.Println(rulesetFetched)
-	//fmt.Println(resbody)
-
-	//-----------------------------------------------------------------------------
-
-	/*	Fetching Currency coversion rates in bast form of USD.
-		Sample Response as JSON:
-		{
-			"base": "USD",
-			"date": "2017-03-20",
-			"rates": {
-				"AUD": 1.2948,
-				"BGN": 1.819,
-				"BRL": 3.1079,
-				"CAD": 1.3355,
-				"CHF": 0.99702,
-				"CNY": 6.9074,
-				"CZK": 25.131,
-				"DKK": 6.9146,
-				"GBP": 0.80723,
-				"HKD": 7.7657,
-				"HRK": 6.8876,
-				"HUF": 287.05,
-				"IDR": 13314,
-				"ILS": 3.6313,
-				"INR": 65.365,
-				"JPY": 112.71,
-				"KRW": 1115.7,
-				"MXN": 19.114,
-				"MYR": 4.4265,
-				"NOK": 8.4894,
-				"NZD": 1.4203,
-				"PHP": 50.061,
-				"PLN": 3.9825,
-				"RON": 4.2415,
-				"RUB": 57.53,
-				"SEK": 8.8428,
-				"SGD": 1.3979,
-				"THB": 34.725,
-				"TRY": 3.6335,
-				"ZAR": 12.676,
-				"EUR": 0.93006
-			}
-		}
-	*/
-	url2 := fmt.Sprintf("http://api.fixer.io/latest?base=" + RQVCurrency)
-
-	// Build the request
-	req2, err2 := http.NewRequest("GET", url2, nil)
-	if err2 != nil {
-		fmt.Println("Currency coversion rate fetch error: ", err2)
-		return nil, err2
-	}
-
-	// For control over HTTP client headers, redirect policy, and other settings, create a Client
-	// A Client is an HTTP client
-	client2 := &http.Client{}
-
-	// Send the request via a client
-	// Do sends an HTTP request and returns an HTTP response
-	resp2, err2 := client2.Do(req2)
-	if err2 != nil {
-		fmt.Println("Do: ", err2)
-		errMsg := "{ \"message\" : \"Unable to fetch Currency Exchange Rates from: " + url2 + ".\", \"code\" : \"503\"}"
-		err2 = stub.SetEvent("errEvent", []byte(errMsg))
-		if err2 != nil {
-			return nil, err2
-		}
-	}
-
-	fmt.Println("The SecurityRuleset response is::" + strconv.Itoa(resp2.StatusCode))
-
-	// Varaible ConversionRate to be filled with the data from the JSON
-	var ConversionRate CurrencyConversion
-
-	// Use json.Decode for reading streams of JSON data and store it
-	if err := json.NewDecoder(resp2.Body).Decode(&ConversionRate); err != nil {
-		fmt.Println(err)
-	}
-
-	respbody, err := json.Marshal(ConversionRate)
-	if err != nil {
-		fmt.Println(err)
-	}
-	reportInJson += `"Currency Conversion Rate" : ` + string(respbody) + `,`
-
-	// Callers should close resp.Body when done reading from it
-	// Defer the closing of the body
-	defer resp2.Body.Close()
-
-	fmt.Println("Exchange Rate : ")
-	fmt.Println(ConversionRate)
-
-	//-----------------------------------------------------------------------------
-
-	// Caluculate eligible Collateral value from RQV
-	RQVEligibleValue := make(map[string]float64)
-
-	//Iterating through all the securities present in the ruleset
-	for key, value := range rulesetFetched.Security {
-		// key = "CommonStocks" && value = [35, 1, 95]
-		// value[0] => ConcentrationLimit
-		// value[1] => Priority
-		// value[2] => ValuationPercentage
-		ConcentrationLimitPri := value["Concentration Limit"]
-		RQVEligibleValue[key] = (RQV * ConcentrationLimitPri) / 100
-		//fmt.Printf("inside checking privateRuleset is subset of publicRuleSet..")
-		//fmt.Printf("%#v", RQVEligibleValue[key])		
-	}
-	fmt.Println("RQVEligibleValue after calculation:")
-	fmt.Printf("%#v", RQVEligibleValue)
-	fmt.Println()
-
-	//-----------------------------------------------------------------------------
-
-	// Fetch Pledger & Pledgee securities for longbox and segregated accounts
-	function = "getSecurities_byAccount"
-
-	queryArgs = util.ToChaincodeArgs(function, PledgerLongboxAccount)
-	PledgerLongboxSecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
-
-	queryArgs = util.ToChaincodeArgs(function, PledgeeSegregatedAccount)
-	PledgeeSegregatedSecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
-
-	/**	Calculate the effective value and total value of each Security present in the Longbox account of the pledger
-	and the Segregated account of the pledgee
-	*/
-	var TotalValuePledgerLongbox, TotalValuePledgeeSegregated, AvailableEligibleCollateral float64
-	var PledgerLongboxSecurities, PledgeeSegregatedSecurities, CombinedSecurities []Securities
-
-	// Make inteface to receive string. UnMarshal them extract them and make an array out of them.
-	var PledgerLongboxSecuritiesJSON, PledgeeSegregatedSecuritiesJSON SecurityArrayStruct
-	json.Unmarshal(PledgerLongboxSecuritiesString, &PledgerLongboxSecuritiesJSON)
-	json.Unmarshal(PledgeeSegregatedSecuritiesString, &PledgeeSegregatedSecuritiesJSON)
-
-	TotalValuePledgerLongboxSecurities := make(map[string]float64)
-	TotalValuePledgeeSegregatedSecurities := make(map[string]float64)
-	AvailableCollateral := make(map[string]float64)
-	AvailableEligible := make(map[string]float64)
-
-	fmt.Println("PledgerLongboxSecuritiesJSON after calculation:")
-	fmt.Printf("%#v", PledgerLongboxSecuritiesJSON)
-	fmt.Println()
-	fmt.Println("PledgeeSegregatedSecuritiesJSON after calculation:")
-	fmt.Printf("%#v", PledgeeSegregatedSecuritiesJSON)
-	fmt.Println()
-	//Operations for Pledger Longbox Securities
-	for _, value := range PledgerLongboxSecuritiesJSON {
-		// Key = Security ID && value = Security Structure
-		tempSecurity := Securities{}
-		tempSecurity = value
-
-		// Check if Current Collateral Form type is acceptied in ruleset. If not skip it!
-		if len(rulesetFetched.Security[tempSecurity.CollateralForm]) > 0 {
-
-			url2 := fmt.Sprintf("http://" + APIIP + "/MarketData/" + tempSecurity.SecurityId)
-
-			// Build the request
-			req2, err2 := http.NewRequest("GET", url2, nil)
-			if err2 != nil {
-				fmt.Println("Market rate fetch error: ", err2)
-				return nil, err2
-			}
-
-			// For control over HTTP client headers, redirect policy, and other settings, create a Client
-			// A Client is an HTTP cliPledgeeSegregatedSecuritiesent
-			client2 := &http.Client{}
-
-			// Send the request via a client
-			// Do sends an HTTP request and returns an HTTP response
-			resp2, err2 := client2.Do(req2)
-			if err2 != nil {
-				fmt.Println("Do: ", err2)
-				errMsg := "{ \"message\" : \"Unable to fetch Market Rates from: " + url2 + ".\", \"code\" : \"503\"}"
-				err2 = stub.SetEvent("errEvent", []byte(errMsg))
-				if err2 != nil {
-					return nil, err2
-				}
-			}
-
-			fmt.Println("The MarketData response is::" + strconv.Itoa(resp2.StatusCode))
-
-			var stringArr []string
-
-			// Use json.Decode for reading streams of JSON data and store it
-			if err := json.NewDecoder(resp2.Body).Decode(&stringArr); err != nil {
-				fmt.Println(err)
-			}
-			// Callers should close resp.Body when done reading from it
-			// Defer the closing of the body
-			defer resp2.Body.Close()
-
-			tempSecurity.MTM = stringArr[0]
-			// Storing the Value percentage in the security ruleset data itself
-			tempSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[tempSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
-			//convert valuePercentage(string) to float
-			tempValuePercentage, errBool := strconv.ParseFloat(tempSecurity.ValuePercentage, 64)
-			if errBool != nil {
-				fmt.Println(errBool)
-			}
-
-			temp, errBool := strconv.ParseFloat(tempSecurity.MTM, 64)
-			if errBool != nil {
-				fmt.Println(errBool)
-			}
-
-			_rate := ConversionRate.Rates[tempSecurity.Currency]
-			if tempSecurity.Currency == RQVCurrency {
-				_rate = 1
-			}
-
-			fmt.Println("_rate")
-			fmt.Println(_rate)
-			// change mtm to appropriate float format
-			//calculate exchange rate for mtm
-			_changedMTM :=  temp/_rate
-			fmt.Println("_changedMTM")
-			fmt.Println(_changedMTM)
-			// Effective Value =  (MTM(market Value) * valuePercentage)/100
-			temp3 := (_changedMTM * tempValuePercentage)/100
-			fmt.Println("temp3")
-			fmt.Println(temp3)
-			tempSecurity.EffectiveValueChanged = strconv.FormatFloat(temp3, 'f', 2, 64)
-			// Adding it to TotalValue
-			temp2, errBool := strconv.ParseFloat(tempSecurity.SecuritiesQuantity, 64)
-			if errBool != nil {
-				fmt.Println(errBool)
-			}
-			// Calculate Total Value = Effective Value * Quantity
-			tempTotal := temp3 * temp2
-
-			tempSecurity.TotalValue = strconv.FormatFloat(tempTotal, 'f', 2, 64)
-			fmt.Println("tempSecurity.TotalValue")
-			fmt.Println(tempSecurity.TotalValue)
-			// Calculate Total value based on Collateral form
-			TotalValuePledgerLongboxSecurities[tempSecurity.CollateralForm] += tempTotal
-			// Calculate Total value of pledger's longbox account
-			TotalValuePledgerLongbox += tempTotal
-			
-			/*	Warning :
-				Saving Priority for the Security in filed `ValuePercentage`
-				This is just for using the limited sorting application provided by GOlang
-				By no chance is this to be stored on Blockchain.
-			*/
-			tempSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[tempSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
-			fmt.Println("tempSecurity.ValuePercentage")
-			fmt.Println(tempSecurity.ValuePercentage)
-			// Append Securities to an array
-			PledgerLongboxSecurities = append(PledgerLongboxSecurities, tempSecurity)
-			CombinedSecurities = append(CombinedSecurities, tempSecurity)
-		}
-	}
-	
-	fmt.Println("CombinedSecurities from pledgerLongboxSecuritiesJson:",CombinedSecurities)
-	// Operations for Pledgee Segregated Account(s)
-	for _, value := range PledgeeSegregatedSecuritiesJSON {
-		// Key = Security ID && value = Security Structure
-		tempSecurity := Securities{}
-		flag:= false
-		tempSecurity = value
-		fmt.Println("tempSecurity: ",tempSecurity)
-		if len(rulesetFetched.Security[tempSecurity.CollateralForm]) > 0 {
-			for i,value2:= range CombinedSecurities{
-
-					valueSecurity:= Securities{}
-					valueSecurity = value2
-					fmt.Println("valueSecurity: ",valueSecurity)
-				// Check if Current Collateral Form type is acceptied in ruleset. If not skip it!
-				if len(rulesetFetched.Security[valueSecurity.CollateralForm]) > 0 {
-					fmt.Println("valueSecurity.SecurityId(CombinedSecurities): ",valueSecurity.SecurityId)
-					fmt.Println("tempSecurity.SecurityId(PledgeeSegregatedSecurities): ",tempSecurity.SecurityId)
-	  				// if combined security already contain same security, then update quantity and other values accordingly
-					if valueSecurity.SecurityId == tempSecurity.SecurityId{
-						fmt.Println("Securities matched.")
-						securityQuantity1, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}
-						securityQuantity2, errBool2 := strconv.ParseFloat(tempSecurity.SecuritiesQuantity, 64)
-						if errBool2 != nil {
-							fmt.Println(errBool2)
-						}
-						securityQuantity1 += securityQuantity2
-						//valueSecurity.SecuritiesQuantity += tempSecurity.SecuritiesQuantity
-						fmt.Println("SecuritiesQuantity: ",securityQuantity1)
-						valueSecurity.SecuritiesQuantity = strconv.FormatFloat(securityQuantity1, 'f', 2, 64)
-						// Storing the Value percentage in the security data itself
-						//valueSecurity.ValuePercentage = SecurityJSON[valueSecurity.CollateralForm]["Valuation Percentage"]
-						//convert valuePercentage(string) to float
-						tempValuePercentage, errBool := strconv.ParseFloat(valueSecurity.ValuePercentage, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}
-						fmt.Println("tempValuePercentage: ",tempValuePercentage)
-						temp, errBool := strconv.ParseFloat(valueSecurity.MTM, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}
-						fmt.Println("mtm: ",temp)
-						_rate := ConversionRate.Rates[valueSecurity.Currency]
-						if valueSecurity.Currency == RQVCurrency {
-							_rate = 1
-						}
-						fmt.Println("_rate: ",_rate)
-						//calculate Currency conversion rate(to RQVCurrency) for mtm  
-						_changedMTM :=  temp/_rate
-						fmt.Println("_changedMTM: ", _changedMTM)
-						// Effective Value =  (MTM(market Value) * valuePercentage)/100
-						temp3 := (_changedMTM * tempValuePercentage)/100
-						fmt.Println("EffectiveValueChanged: ",temp3)
-						valueSecurity.EffectiveValueChanged = strconv.FormatFloat(temp3, 'f', 2, 64)
-						// Adding it to TotalValue
-						/*temp2, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}*/
-						// Calculate Total Value = Effective Value * Quantity
-						tempTotal := temp3 * securityQuantity1
-						//fmt.Println("TotalValue: ",tempTotal)
-						valueSecurity.TotalValue = strconv.FormatFloat(tempTotal, 'f', 2, 64)
-						fmt.Println("TotalValue: ",valueSecurity.TotalValue)
-						// Calculate Total value based on Collateral form
-						TotalValuePledgeeSegregatedSecurities[valueSecurity.CollateralForm] += tempTotal
-						fmt.Println("totalValueSegregatedAccount(CollateralForm): ",TotalValuePledgeeSegregatedSecurities[valueSecurity.CollateralForm])
-						// Calculate Total value of pledgee's segregated account
-						TotalValuePledgeeSegregated += tempTotal
-						fmt.Println("TotalValuePledgeeSegregated: ",TotalValuePledgeeSegregated)			
-						/*	Warning :
-							Saving Priority for the Security in filed `ValuePercentage`
-							This is just for using the limited sorting application provided by GOlang
-							By no chance is this to be stored on Blockchain.
-						*/
-						//valueSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[valueSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
-						//fmt.Println("ValuePercentage: ",valueSecurity.ValuePercentage)
-						// Append Securities to an array
-						PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
-						CombinedSecurities[i]= valueSecurity;
-						fmt.Println("CombinedSecurity: ",CombinedSecurities[i])
-						flag = true
-						//CombinedSecurities = append(CombinedSecurities, valueSecurity)
-					}
-				}
-			}
-			if flag == false{
-				fmt.Println("Securities are different")
-				//fmt.Println("SecuritiesQuantity(PledgeeSegregatedSecurities): ",tempSecurity.SecuritiesQuantity)
-				// Storing the Value percentage in the security data itself
-				//tempSecurity.ValuePercentage = SecurityJSON[tempSecurity.CollateralForm]["Valuation Percentage"]
-				//fmt.Println("tempSecurity.ValuePercentage: ",tempSecurity.ValuePercentage)
-				//convert valuePercentage(string) to float
-				tempValuePercentage, errBool := strconv.ParseFloat(tempSecurity.ValuePercentage, 64)
-				if errBool != nil {
-					fmt.Println(errBool)
-				}
-				fmt.Println("tempValuePercentage: ",tempValuePercentage)
-				temp, errBool := strconv.ParseFloat(tempSecurity.MTM, 64)
-				if errBool != nil {
-					fmt.Println(errBool)
-				}
-				fmt.Println("mtm: ",temp)
-				_rate := ConversionRate.Rates[tempSecurity.Currency]
-				if tempSecurity.Currency == RQVCurrency {
-					_rate = 1
-				}
-				fmt.Println("tempSecurity.Currency: ",tempSecurity.Currency)
-				fmt.Println("_rate: ",_rate)
-				//calculate Currency conversion rate(to RQVCurrency) for mtm  
-				_changedMTM :=  temp/_rate
-				fmt.Println("_changedMTM: ",_changedMTM)
-				// Effective Value =  (MTM(market Value) * valuePercentage)/100
-				temp3 := (_changedMTM * tempValuePercentage)/100
-				fmt.Println("temp3: ",temp3)
-				tempSecurity.EffectiveValueChanged = strconv.FormatFloat(temp3, 'f', 2, 64)
-				// Adding it to TotalValue
-				fmt.Println("EffectiveValueChanged: ",tempSecurity.EffectiveValueChanged)
-				temp2, errBool := strconv.ParseFloat(tempSecurity.SecuritiesQuantity, 64)
-				if errBool != nil {
-					fmt.Println(errBool)
-				}
-				fmt.Println("securityQuantity: ",temp2)
-				// Calculate Total Value = Effective Value * Quantity
-				tempTotal := temp3 * temp2
-				fmt.Println("tempTotal: ",tempTotal)
-				tempSecurity.TotalValue = strconv.FormatFloat(tempTotal, 'f', 2, 64)
-				fmt.Println("tempSecurity.TotalValue")
-				fmt.Println(tempSecurity.TotalValue)
-				// Calculate Total value based on Collateral form
-				TotalValuePledgeeSegregatedSecurities[tempSecurity.CollateralForm] += tempTotal
-				fmt.Println("TotalValuePledgeeSegregatedSecurities[CollateralForm]",TotalValuePledgeeSegregatedSecurities[tempSecurity.CollateralForm])
-				// Calculate Total value of pledgee's segregated account
-				TotalValuePledgeeSegregated += tempTotal
-				fmt.Println("TotalValuePledgeeSegregated: ",TotalValuePledgeeSegregated)	
-				/*	Warning :
-					Saving Priority for the Security in filed `ValuePercentage`
-					This is just for using the limited sorting application provided by GOlang
-					By no chance is this to be stored on Blockchain.
-				*/
-				//tempSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[tempSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
-				//fmt.Println("tempSecurity.ValuePercentage:",tempSecurity.ValuePercentage)
-				// Append Securities to an array
-				PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
-				fmt.Println("PledgeeSegregatedSecurities: ",PledgeeSegregatedSecurities)
-				CombinedSecurities = append(CombinedSecurities, tempSecurity)
-				fmt.Println("CombinedSecurity: ",CombinedSecurities)
-			}
-		}
-	}
-	 		
-	fmt.Println("TotalValuePledgeeSegregatedSecurities")
-	fmt.Println(TotalValuePledgeeSegregatedSecurities)
-	fmt.Println("TotalValuePledgeeSegregated")
-	fmt.Println(TotalValuePledgeeSegregated)
-	
-	fmt.Println()
-	fmt.Println("PledgerLongboxSecurities after calculation:")
-	fmt.Printf("%#v", PledgerLongboxSecurities)
-	fmt.Println()
-	fmt.Println("PledgeeSegregatedSecurities after calculation:")
-	fmt.Printf("%#v", PledgeeSegregatedSecurities)
-	fmt.Println()
-	fmt.Println("CombinedSecurities after calculation:")
-	fmt.Printf("%#v", CombinedSecurities)
-	fmt.Println()
-
-	for _, valueSecurity := range CombinedSecurities {
-			tempTotal, errBool := strconv.ParseFloat(valueSecurity.TotalValue, 64)
-			if errBool != nil {
-				fmt.Println(errBool)
-			}
-			// Calculate the total value of all the securities based on Collateral form
-			AvailableCollateral[valueSecurity.CollateralForm] += tempTotal
-	}
-
-	for key := range AvailableCollateral {
-		// Calculate Available Eligiblex = Minimum (Available[tempSecurity.CollateralForm], Eligible[tempSecurity.CollateralForm])
-		AvailableEligible[key] = math.Min(AvailableCollateral[key],RQVEligibleValue[key])
-
-		// Calculate Available Eligible Collateral = Sum (Available Eligible)
-		AvailableEligibleCollateral = AvailableEligibleCollateral + AvailableEligible[key]
-	}
-	fmt.Println("AvailableCollateral after calculation:")
-	fmt.Printf("%#v", AvailableCollateral)
-	fmt.Println()
-	fmt.Println("AvailableEligible")
-	fmt.Println(AvailableEligible)
-	fmt.Println()
-	fmt.Println("AvailableEligibleCollateral")
-	fmt.Println(AvailableEligibleCollateral)
-	fmt.Println()
-	//-----------------------------------------------------------------------------
-
-	if AvailableEligibleCollateral < RQV {
-		RQVLeft:= RQV - AvailableEligibleCollateral
-		_RQVLeft := strconv.FormatFloat(RQVLeft, 'f', 2, 64)
-		// Update transaction's allocation status to "Pending due to insufficient collateral" and transaction status to "Pending"
-		f := "update_transaction"
-		invoke_args := util.ToChaincodeArgs(f, TransactionData.TransactionId,TransactionData.TransactionDate, TransactionData.DealID, TransactionData.Pledger,TransactionData.Pledgee, TransactionData.RQV, TransactionData.Currency,"\" \"", TransactionData.MarginCAllDate, "Pending due to insufficient collateral",TransactionData.TransactionStatus,TransactionData.ComplianceStatus,_RQVLeft)
-		fmt.Println(TransactionData);
-		result, err := stub.InvokeChaincode(DealChaincode, invoke_args)
-		if err != nil {
-			errStr := fmt.Sprintf("Failed to invoke chaincode. Got error: %s", err.Error())
-			fmt.Printf(errStr)
-			return nil, errors.New(errStr)
-		} 	
-		fmt.Print("Update transaction returned : ")
-		fmt.Println(result)
-		fmt.Println("Successfully updated allocation status to 'Pending' due to insufficient collateral'")
-	    //Send a event to event handler
-	    tosend:= "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"Transaction Allocation updated succcessfully with status 'Pending' due to insufficient collateral.\", \"code\" : \"200\",\"RQVLeft\" : \"" + _RQVLeft + "\"}"
-	    err = stub.SetEvent("evtsender", [] byte(tosend))
-	    if err != nil {
-	        return nil, err
-	    }
-	    // Actual return of process end. 
-		return nil, nil
-
-	} else {
-
-		//-----------------------------------------------------------------------------
-		
-		// Sorting the Securities in PledgerLongboxSecurities & PledgeeSegregatedSecurities
-		// Using Code defination like https://play.golang.org/p/ciN45THQjM
-		// Reference from http://nerdyworm.com/blog/2013/05/15/sorting-a-slice-of-structs-in-go/
-
-		//sort.Sort(SecurityArrayStruct(PledgerLongboxSecurities))
-		//sort.Sort(SecurityArrayStruct(PledgeeSegregatedSecurities))
-		sort.Sort(SecurityArrayStruct(CombinedSecurities))
-		fmt.Println("CombinedSecurities after sort: ", CombinedSecurities)
-		// Start Allocatin & Rearrangment
-		// ReallocatedSecurities -> Structure where securites to reallocate will be stored
-		// CombinedSecurities will only be used to read securities in order. Actual Changes will be 
-		//	done in PledgerLongboxSecurities & PledgeeSegregatedSecurities
-
-		// RQVEligibleValue[CollateralType] contains the max eligible vaule for each type
-		RQVEligibleValueLeft := RQVEligibleValue
-		RQVLeft := RQV
-
-		SecuritiesAllocated := make(map[string]float64)
-		TotalValueAllocated := make(map[string]float64)
-		var ReallocatedSecurities []Securities
-		
-		// Iterating through all the securities 
-		// Label: PledgerLongboxSecuritiesIterator --> to be used for break statements
-		
-		CombinedSecuritiesIterator:
-		for _, valueSecurity := range CombinedSecurities {
-			fmt.Println("RQVLeft: ", RQVLeft)
-			//fmt.Println("TotalValuePledgeeSegregated: ", TotalValuePledgeeSegregated)
-			//fmt.Println("TotalValuePledgerLongbox: ", TotalValuePledgerLongbox)
-			//var TotalValuePledgee float64
-			if RQVLeft > 0 {
-				// More Security need to be taken out
-				rqvEligibleValueLeft := RQVEligibleValueLeft[valueSecurity.CollateralForm]
-				fmt.Println("rqvEligibleValueLeft: ",rqvEligibleValueLeft)
-				totalValue, errBool := strconv.ParseFloat(valueSecurity.TotalValue, 64)
-				if errBool != nil {
-					fmt.Println(errBool)
-				}
-				fmt.Println("totalValue: ",totalValue)
-				if rqvEligibleValueLeft > 0 {
-					if totalValue <= rqvEligibleValueLeft {
-						// At least one more this type of collateralForm to be taken out
-						if totalValue <= RQVLeft {
-							// All Security of this type will re allocated as RQV has balance
-
-							RQVLeft -= totalValue
-							fmt.Println("RQVLeft: ",RQVLeft)
-							RQVEligibleValueLeft[valueSecurity.CollateralForm] -= totalValue
-							fmt.Println(valueSecurity.CollateralForm +": ",RQVEligibleValueLeft[valueSecurity.CollateralForm])
-							ReallocatedSecurities = append(ReallocatedSecurities, valueSecurity)
-							fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
-							securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-							if errBool != nil {
-								fmt.Println(errBool)
-							}
-							fmt.Println("securityQuantity: ",securityQuantity)
-							SecuritiesAllocated[valueSecurity.SecurityId] = securityQuantity
-							fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
-							TotalValueAllocated[valueSecurity.SecurityId] = totalValue
-							fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
-							/*TotalValuePledgee += totalValue
-							fmt.Println(TotalValuePledgee)*/
-						}else {
-							// RQV has insufficient balance to take all securities
-							securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-							if errBool != nil {
-								fmt.Println(errBool)
-							}
-							fmt.Println("securityQuantity: ",securityQuantity)
-							effectiveValueChanged, errBool := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
-							if errBool != nil {
-								fmt.Println(errBool)
-							}
-							fmt.Println("effectiveValueChanged: ",effectiveValueChanged)
-							QuantityToTakeout := math.Floor((RQVLeft * securityQuantity)/ totalValue)
-							fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
-							if QuantityToTakeout == 0{
-								QuantityToTakeout = 1
-							}
-							totalValueToAllocate := QuantityToTakeout * effectiveValueChanged
-							fmt.Println("totalValueToAllocate: ",totalValueToAllocate)
-							if totalValueToAllocate < rqvEligibleValueLeft{
-								if totalValueToAllocate < RQVLeft{
-									QuantityToTakeout = math.Ceil((RQVLeft * securityQuantity)/ totalValue)
-									fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
-									totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
-									fmt.Println("totalValueToAllocate: ",totalValueToAllocate)
-								}
-							}
-							RQVLeft -= totalValueToAllocate
-							fmt.Println("RQVLeft: ",RQVLeft)
-							RQVEligibleValueLeft[valueSecurity.CollateralForm] -= totalValueToAllocate
-							fmt.Println("RQVEligibleValueLeft: ",RQVEligibleValueLeft)
-							tempSecurity2 := valueSecurity
-							tempSecurity2.SecuritiesQuantity = strconv.FormatFloat(QuantityToTakeout, 'f', 2, 64)
-							tempSecurity2.TotalValue = strconv.FormatFloat(totalValueToAllocate, 'f', 2, 64)
-							if QuantityToTakeout != 0 {
-								ReallocatedSecurities = append(ReallocatedSecurities, tempSecurity2)
-							}
-							fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
-							SecuritiesAllocated[valueSecurity.SecurityId] = QuantityToTakeout
-							fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
-							TotalValueAllocated[valueSecurity.SecurityId] = totalValueToAllocate
-							fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
-							/*TotalValuePledgee += totalValueToAllocate
-							fmt.Println(TotalValuePledgee)*/
-						}
-					}else{
-						// rqvEligibleValueLeft is less than total Value
-						securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}
-						fmt.Println("securityQuantity: ",securityQuantity)
-						effectiveValueChanged, errBool := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
-						if errBool != nil {
-							fmt.Println(errBool)
-						}
-						fmt.Println("effectiveValueChanged: ",effectiveValueChanged)
-						QuantityToTakeout := math.Floor((rqvEligibleValueLeft * securityQuantity)/ totalValue)
-						fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
-						
-						totalValueToAllocate := QuantityToTakeout * effectiveValueChanged
-						fmt.Println("totalValueToAllocate: ", totalValueToAllocate)
-						if totalValueToAllocate > RQVLeft {
-							// One more security can be taken out
-							QuantityToTakeout = math.Ceil((RQVLeft * securityQuantity)/ totalValue)
-							fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
-							if QuantityToTakeout == 0{
-								QuantityToTakeout = 1
-							}
-							totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
-							fmt.Println("totalValueToAllocate: ", totalValueToAllocate)
-						}
-						if totalValueToAllocate > rqvEligibleValueLeft {
-							QuantityToTakeout = 0
-							totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
-						}
-						RQVLeft -= totalValueToAllocate
-						fmt.Println("RQVLeft: ",RQVLeft)
-						RQVEligibleValueLeft[valueSecurity.CollateralForm] -= totalValueToAllocate
-						fmt.Println("RQVEligibleValueLeft: ",RQVEligibleValueLeft)
-						tempSecurity2 := valueSecurity
-						tempSecurity2.SecuritiesQuantity = strconv.FormatFloat(QuantityToTakeout, 'f', 2, 64)
-						tempSecurity2.TotalValue = strconv.FormatFloat(totalValueToAllocate, 'f', 2, 64)
-						if QuantityToTakeout != 0 {
-							ReallocatedSecurities = append(ReallocatedSecurities, tempSecurity2)
-						}
-						fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
-						SecuritiesAllocated[valueSecurity.SecurityId] = QuantityToTakeout
-						fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
-						TotalValueAllocated[valueSecurity.SecurityId] = totalValueToAllocate
-						fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
-						/*TotalValuePledgee += totalValueToAllocate
-						fmt.Println("TotalValuePledgee: "+TotalValuePledgee)*/
-					}
-				} else{
-					// no security to take out of this type of security
-				}
-			} else {
-				// Security cutting done
-				// Break from the PledgerLongboxSecuritiesIterator as Pledgee's segregated account balance reached to RQV
-				break CombinedSecuritiesIterator
-			}
-		}
-
-		fmt.Println("Final RQVLeft: ", RQVLeft)
-		fmt.Println("ReallocatedSecurities after calculation:")
-		fmt.Printf("%#v", ReallocatedSecurities)
-		fmt.Println()
-		fmt.Println("SecuritiesAllocated after calculation:")
-		fmt.Printf("%#v", SecuritiesAllocated)
-		fmt.Println()
-		fmt.Println("RQVEligibleValueLeft after calculation:")
-		fmt.Printf("%#v", RQVEligibleValueLeft)
-		fmt.Println()
-		if RQVLeft <= 0 {
-			//-----------------------------------------------------------------------------
-
-			// Flushing securities from both Accounts
-			// remove_securitiesFromAccount
-			function = "remove_securitiesFromAccount"
-
-			invokeArgs := util.ToChaincodeArgs(function, PledgerLongboxAccount)
-			result, err := stub.InvokeChaincode(AccountChainCode, invokeArgs)
-			if err != nil {
-				errStr := fmt.Sprintf("Failed to flush "+PledgerLongboxAccount+" from 'Account' chaincode. Got error: %s", err.Error())
-				fmt.Printf(errStr)
-				return nil, errors.New(errStr)
-			}
-			fmt.Println(result)
-			invokeArgs2 := util.ToChaincodeArgs(function, PledgeeSegregatedAccount)
-			result2, err := stub.InvokeChaincode(AccountChainCode, invokeArgs2)
-			if err != nil {
-				errStr := fmt.Sprintf("Failed to flush "+PledgeeSegregatedAccount+" from 'Account' chaincode. Got error: %s", err.Error())
-				fmt.Printf(errStr)
-				return nil, errors.New(errStr)
-			}
-			fmt.Println(result2)
-			fmt.Println("Securities removed from accounts")
-			//-----------------------------------------------------------------------------
-
-			// Committing the state to Blockchain
-
-			// Function from Account Chaincode for
-			functionAddSecurity := "add_security" // Security Object
-
-			pledgerLongboxSecuritiesJson := `[`
-			// Update the existing Securities for Pledger Longbox A/c
-			for i, valueSecurity := range CombinedSecurities {
-				securityQuantity, err := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
-				if err != nil {
-					errStr := fmt.Sprintf("Failed to convert SecurityQuantity(string) to SecurityQuantity(int). Got error: %s", err.Error())
-					fmt.Printf(errStr)
-				}
-				fmt.Println("securityQuantity: ",securityQuantity)
-				totalValue, err := strconv.ParseFloat(valueSecurity.TotalValue, 64)
-				if err != nil {
-					errStr := fmt.Sprintf("Failed to convert totalValue(string) to totalValue(float). Got error: %s", err.Error())
-					fmt.Printf(errStr)
-				}
-				fmt.Println("totalValue: ",totalValue)
-				quantityAllocated := SecuritiesAllocated[valueSecurity.SecurityId]
-				fmt.Println("quantityAllocated: ",quantityAllocated)
-				totalValueAllocated := TotalValueAllocated[valueSecurity.SecurityId]
-				fmt.Println("totalValueAllocated: ",totalValueAllocated)
-				newQuantity := securityQuantity - quantityAllocated
-				fmt.Println("newQuantity: ",newQuantity)
-				newTotalValue := totalValue - totalValueAllocated
-				fmt.Println("newTotalValue: ",newTotalValue)
-				/*effectiveValueChanged, err := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
-				if err != nil {
-					errStr := fmt.Sprintf("Failed to convert effectiveValueChanged(string) to effectiveValueChanged(float64). Got error: %s", err.Error())
-					fmt.Printf(errStr)
-					return nil, errors.New(errStr)
-				}
-				fmt.Println(effectiveValueChanged)
-				_totalValue := effectiveValueChanged * newQuantity*/
-				valueSecurity.TotalValue = strconv.FormatFloat(newTotalValue, 'f', 2, 64)
-				valueSecurity.SecuritiesQuantity = strconv.FormatFloat(newQuantity, 'f', 2, 64)
-				if newQuantity != 0 {
-					if newQuantity <= securityQuantity && quantityAllocated >= 0 {
-						invokeArgs := util.ToChaincodeArgs(functionAddSecurity, valueSecurity.SecurityId,
-							PledgerLongboxAccount,
-							valueSecurity.SecuritiesName,
-							valueSecurity.SecuritiesQuantity,
-							valueSecurity.SecurityType,
-							valueSecurity.CollateralForm,
-							valueSecurity.TotalValue,
-							valueSecurity.ValuePercentage,
-							valueSecurity.MTM,
-							valueSecurity.EffectivePercentage,
-							valueSecurity.EffectiveValueChanged,
-							valueSecurity.Currency)
-						fmt.Println(valueSecurity)
-						result, err := stub.InvokeChaincode(AccountChainCode, invokeArgs)
-						if err != nil {
-							errStr := fmt.Sprintf("Failed to update Security from 'Account' chaincode. Got error: %s", err.Error())
-							fmt.Printf(errStr)
-							return nil, errors.New(errStr)
-						}
-						fmt.Println(result)
-						sec, err := json.Marshal(valueSecurity)
-						if err != nil {
-							fmt.Println("Error while converting CombinedSecurities struct to string")
-						}
-						pledgerLongboxSecuritiesJson += string(sec)
-						if i < len(CombinedSecurities)-1 {
-							pledgerLongboxSecuritiesJson += `,`
-						}
-					}
-				}
-
-			}
-
-			pledgerLongboxSecuritiesJson += `]`
-			fmt.Println("pledgerLongboxSecuritiesJson:")
-			fmt.Println(pledgerLongboxSecuritiesJson)
-			compliance_status := "Regulatory Compliant"
-			totalValue_Pri := make(map[string]float64)
-			eligibleValue_Pub := make(map[string]float64)
-			fmt.Println("ReallocatedSecurities: ", ReallocatedSecurities)
-			sort.Sort(SecurityArrayStruct(ReallocatedSecurities))
-			fmt.Println("ReallocatedSecurities(sorted): ",ReallocatedSecurities);
-			var totalValueSegregatedAccount float64
-			reallocatedSecuritiesJson := `[`
-			// Update the new Securities to Pledgee Segregated A/c
-			for i, valueSecurity := range ReallocatedSecurities {
-				if valueSecurity.SecuritiesQuantity != "0.00" {
-					invokeArgs := util.ToChaincodeArgs(functionAddSecurity, valueSecurity.SecurityId,
-						PledgeeSegregatedAccount,
-						valueSecurity.SecuritiesName,
-						valueSecurity.SecuritiesQuantity,
-						valueSecurity.SecurityType,
-						valueSecurity.CollateralForm,
-						valueSecurity.TotalValue,
-						valueSecurity.ValuePercentage,
-						valueSecurity.MTM,
-						valueSecurity.EffectivePercentage,
-						valueSecurity.EffectiveValueChanged,
-						valueSecurity.Currency)
-					fmt.Println(valueSecurity)
-					result, err := stub.InvokeChaincode(AccountChainCode, invokeArgs)
-					if err != nil {
-						errStr := fmt.Sprintf("Failed to update Security from 'Account' chaincode. Got error: %s", err.Error())
-						fmt.Printf(errStr)
-						return nil, errors.New(errStr)
-					}
-					fmt.Println(result)
-					sec, err := json.Marshal(valueSecurity)
-					if err != nil {
-						fmt.Println("Error while converting CombinedSecurities struct to string")
-					}
-					reallocatedSecuritiesJson += string(sec)
-					if i < len(ReallocatedSecurities)-1 {
-						reallocatedSecuritiesJson += `,`
-					}
-					
-					//ConcentrationLimit_Pri := rulesetFetched.Security[valueSecurity.CollateralForm]["Concentration Limit"]
-					temp, errBool2 := strconv.ParseFloat(valueSecurity.MTM, 64)
-					if errBool2 != nil {
-						fmt.Println(errBool2)
-					}
-
-					ValuationPercentage_Pub, errBool3 := strconv.ParseFloat(SecurityJSON[valueSecurity.CollateralForm]["Valuation Percentage"], 64)
-					if errBool3 != nil {
-						fmt.Println(errBool3)
-					}
-
-					//ValuationPercentage_Pri := rulesetFetched.Security[valueSecurity.CollateralForm]["Valuation Percentage"]
-					effectiveValueChanged_Pri, errBool4 := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
-					if errBool4 != nil {
-						fmt.Println(errBool4)
-					}
-					totalValuePri, errBool5 := strconv.ParseFloat(valueSecurity.TotalValue, 64)
-					if errBool5 != nil {
-						fmt.Println(errBool5)
-					}
-					exchange_rate := ConversionRate.Rates[valueSecurity.Currency]
-					if valueSecurity.Currency == RQVCurrency {
-						exchange_rate = 1
-					}
-					newMTM :=  temp/exchange_rate
-					fmt.Println("newMTM")
-					fmt.Println(newMTM)
-					// Effective Value =  (MTM(market Value) * valuePercentage)/100
-					effectiveValueChanged_Pub := (newMTM * ValuationPercentage_Pub)/100
-					fmt.Println("effectiveValueChanged_Pub")
-					fmt.Println(effectiveValueChanged_Pub)
-					tmpEffectiveValueChangedPub := strconv.FormatFloat(effectiveValueChanged_Pub, 'f', 2, 64)
-					effectiveValueChangedPub, errBool6 := strconv.ParseFloat(tmpEffectiveValueChangedPub, 64)
-					if errBool6 != nil {
-						fmt.Println(errBool6)
-					}
-					if effectiveValueChangedPub < effectiveValueChanged_Pri{
-						compliance_status = "Regulatory Non-Compliant"
-					}
-					fmt.Println("compliance_status: ",compliance_status)
-					totalValue_Pri[valueSecurity.CollateralForm] += totalValuePri
-					fmt.Println(totalValue_Pri[valueSecurity.CollateralForm])
-					totalValueSegregatedAccount = totalValueSegregatedAccount + totalValuePri
-					fmt.Println("totalValueSegregatedAccount: ",totalValueSegregatedAccount)
-					
-				}
-			}
-			fmt.Println("totalValueSegregatedAccount: ",totalValueSegregatedAccount)
-			for key := range totalValue_Pri{
-				ConcentrationLimit_Pub, errBool1 := strconv.ParseFloat(SecurityJSON[key]["Concentration Limit"], 64)
-				if errBool1 != nil {
-					fmt.Println(errBool1)
-				}
-				eligibleValuePub := (ConcentrationLimit_Pub * totalValueSegregatedAccount)/100
-				fmt.Println("eligibleValuePub: ",eligibleValuePub)
-				eligibleValue_Pub[key] += eligibleValuePub
-				fmt.Println("eligibleValue_Pub["+key+"]: ",eligibleValue_Pub[key])
-				fmt.Println("totalValue_Pri["+key+"]: ",totalValue_Pri[key])
-				if totalValue_Pri[key] > eligibleValue_Pub[key] {
-					compliance_status = "Regulatory Non-Compliant"	
-				}
-				fmt.Println("compliance_status: ",compliance_status)
-			}
-
-			reallocatedSecuritiesJson += `]`
-
-			//-----------------------------------------------------------------------------
-
-			// Update Transaction data finally
-
-			ConversionRateAsBytes, _ := json.Marshal(ConversionRate) //marshal an emtpy array of strings to clear the index
-			ConversionRateAsString := string(ConversionRateAsBytes[:])
-			f := "update_transaction"
-			invoke_args := util.ToChaincodeArgs(f,
-				TransactionData.TransactionId,
-				TransactionData.TransactionDate,
-				TransactionData.DealID,
-				TransactionData.Pledger,
-				TransactionData.Pledgee,
-				TransactionData.RQV,
-				TransactionData.Currency,
-				ConversionRateAsString,
-				TransactionData.MarginCAllDate,
-				"Allocation Successful",
-				TransactionData.TransactionStatus,
-				compliance_status,
-				"0")
-			fmt.Println(TransactionData)
-			res, err := stub.InvokeChaincode(DealChaincode, invoke_args)
-			if err != nil {
-				errStr := fmt.Sprintf("Failed to invoke chaincode. Got error: %s", err.Error())
-				fmt.Printf(errStr)
-				return nil, errors.New(errStr)
-			}
-			fmt.Print("Update transaction returned hash: ")
-			fmt.Println(res)
-			fmt.Println("Successfully updated allocation status to 'Allocation Successful'")
-			
-			
-			reportInJson += `"Pledger Longbox Securities" : ` + pledgerLongboxSecuritiesJson + `,`
-			reportInJson += `"Pledgee Segregated Securities" : ` + reallocatedSecuritiesJson + `,`
-			reportInJson += `"Allocation Date" : ` + MarginCallTimpestamp + `,`
-			reportInJson += `"Allocation Status" : "Allocation Successful"` + `,`
-			reportInJson += `"Compliance Status" : ` + "\""+compliance_status+ "\"" 
-			reportInJson += `}`
-			fmt.Println(reportInJson)
-
-			//Sending Report
-			err = stub.SetEvent("evtsender", []byte(reportInJson))
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			_RQVLeft := strconv.FormatFloat(RQVLeft, 'f', 2, 64)
-			f := "update_transaction"
-			invoke_args := util.ToChaincodeArgs(f, TransactionData.TransactionId, TransactionData.TransactionDate, TransactionData.DealID, TransactionData.Pledger, TransactionData.Pledgee, TransactionData.RQV, TransactionData.Currency, "\" \"", TransactionData.MarginCAllDate, "Pending due to insufficient collateral", TransactionData.TransactionStatus,TransactionData.ComplianceStatus,_RQVLeft)
-			fmt.Println(TransactionData)
-			result, err := stub.InvokeChaincode(DealChaincode, invoke_args)
-			if err != nil {
-				errStr := fmt.Sprintf("Failed to invoke chaincode. Got error: %s", err.Error())
-				fmt.Printf(errStr)
-				return nil, errors.New(errStr)
-			}
-			fmt.Print("Update transaction returned : ")
-			fmt.Println(result)
-			fmt.Println("Successfully updated allocation status to 'Pending' due to insufficient collateral'")
-			//Send a event to event handler
-			tosend := "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"Transaction Allocation updated succcessfully with status 'Pending' due to insufficient collateral.\", \"code\" : \"200\",\"RQVLeft\" : \"" + _RQVLeft + "\"}"
-			err = stub.SetEvent("evtsender", []byte(tosend))
-			if err != nil {
-				return nil, err
-			}
-		}
-		return nil, nil
-	}
-
-	fmt.Println("end start_allocation")
-	return nil, nil
-}
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/mukutb/TCM-new/amount"
+	"math"
+	//"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ManageAllocations struct {
+}
+
+type Transactions struct {
+	TransactionId          string `json:"transactionId"`
+	TransactionDate        string `json:"transactionDate"`
+	DealID                 string `json:"dealId"`
+	Pledger                string `json:"pledger"`
+	Pledgee                string `json:"pledgee"`
+	RQV                    string `json:"rqv"`
+	Currency               string `json:"currency"`
+	CurrencyConversionRate string `json:"currencyConversionRate"`
+	MarginCAllDate         string `json:"marginCAllDate"`
+	AllocationStatus       string `json:"allocationStatus"`
+	TransactionStatus      string `json:"transactionStatus"`
+	ComplianceStatus      string `json:"complianceStatus"`
+	ShortFall      string `json:"shortFall"`
+	CallAmount     string `json:"callAmount"` // RQV on the deal's CSA terms, blank on transactions from before CSA terms
+}
+
+type Deals struct { // Attributes of a Allocation
+	DealID                       string `json:"dealId"`
+	Pledger                      string `json:"pledger"`
+	Pledgee                      string `json:"pledgee"`
+	MaxValue                     string `json:"maxValue"` //Maximum Value of all the securities of each Collateral Form
+	TotalValueLongBoxAccount     string `json:"totalValueLongBoxAccount"`
+	TotalValueSegregatedAccount  string `json:"totalValueSegregatedAccount"`
+	IssueDate                    string `json:"issueDate"`
+	LastSuccessfulAllocationDate string `json:"lastSuccessfulAllocationDate"`
+	Transactions                 string `json:"transactions"`
+	AllocationStrategy           string `json:"allocationStrategy"` //Name of the strategy start_allocation uses, see AllocationStrategies
+	SubstitutionApproval         string `json:"substitutionApproval"` //"Required" when the pledgee has to approve substitutions
+	Substitutions                string `json:"substitutions"`
+	LongboxAccount               string `json:"longboxAccount"` //Accounts start_allocation last allocated between
+	SegregatedAccount            string `json:"segregatedAccount"`
+	MinimumTransferAmount        string `json:"minimumTransferAmount"`
+	Threshold                    string `json:"threshold"`
+	MarginCallConfirmation       string `json:"marginCallConfirmation"`
+	Rounding                     string `json:"rounding"`
+	IndependentAmount            string `json:"independentAmount"`
+	EligibleCurrency             string `json:"eligibleCurrency"`
+}
+
+type Accounts struct {
+	AccountID     string `json:"accountId"`
+	AccountName   string `json:"accountName"`
+	AccountNumber string `json:"accountNumber"`
+	AccountType   string `json:"accountType"`
+	TotalValue    string `json:"totalValue"`
+	Currency      string `json:"currency"`
+	Pledger       string `json:"pledger"`
+	Securities    string `json:"securities"`
+}
+
+type Securities struct {
+	SecurityId          string `json:"Security ID"`
+	AccountNumber       string `json:"Account Number"`
+	SecuritiesName      string `json:"Security Name"`
+	SecuritiesQuantity  string `json:"Quantity"`
+	SecurityType        string `json:"Security Type"`
+	CollateralForm      string `json:"Collateral Form"`
+	TotalValue          string `json:"Total Value"`
+	ValuePercentage     string `json:"Valuation Percentage"`
+	MTM                 string `json:"Market Price"`
+	EffectivePercentage string `json:"Effective Value"`
+	EffectiveValueChanged string `json:"Effective Value Changed"`
+	Currency            string `json:"Currency"`
+	Issuer              string `json:"Issuer"`
+	MaturityDate        string `json:"Maturity Date"`
+	Rating              string `json:"Rating"`
+	HaircutCell         string `json:"Haircut Cell,omitempty"` // grid cell the Valuation Percentage was taken from, not stored on the Account
+	FXHaircut           string `json:"FX Haircut,omitempty"`   // FX mismatch haircut in the Valuation Percentage, not stored on the Account
+}
+
+// Use as Object.Security["CommonStocks"][0]
+// Reference [Tested by Pranav] https://play.golang.org/p/JlQJF5Z14X
+type Ruleset struct {
+	Security         map[string]map[string]float64 `json:"Security"`
+	BaseCurrency     string               `json:"BaseCurrency"`
+	EligibleCurrency []string             `json:"EligibleCurrency"`
+	IssuerLimit      map[string]float64   `json:"IssuerLimit"`      // percent of RQV per issuer, "Default" for issuers not listed
+	IssuerGroup      map[string]string    `json:"IssuerGroup"`      // issuer -> issuer group
+	IssuerGroupLimit map[string]float64   `json:"IssuerGroupLimit"` // percent of RQV per issuer group
+	HaircutSchedule  map[string][]HaircutCell `json:"HaircutSchedule"` // collateral form -> haircut grid, best rating band first
+	MinimumRating    map[string]string    `json:"MinimumRating"`    // collateral form -> worst rating accepted, of all the agencies rating a security
+	FXMismatchHaircut *float64            `json:"FXMismatchHaircut"` // valuation percentage points off securities not in the RQV currency, DefaultFXMismatchHaircut when not set
+}
+var AllocationAdminStr = "_AllocationAdmin" //name for the key/value that will store who may change the FX and market data settings
+
+// Attribute of the caller's transaction certificate that identifies them
+var CallerAttribute = "enrollmentId"
+
+// Used for Security Array Sort
+// Reference at https://play.golang.org/p/Rz9NCEVhGu
+type SecurityArrayStruct []Securities 
+
+// Securities in the order of the "Priority" the ruleset gives their collateral form
+type SecurityPriority struct {
+	SecurityArrayStruct
+	Ruleset Ruleset
+}
+
+// by_priority - sort.Interface over the securities by Priority, richest security first within a priority
+func by_priority(securities []Securities, Ruleset Ruleset) SecurityPriority {
+	return SecurityPriority{SecurityArrayStruct(securities), Ruleset}
+}
+
+func (slice SecurityArrayStruct) Len() int             { return len(slice) }
+func (sorted SecurityPriority) Less(i, j int) bool { // Sorting through the field 'Priority'
+	slice := sorted.SecurityArrayStruct
+	tempEffectiveValueChanged1, errBool := strconv.ParseFloat(slice[i].EffectiveValueChanged, 64)
+	if errBool != nil {
+		fmt.Println(errBool)
+	}
+	tempEffectiveValueChanged2, errBool := strconv.ParseFloat(slice[j].EffectiveValueChanged, 64)
+	if errBool != nil {
+		fmt.Println(errBool)
+	}
+	if sorted.Ruleset.Security[slice[i].CollateralForm]["Priority"] < sorted.Ruleset.Security[slice[j].CollateralForm]["Priority"]{
+		return true
+	}else if sorted.Ruleset.Security[slice[i].CollateralForm]["Priority"] == sorted.Ruleset.Security[slice[j].CollateralForm]["Priority"]{
+		if tempEffectiveValueChanged1 > tempEffectiveValueChanged2 {
+			return true	
+		}
+	}
+	return false
+}
+func (slice SecurityArrayStruct) Swap(i, j int) { slice[i], slice[j] = slice[j], slice[i] }
+
+
+// Use as Object.Rates["EUR"]
+// Reference [Tested by Pranav] https://play.golang.org/p/j5Act-jN5C
+type CurrencyConversion struct {
+	Base         string             `json:"Base Currency"`
+	Date         string             `json:"Date"`
+	Rates        map[string]float64 `json:"Exchange Rates"`
+	Provider     string             `json:"Provider,omitempty"`       // FX provider the rates came from
+	Pivot        string             `json:"Pivot Currency,omitempty"` // currency cross rates were triangulated through
+	Triangulated []string           `json:"Triangulated,omitempty"`   // currencies whose rate is a cross rate
+}
+
+// One line of securities changing hands between the longbox and segregated accounts
+type SecurityMovement struct {
+	SecurityId string `json:"Security ID"`
+	From       string `json:"From Account"`
+	To         string `json:"To Account"`
+	Quantity   string `json:"Quantity"`
+}
+
+// What return_excess_collateral gives back to the pledger
+type ReturnResult struct {
+	ReturnedSecurities  []Securities // lines going back to the longbox
+	RemainingSecurities []Securities // what the segregated account keeps
+	CollateralValue     amount.Amount // value counted towards the RQV before the return
+	Excess              amount.Amount // CollateralValue over the RQV
+	ValueReturned       amount.Amount
+}
+
+// Everything start_allocation works out before it writes to the ledger
+type AllocationPlan struct {
+	DealData             Deals
+	TransactionData      Transactions
+	Report               string // report JSON so far, closed off by allocation_report
+	MarginCallTimestamp  string
+	RQV                  amount.Amount
+	ConversionRate       CurrencyConversion
+	PublicRuleset        map[string]map[string]string // public rule set in force at the margin call
+	Ruleset              Ruleset                      // private ruleset in force at the margin call
+	Affiliated           Affiliations                 // issuers affiliated with the pledger
+	RQVEligibleValue     map[string]amount.Amount // concentration limit per collateral form, issuer and issuer group in RQV currency
+	AvailableEligible    map[string]float64 // min(available, eligible) per collateral form
+	Allocation           AllocationResult
+	LongboxSecurities    []Securities // longbox holdings after the allocation
+	SegregatedSecurities []Securities // segregated holdings after the allocation
+	Movements            []SecurityMovement
+	ComplianceStatus     string
+	MarketDataIssues     []MarketDataIssue // why the allocation is blocked, before anything was moved
+	CurrencyExclusions   []string          // securities left out or sent back as their currency is not eligible
+	HaircutExclusions    []string          // securities left out or sent back as no cell of their haircut grid fits them
+}
+
+// To be used as SecurityJSON["CommonStocks"]["Priority"] ==> 1
+// Public rule set in force until the first amendment is approved on the ledger, see fetch_public_ruleset
+var SecurityJSON = map[string]map[string]string{
+	"Govt Securities":       map[string]string{"Concentration Limit": "50", "Priority": "1", "Valuation Percentage": "95"},
+	"Govt Securities - Non EU":      map[string]string{"Concentration Limit": "10", "Priority": "2", "Valuation Percentage": "93"},
+	"Municipal Securities":      map[string]string{"Concentration Limit": "50", "Priority": "3", "Valuation Percentage": "91"},
+	"Municipal Securities - Non EU":      map[string]string{"Concentration Limit": "10", "Priority": "4", "Valuation Percentage": "89"},
+	"Corporate Bonds":       map[string]string{"Concentration Limit": "10", "Priority": "5", "Valuation Percentage": "88"},
+	"Equities":         map[string]string{"Concentration Limit": "10", "Priority": "6", "Valuation Percentage": "85"},
+	"Medium Term Notes":       map[string]string{"Concentration Limit": "10", "Priority": "7", "Valuation Percentage": "83"}}
+// ============================================================================================================================
+// Main - start the chaincode for Allocation management
+// ============================================================================================================================
+func main() {
+	err := shim.Start(new(ManageAllocations))
+	if err != nil {
+		fmt.Printf("Error starting Allocation management chaincode: %s", err)
+	}
+}
+
+// ============================================================================================================================
+// Init - reset all the things
+// ============================================================================================================================
+func (t *ManageAllocations) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	var msg string
+	var err error
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting the administrator as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Initialize the chaincode
+	msg = args[0]
+	// Write the state to the ledger
+	err = stub.PutState("abc", []byte(msg)) //making a test var "abc", I find it handy to read/write to it right away to test the network
+	if err != nil {
+		return nil, err
+	}
+	var empty []string
+	jsonAsBytes, _ := json.Marshal(empty) //marshal an emtpy array of strings to clear the index
+	err = stub.PutState("_init", jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(AllocationReportIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	// A reset keeps the administrator set at deployment, nobody can take it over by invoking init
+	adminAsBytes, err := stub.GetState(AllocationAdminStr)
+	if err != nil {
+		return nil, errors.New("Failed to get allocation administrator")
+	}
+	if len(adminAsBytes) == 0 {
+		err = stub.PutState(AllocationAdminStr, []byte(strings.TrimSpace(args[0])))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tosend := "{ \"message\" : \"ManageAllocations chaincode is deployed successfully.\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// caller_id - the party invoking, as named by their transaction certificate, empty when it can't be read
+func caller_id(stub shim.ChaincodeStubInterface) string {
+	callerAsBytes, err := stub.ReadCertAttribute(CallerAttribute)
+	if err != nil {
+		fmt.Println("Failed to read " + CallerAttribute + " of the caller: " + err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(callerAsBytes))
+}
+
+// caller_is_admin - whether the certificate of the transaction's caller names the allocation administrator
+func caller_is_admin(stub shim.ChaincodeStubInterface) (bool, error) {
+	adminAsBytes, err := stub.GetState(AllocationAdminStr)
+	if err != nil {
+		return false, errors.New("Failed to get allocation administrator")
+	}
+	_caller := caller_id(stub)
+	return _caller != "" && _caller == string(adminAsBytes), nil
+}
+
+// ============================================================================================================================
+// Run - Our entry Dealint for Invocations - [LEGACY] obc-peer 4/25/2016
+// ============================================================================================================================
+func (t *ManageAllocations) Run(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("run is running " + function)
+	return t.Invoke(stub, function, args)
+}
+
+// ============================================================================================================================
+// Invoke - Our entry Dealint for Invocations
+// ============================================================================================================================
+func (t *ManageAllocations) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "init" { // Initialize the chaincode state, used as reset
+		return t.Init(stub, "init", args)
+	} else if function == "start_allocation" { // Create a new Allocation
+		return t.start_allocation(stub, args)
+	} else if function == "LongboxAccountUpdated" { // Secondary Fire when Longbox account is updated
+		return t.LongboxAccountUpdated(stub, args)
+	} else if function == "return_excess_collateral" { // Give collateral over the RQV back to the pledger
+		return t.return_excess_collateral(stub, args)
+	} else if function == "substitute_collateral" { // Swap securities in the segregated account for others from the longbox
+		return t.substitute_collateral(stub, args)
+	} else if function == "revalue_all" { // Mark every deal's holdings to market
+		return t.revalue_all(stub, args)
+	} else if function == "set_fx_provider" { // Choose where exchange rates come from
+		return t.set_fx_provider(stub, args)
+	} else if function == "publish_fx_rates" { // Publish exchange rates to the Ledger FX provider
+		return t.publish_fx_rates(stub, args)
+	} else if function == "rating_changed" { // Substitute a downgraded security wherever it is held
+		return t.rating_changed(stub, args)
+	} else if function == "undo_allocation" { // Reverse a successful allocation from its stored report
+		return t.undo_allocation(stub, args)
+	} else if function == "set_market_data_policy" { // How old a price an allocation may use can be
+		return t.set_market_data_policy(stub, args)
+	}
+	fmt.Println("invoke did not find func: " + function)
+	errMsg := "{ \"message\" : \"Received unknown function invocation\", \"code\" : \"503\"}"
+	err := stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Query - Our entry Dealint for Queries
+// ============================================================================================================================
+
+func (t *ManageAllocations) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("query is running " + function)
+
+	// Handle different functions
+	if function == "simulate_allocation" { // Dry run of start_allocation
+		return t.simulate_allocation(stub, args)
+	} else if function == "getAllocationReport_byTransaction" { // Stored report of an allocation
+		return t.getAllocationReport_byTransaction(stub, args)
+	} else if function == "getAllocationReportHistory_byTransaction" { // Every stored report of a transaction's allocations
+		return t.getAllocationReportHistory_byTransaction(stub, args)
+	} else if function == "getAllocationReports_byDeal" { // Stored reports of a deal's allocations
+		return t.getAllocationReports_byDeal(stub, args)
+	} else if function == "getAllocationReports_byDateRange" { // Stored reports of allocations between two dates
+		return t.getAllocationReports_byDateRange(stub, args)
+	} else if function == "getFXProvider" { // FX provider settings in use
+		return t.getFXProvider(stub, args)
+	} else if function == "getMarketDataPolicy" { // Market data policy in use
+		return t.getMarketDataPolicy(stub, args)
+	}
+	fmt.Println("query did not find func: " + function) //errors
+	errMsg := "{ \"message\" : \"Received unknown function query\", \"code\" : \"503\"}"
+	err := stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// A used updated his :LongBox Account - create a new Allocation, store into chaincode state
+// Pending margin calls become ready for allocation when the update is made before their deal's cutoff on a business day
+// With AccountChainCode and PriceChaincode the pledger's ready margin calls are also re-allocated straight away, oldest first
+// Arguments : DealChaincode, AccountName, Role[, AccountChainCode, PriceChaincode]
+// ============================================================================================================================
+func (t *ManageAllocations) LongboxAccountUpdated(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+
+	var err error
+	if len(args) != 3 && len(args) != 5 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 3, or 5 to re-allocate\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start LongboxAccountUpdated")
+
+	_DealChaincode := args[0]
+	_AccountName := args[1]
+	_Role := args[2]
+	_Reallocate := len(args) == 5
+	if _Reallocate && _Role != "Pledger" {
+		errMsg := "{ \"message\" : \"Only a pledger's longbox update can re-allocate margin calls\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	fmt.Println("args: ", args)
+	var TransactionsDataFetched []Transactions
+
+	// Fetching Attl transactions for the user
+	function := "getTransactions_byUser"
+	QueryArgs := util.ToChaincodeArgs(function, _AccountName, _Role)
+	result, err := stub.QueryChaincode(_DealChaincode, QueryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Error in fetching Transactions from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	json.Unmarshal(result, &TransactionsDataFetched)
+
+	// The cutoff is judged on the time the transaction was submitted, not on a time the caller supplies
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return nil, errors.New("Failed to get transaction timestamp")
+	}
+	var newAllStatus string
+	var ReadyTransactions []Transactions
+
+	for _, ValueTransaction := range TransactionsDataFetched {
+
+		if ValueTransaction.AllocationStatus == "Pending due to insufficient collateral" {
+
+			QueryArgs = util.ToChaincodeArgs("getCutoff_byDeal", ValueTransaction.DealID)
+			cutoffAsBytes, err := stub.QueryChaincode(_DealChaincode, QueryArgs)
+			if err != nil {
+				errStr := fmt.Sprintf("Failed to fetch cutoff of "+ValueTransaction.DealID+" from 'Deal' chaincode. Got error: %s", err.Error())
+				fmt.Printf(errStr)
+				return nil, errors.New(errStr)
+			}
+			Cutoff := Cutoffs{}
+			json.Unmarshal(cutoffAsBytes, &Cutoff)
+			inCutoff, localTime, errMsg := within_cutoff(Cutoff, txTimestamp.Seconds)
+			if errMsg != "" {
+				errMsg = "{ \"transactionId\" : \"" + ValueTransaction.TransactionId + "\", \"message\" : \"" + errMsg + "\", \"code\" : \"503\"}"
+				err = stub.SetEvent("errEvent", []byte(errMsg))
+				if err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+
+			if inCutoff {
+				// New securites are uploaded in cutoff time
+				newAllStatus = "Ready for Allocation"
+			} else {
+				// New securities not uploaded in cutoff time
+				newAllStatus = "Allocation Failed"
+			}
+
+			// Update allocation status of a transaction
+			function = "update_transaction"
+			invokeArgs := util.ToChaincodeArgs(function,
+				ValueTransaction.TransactionId,
+				ValueTransaction.TransactionDate,
+				ValueTransaction.DealID,
+				ValueTransaction.Pledger,
+				ValueTransaction.Pledgee,
+				ValueTransaction.RQV,
+				ValueTransaction.Currency,
+				json_string(ValueTransaction.CurrencyConversionRate),
+				ValueTransaction.MarginCAllDate,
+				newAllStatus,
+				ValueTransaction.TransactionStatus,
+				ValueTransaction.ComplianceStatus,
+				ValueTransaction.ShortFall)
+			fmt.Println(ValueTransaction)
+			result, err := stub.InvokeChaincode(_DealChaincode, invokeArgs)
+			if err != nil {
+				errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
+				fmt.Printf(errStr)
+				return nil, errors.New(errStr)
+			}
+			fmt.Println("Transaction hash returned: ", result)
+			fmt.Println(ValueTransaction.TransactionId + " updated with AllocationStatus as " + newAllStatus)
+			if newAllStatus == "Ready for Allocation" {
+				ReadyTransactions = append(ReadyTransactions, ValueTransaction)
+			}
+
+			//Sending event call
+			tosend := "{ \"transactionId\" : \"" + ValueTransaction.TransactionId + "\", \"Cutoff\" : \"" + cutoff_string(Cutoff) + "\", \"Cutoff Scope\" : \"" + Cutoff.Scope + "\", \"Local Time\" : \"" + localTime + "\", \"message\" : \"Transaction updated succcessfully with Allocation Status as " + newAllStatus + " \", \"code\" : \"200\"}"
+			err = stub.SetEvent("evtsender", []byte(tosend))
+			if err != nil {
+				return nil, err
+			}
+		} else if ValueTransaction.TransactionStatus == "Ready for Allocation" {
+			//Sending event call
+			tosend := "{ \"transactionId\" : \"" + ValueTransaction.TransactionId + "\", \"message\" : \"Transaction updated succcessfully with Allocation Status as 'Ready for Allocation' \", \"code\" : \"200\"}"
+			err = stub.SetEvent("evtsender", []byte(tosend))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _Reallocate && len(ReadyTransactions) > 0 {
+		Summary, err := reallocate_pending(stub, _DealChaincode, args[3], args[4], ReadyTransactions, strconv.FormatInt(txTimestamp.Seconds, 10))
+		if err != nil {
+			return nil, err
+		}
+		tosend := "{ \"pledger\" : \"" + _AccountName + "\", \"Reallocation\" : " + Summary + ", \"message\" : \"Pending margin calls re-allocated succcessfully\", \"code\" : \"200\"}"
+		fmt.Println(tosend)
+		err = stub.SetEvent("evtsender", []byte(tosend))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("end LongboxAccountUpdated")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Start Allocation - create a new Allocation, store into chaincode state
+// ============================================================================================================================
+func (t *ManageAllocations) start_allocation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 8 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 8\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start start_allocation")
+
+	Plan, errMsg, err := allocate(stub, args)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if Plan.Allocation.RQVLeft.Sign() > 0 {
+		_RQVLeft := Plan.Allocation.RQVLeft.String()
+		//Send a event to event handler
+		tosend := "{ \"transactionId\" : \"" + Plan.TransactionData.TransactionId + "\", \"message\" : \"Transaction Allocation updated succcessfully with status 'Pending' due to insufficient collateral.\", \"code\" : \"200\",\"RQVLeft\" : \"" + _RQVLeft + "\"}"
+		err = stub.SetEvent("evtsender", []byte(tosend))
+		if err != nil {
+			return nil, err
+		}
+		// Actual return of process end.
+		return nil, nil
+	}
+
+	//Sending Report
+	err = stub.SetEvent("evtsender", []byte(allocation_report(Plan, "Allocation Successful", false)))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("end start_allocation")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// allocate - carry out an allocation for start_allocation's arguments and store its report, without raising events
+// A plan left with RQV to cover leaves the transaction pending and moves nothing
+// Returns the errEvent message to raise when the allocation cannot go ahead
+// ============================================================================================================================
+func allocate(stub shim.ChaincodeStubInterface, args []string) (AllocationPlan, string, error) {
+	// Alloting Params
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	TransactionID := args[4]
+	PledgerLongboxAccount := args[5]
+	PledgeeSegregatedAccount := args[6]
+
+	// Work out the allocation first, nothing below this point is read from outside the ledger
+	Plan, errMsg, err := build_allocation_plan(stub, args)
+	if err == nil && len(Plan.MarketDataIssues) > 0 {
+		// Leave the margin call blocked rather than allocate on prices or rates that cannot be relied on
+		invokeArgs := util.ToChaincodeArgs("update_transaction_AllocationStatus", TransactionID, MarketDataBlockedStatus)
+		_, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return Plan, "", errors.New(errStr)
+		}
+		fmt.Println("Allocation status updated to '" + MarketDataBlockedStatus + "'")
+	}
+	if err != nil || errMsg != "" {
+		return Plan, errMsg, err
+	}
+	TransactionData := Plan.TransactionData
+
+	//-----------------------------------------------------------------------------
+
+	// Update allocation status to "Allocation in progress"
+	function := "update_transaction_AllocationStatus"
+	invokeArgs := util.ToChaincodeArgs(function, TransactionID, "Allocation in progress")
+	result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Plan, "", errors.New(errStr)
+	}
+	fmt.Print("Transaction hash returned: ")
+	fmt.Println(result)
+	fmt.Println("Successfully updated allocation status to 'Allocation in progress'")
+
+	// The first allocation records on the deal which accounts hold its collateral
+	if Plan.DealData.LongboxAccount == "" && Plan.DealData.SegregatedAccount == "" {
+		invokeArgs = util.ToChaincodeArgs("link_accounts", Plan.DealData.DealID, PledgerLongboxAccount, PledgeeSegregatedAccount)
+		result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to link accounts to Deal from 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return Plan, "", errors.New(errStr)
+		}
+		fmt.Println(result)
+	}
+
+	//-----------------------------------------------------------------------------
+
+	if Plan.Allocation.RQVLeft.Sign() > 0 {
+		_RQVLeft := Plan.Allocation.RQVLeft.String()
+		// Update transaction's allocation status to "Pending due to insufficient collateral" and transaction status to "Pending"
+		f := "update_transaction"
+		invoke_args := util.ToChaincodeArgs(f, TransactionData.TransactionId, TransactionData.TransactionDate, TransactionData.DealID, TransactionData.Pledger, TransactionData.Pledgee, TransactionData.RQV, TransactionData.Currency, rates_snapshot(Plan.ConversionRate), TransactionData.MarginCAllDate, "Pending due to insufficient collateral", TransactionData.TransactionStatus, TransactionData.ComplianceStatus, _RQVLeft)
+		fmt.Println(TransactionData)
+		result, err := stub.InvokeChaincode(DealChaincode, invoke_args)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to invoke chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return Plan, "", errors.New(errStr)
+		}
+		fmt.Print("Update transaction returned : ")
+		fmt.Println(result)
+		fmt.Println("Successfully updated allocation status to 'Pending' due to insufficient collateral'")
+		// Keep the report of the attempt on the ledger, nothing was moved
+		err = store_allocation_report(stub, TransactionID, allocation_report(Plan, "Pending due to insufficient collateral", false))
+		return Plan, "", err
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Move the securities between the two accounts, one transfer per direction
+	function = "transfer_securities"
+	for _, Direction := range [][]string{{PledgerLongboxAccount, PledgeeSegregatedAccount}, {PledgeeSegregatedAccount, PledgerLongboxAccount}} {
+		transferArgs := []string{function, Direction[0], Direction[1]}
+		for _, valueMovement := range Plan.Movements {
+			if valueMovement.From == Direction[0] {
+				transferArgs = append(transferArgs, valueMovement.SecurityId, valueMovement.Quantity)
+			}
+		}
+		if len(transferArgs) == 3 {
+			continue
+		}
+		invokeArgs = util.ToChaincodeArgs(transferArgs...)
+		result, err = stub.InvokeChaincode(AccountChainCode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to transfer securities from "+Direction[0]+" to "+Direction[1]+" in 'Account' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return Plan, "", errors.New(errStr)
+		}
+		fmt.Println(result)
+	}
+	fmt.Println("Securities transferred between accounts")
+
+	// The transfer moves the holdings at the value they were stored at, store what this allocation priced them at
+	for _, Holdings := range []struct {
+		Account    string
+		Securities []Securities
+	}{{PledgerLongboxAccount, Plan.LongboxSecurities}, {PledgeeSegregatedAccount, Plan.SegregatedSecurities}} {
+		err = store_valuations(stub, AccountChainCode, Holdings.Account, Holdings.Securities)
+		if err != nil {
+			return Plan, "", err
+		}
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// The deal's segregated total is what the next margin call's CSA minimum transfer amount is measured against
+	SegregatedValue, err := total_value(Plan.SegregatedSecurities, TransactionData.Currency)
+	if err != nil {
+		return Plan, "", err
+	}
+	invokeArgs = util.ToChaincodeArgs("set_account_values",
+		Plan.DealData.DealID,
+		Plan.DealData.TotalValueLongBoxAccount,
+		SegregatedValue.String())
+	result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update Deal from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Plan, "", errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	//-----------------------------------------------------------------------------
+
+	// Update Transaction data finally
+
+	f := "update_transaction"
+	invoke_args := util.ToChaincodeArgs(f,
+		TransactionData.TransactionId,
+		TransactionData.TransactionDate,
+		TransactionData.DealID,
+		TransactionData.Pledger,
+		TransactionData.Pledgee,
+		TransactionData.RQV,
+		TransactionData.Currency,
+		rates_snapshot(Plan.ConversionRate),
+		TransactionData.MarginCAllDate,
+		"Allocation Successful",
+		TransactionData.TransactionStatus,
+		Plan.ComplianceStatus,
+		"0")
+	fmt.Println(TransactionData)
+	res, err := stub.InvokeChaincode(DealChaincode, invoke_args)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to invoke chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Plan, "", errors.New(errStr)
+	}
+	fmt.Print("Update transaction returned hash: ")
+	fmt.Println(res)
+	fmt.Println("Successfully updated allocation status to 'Allocation Successful'")
+
+	reportInJson := allocation_report(Plan, "Allocation Successful", false)
+	fmt.Println(reportInJson)
+
+	// Keep the report on the ledger, the event alone is lost if nobody is listening
+	err = store_allocation_report(stub, TransactionID, reportInJson)
+	return Plan, "", err
+}
+
+// ============================================================================================================================
+// Simulate Allocation - dry run of start_allocation. Same arguments, returns the report without writing anything
+// ============================================================================================================================
+func (t *ManageAllocations) simulate_allocation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 8 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 8\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start simulate_allocation")
+
+	Plan, errMsg, err := build_allocation_plan(stub, args)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// Status the transaction would be left in by start_allocation
+	AllocationStatus := "Allocation Successful"
+	if Plan.Allocation.RQVLeft.Sign() > 0 {
+		AllocationStatus = "Pending due to insufficient collateral"
+	}
+	reportInJson := allocation_report(Plan, AllocationStatus, true)
+	fmt.Println(reportInJson)
+
+	fmt.Println("end simulate_allocation")
+	return []byte(reportInJson), nil
+}
+
+// ============================================================================================================================
+// Return Excess Collateral - give back what the segregated account holds over the current RQV to the pledger's longbox
+// ============================================================================================================================
+func (t *ManageAllocations) return_excess_collateral(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 8 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 8\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start return_excess_collateral")
+
+	// Alloting Params
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	PriceChaincode := args[2]
+	DealID := args[3]
+	TransactionID := args[4]
+	PledgerLongboxAccount := args[5]
+	PledgeeSegregatedAccount := args[6]
+	ReturnTimestamp := args[7]
+
+	// Fetch Deal details from Blockchain
+	queryArgs := util.ToChaincodeArgs("getDeal_byID", DealID)
+	dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	DealData := Deals{}
+	json.Unmarshal(dealAsBytes, &DealData)
+	if DealData.DealID != DealID {
+		errMsg := "{ \"message\" : \"" + DealID + " Not Found.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Collateral only goes back from the segregated account of the deal to its own longbox account
+	if PledgerLongboxAccount != DealData.LongboxAccount || PledgeeSegregatedAccount != DealData.SegregatedAccount {
+		errMsg := "{ \"message\" : \"" + PledgerLongboxAccount + " and " + PledgeeSegregatedAccount + " are not the accounts recorded on " + DealID + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// The transaction carrying the current RQV
+	queryArgs = util.ToChaincodeArgs("getTransaction_byID", TransactionID)
+	transactionAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	TransactionData := Transactions{}
+	json.Unmarshal(transactionAsBytes, &TransactionData)
+	if TransactionData.TransactionId != TransactionID {
+		errMsg := "{ \"message\" : \"" + TransactionID + " Not Found.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Only the deal's own latest allocated transaction says what has to stay, not a return or an older call with a smaller RQV
+	CoveringTransaction, err := covering_transaction(stub, DealChaincode, DealID)
+	if err != nil {
+		return nil, err
+	}
+	if TransactionData.DealID != DealID || TransactionData.TransactionId != CoveringTransaction.TransactionId {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + TransactionID + " is not the transaction covering " + DealID + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// What the segregated account has to keep covering, the RQV on the deal's CSA terms
+	RQV, err := call_amount(TransactionData)
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	RQVCurrency := TransactionData.Currency
+	fmt.Println("RQV : ", RQV)
+
+	//-----------------------------------------------------------------------------
+
+	PublicRuleset, PublicRulesetVersion, err := fetch_public_ruleset(stub, DealChaincode, ReturnTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	Ruleset, _, errMsg, err := fetch_ruleset(stub, DealChaincode, DealData.Pledger, DealData.Pledgee, ReturnTimestamp, PublicRuleset)
+	if err != nil {
+		return nil, err
+	}
+	Affiliated, err := fetch_affiliations(stub, DealChaincode, DealData.Pledger)
+	if err != nil {
+		return nil, err
+	}
+	var ConversionRate CurrencyConversion
+	if errMsg == "" {
+		ConversionRate, errMsg, err = fetch_conversion_rates(stub, RQVCurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Revalue what the pledgee holds
+	queryArgs = util.ToChaincodeArgs("getSecurities_byAccount", PledgeeSegregatedAccount)
+	SegregatedSecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch securities of "+PledgeeSegregatedAccount+" from 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	var SegregatedSecuritiesJSON, SegregatedSecurities []Securities
+	json.Unmarshal(SegregatedSecuritiesString, &SegregatedSecuritiesJSON)
+	for _, tempSecurity := range SegregatedSecuritiesJSON {
+		if len(Ruleset.Security[tempSecurity.CollateralForm]) > 0 {
+			var Eligible bool
+			tempSecurity, Eligible, errMsg, err = value_security(stub, PriceChaincode, tempSecurity, ConversionRate, RQVCurrency, ReturnTimestamp, Ruleset)
+			if err != nil {
+				return nil, err
+			}
+			if errMsg != "" {
+				err = stub.SetEvent("errEvent", []byte(errMsg))
+				if err != nil {
+					return nil, err
+				}
+				return nil, nil
+			}
+			if !Eligible {
+				// No cell of its haircut grid fits it, it counts for nothing towards the RQV
+				fmt.Println(haircut_reason(tempSecurity))
+			}
+		} else {
+			// Not eligible under the ruleset, it counts for nothing towards the RQV
+			tempSecurity.EffectiveValueChanged = "0.00"
+			tempSecurity.TotalValue = "0.00"
+		}
+		SegregatedSecurities = append(SegregatedSecurities, tempSecurity)
+	}
+
+	err = check_figures(SegregatedSecurities)
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	var ReturnData ReturnResult
+	RQVEligibleValue, err := concentration_limits(RQV, Ruleset.Security)
+	if err == nil {
+		ReturnData, err = excess_collateral(SegregatedSecurities, RQV, RQVEligibleValue, Ruleset)
+	}
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("Collateral value: ", ReturnData.CollateralValue)
+	fmt.Println("Excess collateral: ", ReturnData.Excess)
+
+	if len(ReturnData.ReturnedSecurities) == 0 {
+		Excess := ReturnData.Excess
+		if Excess.Sign() < 0 {
+			Excess = amount.Zero(Excess.Currency)
+		}
+		tosend := "{ \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"No excess collateral to return.\", \"code\" : \"200\", \"Excess Collateral\" : \"" + Excess.String() + "\"}"
+		err = stub.SetEvent("evtsender", []byte(tosend))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Move the excess back in one transfer
+	var Movements []SecurityMovement
+	transferArgs := []string{"transfer_securities", PledgeeSegregatedAccount, PledgerLongboxAccount}
+	for _, valueSecurity := range ReturnData.ReturnedSecurities {
+		Movements = append(Movements, SecurityMovement{valueSecurity.SecurityId, PledgeeSegregatedAccount, PledgerLongboxAccount, valueSecurity.SecuritiesQuantity})
+		transferArgs = append(transferArgs, valueSecurity.SecurityId, valueSecurity.SecuritiesQuantity)
+	}
+	result, err := stub.InvokeChaincode(AccountChainCode, util.ToChaincodeArgs(transferArgs...))
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to transfer securities from "+PledgeeSegregatedAccount+" to "+PledgerLongboxAccount+" in 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	// Record the return as a transaction on the Deal
+	ReturnTransactionID := stub.GetTxID()
+	Returned, err := total_value(ReturnData.ReturnedSecurities, TransactionData.Currency)
+	if err != nil {
+		return nil, err
+	}
+	ValueReturned := Returned.String()
+	invokeArgs := util.ToChaincodeArgs("create_transaction",
+		ReturnTransactionID,
+		ReturnTimestamp,
+		DealData.DealID,
+		DealData.Pledger,
+		DealData.Pledgee,
+		ValueReturned,
+		RQVCurrency,
+		ReturnTimestamp,
+		"Collateral Return")
+	result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to record collateral return in 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	//-----------------------------------------------------------------------------
+
+	resbody, _ := json.Marshal(Ruleset)
+	respbody, _ := json.Marshal(ConversionRate)
+	reportInJson := `{`
+	reportInJson += `"Deal ID" : "` + DealData.DealID + `",`
+	reportInJson += `"Transaction ID" : "` + TransactionData.TransactionId + `",`
+	reportInJson += `"Return Transaction ID" : "` + ReturnTransactionID + `",`
+	reportInJson += `"Pledgee" : "` + DealData.Pledgee + `",`
+	reportInJson += `"Pledger" : "` + DealData.Pledger + `",`
+	reportInJson += `"Pledger Longbox Account" : "` + PledgerLongboxAccount + `",`
+	reportInJson += `"Pledgee Segregated Account" : "` + PledgeeSegregatedAccount + `",`
+	reportInJson += `"RQV" : "` + TransactionData.RQV + `",`
+	reportInJson += `"Call Amount" : "` + RQV.String() + `",`
+	reportInJson += `"Currency" : "` + RQVCurrency + `",`
+	reportInJson += `"Private Rule set" : ` + string(resbody) + `,`
+	reportInJson += `"Public Rule Set Version" : ` + strconv.Itoa(PublicRulesetVersion) + `,`
+	reportInJson += `"Currency Conversion Rate" : ` + string(respbody) + `,`
+	reportInJson += `"Collateral Value" : "` + ReturnData.CollateralValue.String() + `",`
+	reportInJson += `"Excess Collateral" : "` + ReturnData.Excess.String() + `",`
+	reportInJson += `"Value Returned" : "` + ValueReturned + `",`
+	reportInJson += `"Securities To Move" : ` + movements_json(Movements) + `,`
+	reportInJson += `"Pledgee Segregated Securities" : ` + securities_json(ReturnData.RemainingSecurities) + `,`
+	reportInJson += `"Return Date" : ` + ReturnTimestamp + `,`
+	reportInJson += `"Allocation Status" : "Excess Collateral Returned",`
+	reportInJson += `"Wrong Way Holdings" : ` + reasons_json(wrong_way_holdings(ReturnData.RemainingSecurities, Affiliated)) + `,`
+	reportInJson += `"Rating Breaches" : ` + reasons_json(rating_breaches(ReturnData.RemainingSecurities, Ruleset)) + `,`
+	reportInJson += `"Currency Breaches" : ` + reasons_json(currency_breaches(ReturnData.RemainingSecurities, Ruleset)) + `,`
+	reportInJson += `"Compliance Status" : "` + compliance_check(ReturnData.RemainingSecurities, ConversionRate, RQVCurrency, PublicRuleset, Ruleset, Affiliated) + `"`
+	reportInJson += `}`
+	fmt.Println(reportInJson)
+
+	//Sending Report
+	err = stub.SetEvent("evtsender", []byte(reportInJson))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end return_excess_collateral")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// excess_collateral - pick the lowest priority securities that can go back while what stays still covers the RQV
+// ============================================================================================================================
+func excess_collateral(SegregatedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (ReturnResult, error) {
+	Currency := RQV.Currency
+	result := ReturnResult{CollateralValue: amount.Zero(Currency), ValueReturned: amount.Zero(Currency)}
+
+	// Value held and value counted towards the RQV per collateral form
+	ValueHeld := make(map[string]amount.Amount)
+	for _, valueSecurity := range SegregatedSecurities {
+		form := valueSecurity.CollateralForm
+		value, err := amount.ParseAmount(valueSecurity.TotalValue, Currency)
+		if err == nil {
+			value, err = value.Add(held_value(ValueHeld, form, Currency))
+		}
+		if err != nil {
+			return result, errors.New("Total value of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+		ValueHeld[form] = value
+	}
+	counted := func(form string) amount.Amount {
+		limit, found := RQVEligibleValue[form]
+		if !found {
+			return amount.Zero(Currency)
+		}
+		return min_amount(held_value(ValueHeld, form, Currency), limit)
+	}
+	var err error
+	for key := range ValueHeld {
+		result.CollateralValue, err = result.CollateralValue.Add(counted(key))
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Excess, err = result.CollateralValue.Sub(RQV)
+	if err != nil {
+		return result, err
+	}
+	// Value that can still go without dropping under the RQV
+	ExcessLeft := result.Excess
+	if ExcessLeft.Sign() < 0 {
+		ExcessLeft = amount.Zero(Currency)
+	}
+
+	sorted := append([]Securities(nil), SegregatedSecurities...)
+	sort.Sort(sort.Reverse(by_priority(sorted, Ruleset)))
+	for _, valueSecurity := range sorted {
+		form := valueSecurity.CollateralForm
+		Quantity, err := amount.ParseQuantity(valueSecurity.SecuritiesQuantity)
+		if err != nil {
+			return result, errors.New("Quantity of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+		EffectiveValue, err := amount.ParseDecimal(valueSecurity.EffectiveValueChanged, amount.DecimalPlaces(valueSecurity.EffectiveValueChanged), amount.DefaultRounding)
+		if err != nil {
+			return result, errors.New("Effective value of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+		QuantityReturned := Quantity
+		if EffectiveValue.Sign() > 0 {
+			// Value above the concentration limit counts for nothing and can always go back
+			Room, err := held_value(ValueHeld, form, Currency).Sub(counted(form))
+			if err == nil {
+				Room, err = Room.Add(ExcessLeft)
+			}
+			if err == nil {
+				QuantityReturned, err = Room.Div(EffectiveValue, 0, amount.RoundFloor)
+			}
+			if err != nil {
+				return result, err
+			}
+			QuantityReturned.Currency = ""
+			QuantityReturned = min_amount(QuantityReturned, Quantity)
+			if QuantityReturned.Sign() < 0 {
+				QuantityReturned = amount.Zero("")
+			}
+		}
+		if QuantityReturned.Sign() > 0 {
+			returnedLine := allocated_line(valueSecurity, QuantityReturned.Float64())
+			valueReturned, err := amount.ParseAmount(returnedLine.TotalValue, Currency)
+			if err != nil {
+				return result, err
+			}
+			before := counted(form)
+			ValueHeld[form], err = held_value(ValueHeld, form, Currency).Sub(valueReturned)
+			if err != nil {
+				return result, err
+			}
+			countedChange, err := before.Sub(counted(form))
+			if err == nil {
+				ExcessLeft, err = ExcessLeft.Sub(countedChange)
+			}
+			if err == nil {
+				result.ValueReturned, err = result.ValueReturned.Add(valueReturned)
+			}
+			if err != nil {
+				return result, err
+			}
+			result.ReturnedSecurities = append(result.ReturnedSecurities, returnedLine)
+		}
+		if QuantityReturned.Cmp(Quantity) < 0 {
+			QuantityRemaining, err := Quantity.Sub(QuantityReturned)
+			if err != nil {
+				return result, err
+			}
+			result.RemainingSecurities = append(result.RemainingSecurities, allocated_line(valueSecurity, QuantityRemaining.Float64()))
+		}
+	}
+	return result, nil
+}
+
+// held_value - value held of a collateral form, nothing when none is held
+func held_value(ValueHeld map[string]amount.Amount, form string, Currency string) amount.Amount {
+	if value, found := ValueHeld[form]; found {
+		return value
+	}
+	return amount.Zero(Currency)
+}
+
+// ============================================================================================================================
+// build_allocation_plan - fetch, value and allocate for start_allocation's arguments without invoking any chaincode
+// Returns the errEvent message to raise when the allocation cannot go ahead
+// ============================================================================================================================
+func build_allocation_plan(stub shim.ChaincodeStubInterface, args []string) (AllocationPlan, string, error) {
+	var err error
+	var Plan AllocationPlan
+
+	// Alloting Params
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	PriceChaincode := args[2]
+	DealID := args[3]
+	TransactionID := args[4]
+	PledgerLongboxAccount := args[5]
+	PledgeeSegregatedAccount := args[6]
+	MarginCallTimpestamp := args[7]
+
+	// Json to create report
+	reportInJson := `{`
+
+	//-----------------------------------------------------------------------------
+
+	// Fetch Deal details from Blockchain
+	f := "getDeal_byID"
+	queryArgs := util.ToChaincodeArgs(f, DealID)
+	dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Plan, "", errors.New(errStr)
+	}
+	DealData := Deals{}
+	json.Unmarshal(dealAsBytes, &DealData)
+	fmt.Println(DealData)
+	if DealData.DealID == DealID {
+		fmt.Println("Deal found with DealID : " + DealID)
+	} else {
+		errMsg := "{ \"message\" : \"" + DealID + " Not Found.\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+
+	// Once a deal's accounts are recorded its collateral only moves between them
+	if (DealData.LongboxAccount != "" || DealData.SegregatedAccount != "") && (PledgerLongboxAccount != DealData.LongboxAccount || PledgeeSegregatedAccount != DealData.SegregatedAccount) {
+		errMsg := "{ \"dealId\" : \"" + DealID + "\", \"message\" : \"" + PledgerLongboxAccount + " and " + PledgeeSegregatedAccount + " are not the accounts recorded on " + DealID + ".\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+
+	Pledger := DealData.Pledger
+	Pledgee := DealData.Pledgee
+	fmt.Println("Pledger : ", Pledger)
+	fmt.Println("Pledgee : ", Pledgee)
+
+	// Allocation strategy named on the deal
+	Strategy, found := get_allocation_strategy(DealData.AllocationStrategy)
+	if !found {
+		errMsg := "{ \"dealId\" : \"" + DealID + "\", \"message\" : \"Unknown allocation strategy " + DealData.AllocationStrategy + ".\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+	fmt.Println("Allocation Strategy : ", Strategy.Name())
+
+	// Fetch Transaction details from Blockchain
+	function := "getTransaction_byID"
+	queryArgs = util.ToChaincodeArgs(function, TransactionID)
+	transactionAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Plan, "", errors.New(errStr)
+	}
+	TransactionData := Transactions{}
+	json.Unmarshal(transactionAsBytes, &TransactionData)
+	fmt.Println(TransactionData)
+	if TransactionData.TransactionId == TransactionID {
+		fmt.Println("Transaction found with TransactionID : " + TransactionID)
+	} else {
+		errMsg := "{ \"message\" : \"" + TransactionID + " Not Found.\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+	/*RQV,errBool := strconv.ParseFloat(TransactionData.RQV)*/
+	// Allocation covers the call amount, the RQV on the deal's CSA terms
+	RQV, err := call_amount(TransactionData)
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+
+	fmt.Println("RQV : ", RQV)
+	// RQV currency of a deal
+	RQVCurrency := TransactionData.Currency
+	fmt.Println("RQVCurrency : ", RQVCurrency)
+	//-----------------------------------------------------------------------------
+
+	reportInJson += `"Deal ID" : "` + DealID + `",`
+	reportInJson += `"Transaction ID" : "` + TransactionID + `",`
+	reportInJson += `"Margin Call Date" : "` + MarginCallTimpestamp + `",`
+	reportInJson += `"Pledgee" : "` + Pledgee + `",`
+	reportInJson += `"Pledger" : "` + Pledger + `",`
+	reportInJson += `"Pledger Longbox Account" : "` + PledgerLongboxAccount + `",`
+	reportInJson += `"Pledgee Segregated Account" : "` + PledgeeSegregatedAccount + `",`
+	reportInJson += `"RQV" : "` + TransactionData.RQV + `",`
+	reportInJson += `"Call Amount" : "` + RQV.String() + `",`
+	reportInJson += `"Currency" : "` + TransactionData.Currency + `",`
+	reportInJson += `"Allocation Strategy" : "` + Strategy.Name() + `",`
+
+	// Public rule set in force on the margin call's own date, whatever date the allocation is run with
+	if _, errBool := strconv.ParseInt(TransactionData.MarginCAllDate, 10, 64); errBool != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"Invalid margin call date " + TransactionData.MarginCAllDate + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+	PublicRuleset, PublicRulesetVersion, err := fetch_public_ruleset(stub, DealChaincode, TransactionData.MarginCAllDate)
+	if err != nil {
+		return Plan, "", err
+	}
+	publicbody, err := json.Marshal(PublicRuleset)
+	if err != nil {
+		fmt.Println(err)
+	}
+	reportInJson += `"Public Rule Set" : ` + string(publicbody) + `,`
+	reportInJson += `"Public Rule Set Version" : ` + strconv.Itoa(PublicRulesetVersion) + `,`
+	//-----------------------------------------------------------------------------
+
+	// Fetching the Private Securtiy Ruleset based on Pledger & Pledgee, the version in force on the margin call date
+	Ruleset, RulesetVersion, errMsg, err := fetch_ruleset(stub, DealChaincode, Pledger, Pledgee, TransactionData.MarginCAllDate, PublicRuleset)
+	if err != nil || errMsg != "" {
+		return Plan, errMsg, err
+	}
+	resbody, err := json.Marshal(Ruleset)
+	if err != nil {
+		fmt.Println(err)
+	}
+	reportInJson += `"Private Rule set" : ` + string(resbody) + `,`
+	reportInJson += `"Private Rule Set Version" : ` + strconv.Itoa(RulesetVersion) + `,`
+
+	// Issuers affiliated with the pledger are never taken as collateral
+	Affiliated, err := fetch_affiliations(stub, DealChaincode, Pledger)
+	if err != nil {
+		return Plan, "", err
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Fetching Currency coversion rates with RQV currency as the base
+	ConversionRate, errMsg, err := fetch_conversion_rates(stub, RQVCurrency)
+	if err != nil || errMsg != "" {
+		return Plan, errMsg, err
+	}
+	respbody, err := json.Marshal(ConversionRate)
+	if err != nil {
+		fmt.Println(err)
+	}
+	reportInJson += `"Currency Conversion Rate" : ` + string(respbody) + `,`
+
+	//-----------------------------------------------------------------------------
+
+	// Caluculate eligible Collateral value from RQV, the concentration limit of every collateral form in the ruleset
+	RQVEligibleValue, err := concentration_limits(RQV, Ruleset.Security)
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+	fmt.Println("RQVEligibleValue after calculation:")
+	fmt.Printf("%#v", RQVEligibleValue)
+	fmt.Println()
+
+	//-----------------------------------------------------------------------------
+
+	// Fetch Pledger & Pledgee securities for longbox and segregated accounts
+	function = "getSecurities_byAccount"
+
+	queryArgs = util.ToChaincodeArgs(function, PledgerLongboxAccount)
+	PledgerLongboxSecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+
+	queryArgs = util.ToChaincodeArgs(function, PledgeeSegregatedAccount)
+	PledgeeSegregatedSecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+
+	/**	Calculate the effective value and total value of each Security present in the Longbox account of the pledger
+	and the Segregated account of the pledgee
+	*/
+	var TotalValuePledgerLongbox, TotalValuePledgeeSegregated, AvailableEligibleCollateral float64
+	var PledgerLongboxSecurities, PledgeeSegregatedSecurities, CombinedSecurities, IneligibleSecurities []Securities
+	var CurrencyExclusions, HaircutExclusions []string
+
+	// Make inteface to receive string. UnMarshal them extract them and make an array out of them.
+	var PledgerLongboxSecuritiesJSON, PledgeeSegregatedSecuritiesJSON SecurityArrayStruct
+	json.Unmarshal(PledgerLongboxSecuritiesString, &PledgerLongboxSecuritiesJSON)
+	json.Unmarshal(PledgeeSegregatedSecuritiesString, &PledgeeSegregatedSecuritiesJSON)
+
+	TotalValuePledgerLongboxSecurities := make(map[string]float64)
+	TotalValuePledgeeSegregatedSecurities := make(map[string]float64)
+	AvailableCollateral := make(map[string]float64)
+	AvailableEligible := make(map[string]float64)
+
+	fmt.Println("PledgerLongboxSecuritiesJSON after calculation:")
+	fmt.Printf("%#v", PledgerLongboxSecuritiesJSON)
+	fmt.Println()
+	fmt.Println("PledgeeSegregatedSecuritiesJSON after calculation:")
+	fmt.Printf("%#v", PledgeeSegregatedSecuritiesJSON)
+	fmt.Println()
+
+	// Check the market data of everything about to be valued before anything is worked out or moved
+	// Everything held in the segregated account is valued, the longbox securities that can be offered too
+	var PricedSecurities []Securities
+	for _, value := range PledgerLongboxSecuritiesJSON {
+		if !wrong_way(value, Affiliated) && rating_eligible(value, Ruleset) && currency_eligible(value, Ruleset) && len(Ruleset.Security[value.CollateralForm]) > 0 {
+			PricedSecurities = append(PricedSecurities, value)
+		}
+	}
+	for _, value := range PledgeeSegregatedSecuritiesJSON {
+		if wrong_way(value, Affiliated) || !rating_eligible(value, Ruleset) || !currency_eligible(value, Ruleset) || len(Ruleset.Security[value.CollateralForm]) > 0 {
+			PricedSecurities = append(PricedSecurities, value)
+		}
+	}
+	MarketPrices, MarketDataIssues, err := validate_market_data(stub, PriceChaincode, PricedSecurities, ConversionRate, RQVCurrency, MarginCallTimpestamp)
+	if err != nil {
+		return Plan, "", err
+	}
+	if len(MarketDataIssues) > 0 {
+		Plan.DealData = DealData
+		Plan.TransactionData = TransactionData
+		Plan.MarketDataIssues = MarketDataIssues
+		return Plan, market_data_error(TransactionID, MarketDataIssues), nil
+	}
+
+	//Operations for Pledger Longbox Securities
+	for _, value := range PledgerLongboxSecuritiesJSON {
+		// Key = Security ID && value = Security Structure
+		tempSecurity := Securities{}
+		tempSecurity = value
+
+		// Securities issued by the pledger or its affiliates are worthless when the pledger defaults, skip them
+		if wrong_way(tempSecurity, Affiliated) {
+			fmt.Println("Skipping " + tempSecurity.SecurityId + " issued by " + tempSecurity.Issuer + ", affiliated with the pledger")
+			continue
+		}
+		// Rated below the minimum of its collateral form
+		if !rating_eligible(tempSecurity, Ruleset) {
+			fmt.Println("Skipping " + tempSecurity.SecurityId + " rated " + tempSecurity.Rating + ", below the minimum rating")
+			continue
+		}
+		// In a currency the ruleset does not accept
+		if !currency_eligible(tempSecurity, Ruleset) {
+			fmt.Println("Skipping " + currency_reason(tempSecurity, Ruleset))
+			CurrencyExclusions = append(CurrencyExclusions, currency_reason(tempSecurity, Ruleset))
+			continue
+		}
+
+		// Check if Current Collateral Form type is acceptied in ruleset. If not skip it!
+		if len(Ruleset.Security[tempSecurity.CollateralForm]) > 0 {
+
+			var Eligible bool
+			tempSecurity, Eligible, errMsg = price_security(tempSecurity, MarketPrices[tempSecurity.SecurityId], ConversionRate, RQVCurrency, MarginCallTimpestamp, Ruleset)
+			if errMsg != "" {
+				return Plan, errMsg, nil
+			}
+			// No cell of the haircut grid fits its maturity and rating
+			if !Eligible {
+				fmt.Println("Skipping " + haircut_reason(tempSecurity))
+				HaircutExclusions = append(HaircutExclusions, haircut_reason(tempSecurity))
+				continue
+			}
+			tempTotal, errBool := strconv.ParseFloat(tempSecurity.TotalValue, 64)
+			if errBool != nil {
+				fmt.Println(errBool)
+			}
+			// Calculate Total value based on Collateral form
+			TotalValuePledgerLongboxSecurities[tempSecurity.CollateralForm] += tempTotal
+			// Calculate Total value of pledger's longbox account
+			TotalValuePledgerLongbox += tempTotal
+			
+			// ValuePercentage already carries the haircut grid cell value_security picked
+			fmt.Println("tempSecurity.ValuePercentage")
+			fmt.Println(tempSecurity.ValuePercentage)
+			// Append Securities to an array
+			PledgerLongboxSecurities = append(PledgerLongboxSecurities, tempSecurity)
+			CombinedSecurities = append(CombinedSecurities, tempSecurity)
+		}
+	}
+	
+	fmt.Println("CombinedSecurities from pledgerLongboxSecuritiesJson:",CombinedSecurities)
+	// Operations for Pledgee Segregated Account(s)
+	for _, value := range PledgeeSegregatedSecuritiesJSON {
+		// Key = Security ID && value = Security Structure
+		tempSecurity := Securities{}
+		flag:= false
+		tempSecurity = value
+		fmt.Println("tempSecurity: ",tempSecurity)
+		// Held already but issued by the pledger or its affiliates, rated below the minimum or in a currency not eligible, it goes back to the longbox account
+		if wrong_way(tempSecurity, Affiliated) || !rating_eligible(tempSecurity, Ruleset) || !currency_eligible(tempSecurity, Ruleset) {
+			if !currency_eligible(tempSecurity, Ruleset) {
+				CurrencyExclusions = append(CurrencyExclusions, currency_reason(tempSecurity, Ruleset))
+			}
+			tempSecurity, _, errMsg = price_security(tempSecurity, MarketPrices[tempSecurity.SecurityId], ConversionRate, RQVCurrency, MarginCallTimpestamp, Ruleset)
+			if errMsg != "" {
+				return Plan, errMsg, nil
+			}
+			PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
+			IneligibleSecurities = append(IneligibleSecurities, tempSecurity)
+			continue
+		}
+		if len(Ruleset.Security[tempSecurity.CollateralForm]) > 0 {
+			// Valued at today's price like the longbox holdings, not at what it was stored at
+			var Eligible bool
+			tempSecurity, Eligible, errMsg = price_security(tempSecurity, MarketPrices[tempSecurity.SecurityId], ConversionRate, RQVCurrency, MarginCallTimpestamp, Ruleset)
+			if errMsg != "" {
+				return Plan, errMsg, nil
+			}
+			// Held already but no cell of its haircut grid fits it any more, it goes back to the longbox account
+			if !Eligible {
+				HaircutExclusions = append(HaircutExclusions, haircut_reason(tempSecurity))
+				PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
+				IneligibleSecurities = append(IneligibleSecurities, tempSecurity)
+				continue
+			}
+			for i,value2:= range CombinedSecurities{
+
+					valueSecurity:= Securities{}
+					valueSecurity = value2
+					fmt.Println("valueSecurity: ",valueSecurity)
+				// Check if Current Collateral Form type is acceptied in ruleset. If not skip it!
+				if len(Ruleset.Security[valueSecurity.CollateralForm]) > 0 {
+					fmt.Println("valueSecurity.SecurityId(CombinedSecurities): ",valueSecurity.SecurityId)
+					fmt.Println("tempSecurity.SecurityId(PledgeeSegregatedSecurities): ",tempSecurity.SecurityId)
+	  				// if combined security already contain same security, then update quantity and other values accordingly
+					if valueSecurity.SecurityId == tempSecurity.SecurityId{
+						fmt.Println("Securities matched.")
+						securityQuantity1, err := amount.ParseQuantity(valueSecurity.SecuritiesQuantity)
+						securityQuantity2, err2 := amount.ParseQuantity(tempSecurity.SecuritiesQuantity)
+						if err == nil {
+							err = err2
+						}
+						if err == nil {
+							securityQuantity1, err = securityQuantity1.Add(securityQuantity2)
+						}
+						if err != nil {
+							errMsg = "{ \"securityId\" : \"" + valueSecurity.SecurityId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+							return Plan, errMsg, nil
+						}
+						fmt.Println("SecuritiesQuantity: ",securityQuantity1)
+						valueSecurity.SecuritiesQuantity = securityQuantity1.String()
+						// Effective and total value of the longbox and segregated holdings together
+						valueSecurity, errMsg = effective_value(valueSecurity, ConversionRate, RQVCurrency)
+						if errMsg != "" {
+							return Plan, errMsg, nil
+						}
+						tempTotal, err := security_float(valueSecurity.TotalValue)
+						if err != nil {
+							errMsg = "{ \"securityId\" : \"" + valueSecurity.SecurityId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+							return Plan, errMsg, nil
+						}
+						fmt.Println("TotalValue: ",valueSecurity.TotalValue)
+						// Calculate Total value based on Collateral form
+						TotalValuePledgeeSegregatedSecurities[valueSecurity.CollateralForm] += tempTotal
+						fmt.Println("totalValueSegregatedAccount(CollateralForm): ",TotalValuePledgeeSegregatedSecurities[valueSecurity.CollateralForm])
+						// Calculate Total value of pledgee's segregated account
+						TotalValuePledgeeSegregated += tempTotal
+						fmt.Println("TotalValuePledgeeSegregated: ",TotalValuePledgeeSegregated)			
+						/*	Warning :
+							Saving Priority for the Security in filed `ValuePercentage`
+							This is just for using the limited sorting application provided by GOlang
+							By no chance is this to be stored on Blockchain.
+						*/
+						//valueSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[valueSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
+						//fmt.Println("ValuePercentage: ",valueSecurity.ValuePercentage)
+						// Append Securities to an array
+						PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
+						CombinedSecurities[i]= valueSecurity;
+						fmt.Println("CombinedSecurity: ",CombinedSecurities[i])
+						flag = true
+						//CombinedSecurities = append(CombinedSecurities, valueSecurity)
+					}
+				}
+			}
+			if flag == false{
+				fmt.Println("Securities are different")
+				//fmt.Println("SecuritiesQuantity(PledgeeSegregatedSecurities): ",tempSecurity.SecuritiesQuantity)
+				// Storing the Value percentage in the security data itself
+				//tempSecurity.ValuePercentage = SecurityJSON[tempSecurity.CollateralForm]["Valuation Percentage"]
+				//fmt.Println("tempSecurity.ValuePercentage: ",tempSecurity.ValuePercentage)
+				//convert valuePercentage(string) to float
+				tempTotal, err := security_float(tempSecurity.TotalValue)
+				if err != nil {
+					errMsg = "{ \"securityId\" : \"" + tempSecurity.SecurityId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+					return Plan, errMsg, nil
+				}
+				fmt.Println("tempSecurity.TotalValue")
+				fmt.Println(tempSecurity.TotalValue)
+				// Calculate Total value based on Collateral form
+				TotalValuePledgeeSegregatedSecurities[tempSecurity.CollateralForm] += tempTotal
+				fmt.Println("TotalValuePledgeeSegregatedSecurities[CollateralForm]",TotalValuePledgeeSegregatedSecurities[tempSecurity.CollateralForm])
+				// Calculate Total value of pledgee's segregated account
+				TotalValuePledgeeSegregated += tempTotal
+				fmt.Println("TotalValuePledgeeSegregated: ",TotalValuePledgeeSegregated)	
+				/*	Warning :
+					Saving Priority for the Security in filed `ValuePercentage`
+					This is just for using the limited sorting application provided by GOlang
+					By no chance is this to be stored on Blockchain.
+				*/
+				//tempSecurity.ValuePercentage = strconv.FormatFloat(rulesetFetched.Security[tempSecurity.CollateralForm]["Valuation Percentage"], 'f', 2, 64)
+				//fmt.Println("tempSecurity.ValuePercentage:",tempSecurity.ValuePercentage)
+				// Append Securities to an array
+				PledgeeSegregatedSecurities = append(PledgeeSegregatedSecurities, tempSecurity)
+				fmt.Println("PledgeeSegregatedSecurities: ",PledgeeSegregatedSecurities)
+				CombinedSecurities = append(CombinedSecurities, tempSecurity)
+				fmt.Println("CombinedSecurity: ",CombinedSecurities)
+			}
+		}
+	}
+	 		
+	fmt.Println("TotalValuePledgeeSegregatedSecurities")
+	fmt.Println(TotalValuePledgeeSegregatedSecurities)
+	fmt.Println("TotalValuePledgeeSegregated")
+	fmt.Println(TotalValuePledgeeSegregated)
+	
+	fmt.Println()
+	fmt.Println("PledgerLongboxSecurities after calculation:")
+	fmt.Printf("%#v", PledgerLongboxSecurities)
+	fmt.Println()
+	fmt.Println("PledgeeSegregatedSecurities after calculation:")
+	fmt.Printf("%#v", PledgeeSegregatedSecurities)
+	fmt.Println()
+	fmt.Println("CombinedSecurities after calculation:")
+	fmt.Printf("%#v", CombinedSecurities)
+	fmt.Println()
+
+	// Issuer and issuer group limits of what is on offer
+	err = issuer_limits(RQV, CombinedSecurities, RQVEligibleValue, Ruleset)
+	if err == nil {
+		// Every figure the allocation search and the compliance checks read has to parse before they start
+		err = check_figures(append(append([]Securities(nil), CombinedSecurities...), PledgeeSegregatedSecurities...))
+	}
+	if err != nil {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		return Plan, errMsg, nil
+	}
+
+	for _, valueSecurity := range CombinedSecurities {
+			// Calculate the total value of all the securities based on Collateral form
+			AvailableCollateral[valueSecurity.CollateralForm] += checked_float(valueSecurity.TotalValue)
+	}
+
+	for key := range AvailableCollateral {
+		// Calculate Available Eligiblex = Minimum (Available[tempSecurity.CollateralForm], Eligible[tempSecurity.CollateralForm])
+		AvailableEligible[key] = math.Min(AvailableCollateral[key],RQVEligibleValue[key].Float64())
+
+		// Calculate Available Eligible Collateral = Sum (Available Eligible)
+		AvailableEligibleCollateral = AvailableEligibleCollateral + AvailableEligible[key]
+	}
+	fmt.Println("AvailableCollateral after calculation:")
+	fmt.Printf("%#v", AvailableCollateral)
+	fmt.Println()
+	fmt.Println("AvailableEligible")
+	fmt.Println(AvailableEligible)
+	fmt.Println()
+	fmt.Println("AvailableEligibleCollateral")
+	fmt.Println(AvailableEligibleCollateral)
+	fmt.Println()
+
+	//-----------------------------------------------------------------------------
+
+	Plan.DealData = DealData
+	Plan.TransactionData = TransactionData
+	Plan.Report = reportInJson
+	Plan.CurrencyExclusions = CurrencyExclusions
+	Plan.HaircutExclusions = HaircutExclusions
+	Plan.MarginCallTimestamp = MarginCallTimpestamp
+	Plan.RQV = RQV
+	Plan.ConversionRate = ConversionRate
+	Plan.PublicRuleset = PublicRuleset
+	Plan.Ruleset = Ruleset
+	Plan.Affiliated = Affiliated
+	Plan.RQVEligibleValue = RQVEligibleValue
+	Plan.AvailableEligible = AvailableEligible
+	// Until something is allocated both accounts stay as they are
+	Plan.LongboxSecurities = PledgerLongboxSecurities
+	Plan.SegregatedSecurities = PledgeeSegregatedSecurities
+	Plan.ComplianceStatus = TransactionData.ComplianceStatus
+	if len(IneligibleSecurities) > 0 {
+		Plan.ComplianceStatus = "Regulatory Non-Compliant"
+	}
+
+	if AvailableEligibleCollateral < RQV.Float64() {
+		// What the eligible collateral leaves of the RQV, at the currency's decimals
+		Available, err := amount.FromFloat(AvailableEligibleCollateral, amount.ScaleOf(RQVCurrency), amount.RoundDown)
+		if err == nil {
+			Available.Currency = RQVCurrency
+			Plan.Allocation.RQVLeft, err = RQV.Sub(Available)
+		}
+		if err != nil {
+			return Plan, "", err
+		}
+		Plan.Allocation.Mode = "Insufficient collateral"
+		fmt.Println("Insufficient collateral, RQVLeft: ", Plan.Allocation.RQVLeft)
+		return Plan, "", nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Sorting the Securities in PledgerLongboxSecurities & PledgeeSegregatedSecurities
+	// Using Code defination like https://play.golang.org/p/ciN45THQjM
+	// Reference from http://nerdyworm.com/blog/2013/05/15/sorting-a-slice-of-structs-in-go/
+	sort.Sort(by_priority(CombinedSecurities, Ruleset))
+	fmt.Println("CombinedSecurities after sort: ", CombinedSecurities)
+
+	// The deal's allocation strategy picks the securities to move
+	Plan.Allocation, err = Strategy.Allocate(CombinedSecurities, RQV, RQVEligibleValue, Ruleset)
+	if err != nil {
+		return Plan, "", err
+	}
+	fmt.Println("Final RQVLeft: ", Plan.Allocation.RQVLeft)
+	fmt.Println("ReallocatedSecurities after calculation:")
+	fmt.Printf("%#v", Plan.Allocation.ReallocatedSecurities)
+	fmt.Println()
+	if Plan.Allocation.RQVLeft.Sign() > 0 {
+		return Plan, "", nil
+	}
+
+	// What each account holds once the allocation is through
+	Plan.LongboxSecurities = remaining_securities(CombinedSecurities, Plan.Allocation)
+	Plan.LongboxSecurities = append(Plan.LongboxSecurities, IneligibleSecurities...)
+	Plan.SegregatedSecurities = nil
+	for _, valueSecurity := range Plan.Allocation.ReallocatedSecurities {
+		if valueSecurity.SecuritiesQuantity != "0.00" {
+			Plan.SegregatedSecurities = append(Plan.SegregatedSecurities, valueSecurity)
+		}
+	}
+	sort.Sort(by_priority(Plan.SegregatedSecurities, Ruleset))
+	Plan.Movements = securities_to_move(PledgeeSegregatedSecurities, Plan.SegregatedSecurities, PledgerLongboxAccount, PledgeeSegregatedAccount)
+	Plan.ComplianceStatus = compliance_check(Plan.SegregatedSecurities, ConversionRate, RQVCurrency, PublicRuleset, Ruleset, Affiliated)
+	return Plan, "", nil
+}
+
+// call_amount - what a margin call asks the segregated account to cover, its RQV when it has no CSA call amount
+func call_amount(TransactionData Transactions) (amount.Amount, error) {
+	if TransactionData.CallAmount != "" && TransactionData.CallAmount != "NA" {
+		return amount.ParseAmount(TransactionData.CallAmount, TransactionData.Currency)
+	}
+	return amount.ParseAmount(TransactionData.RQV, TransactionData.Currency)
+}
+
+// ============================================================================================================================
+// fetch_ruleset - read the private security ruleset agreed between Pledger & Pledgee
+// The version in force at AsOf is read from the 'Deal' chaincode, so every peer allocates on the same ruleset
+// Returns the ruleset and its version, or the errEvent message to raise when they have no approved ruleset in force
+// or the one in force is looser than PublicRuleset, the public rule set in force at AsOf
+// ============================================================================================================================
+func fetch_ruleset(stub shim.ChaincodeStubInterface, DealChaincode string, Pledger string, Pledgee string, AsOf string, PublicRuleset map[string]map[string]string) (Ruleset, int, string, error) {
+	queryArgs := util.ToChaincodeArgs("getRuleset", Pledger, Pledgee, AsOf)
+	rulesetAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch Security Ruleset from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Ruleset{}, 0, "", errors.New(errStr)
+	}
+	var RulesetVersion struct {
+		Version int     `json:"version"`
+		Ruleset Ruleset `json:"ruleset"`
+	}
+	json.Unmarshal(rulesetAsBytes, &RulesetVersion)
+	if RulesetVersion.Version == 0 {
+		errMsg := "{ \"message\" : \"No approved Security Ruleset of " + Pledger + " and " + Pledgee + " in force on " + AsOf + ".\", \"code\" : \"503\"}"
+		return Ruleset{}, 0, errMsg, nil
+	}
+	// The private ruleset may only tighten the public rule set, never loosen it
+	if Violations := ruleset_conformance(RulesetVersion.Ruleset, PublicRuleset); len(Violations) > 0 {
+		return Ruleset{}, RulesetVersion.Version, ruleset_conformance_error(Pledger, Pledgee, RulesetVersion.Version, Violations), nil
+	}
+
+	fmt.Println("Ruleset version " + strconv.Itoa(RulesetVersion.Version) + " : ")
+	fmt.Println(RulesetVersion.Ruleset)
+	return RulesetVersion.Ruleset, RulesetVersion.Version, "", nil
+}
+
+// ============================================================================================================================
+// store_valuations - write the market price, valuation percentage, effective and total value worked out for each holding of an
+// account back to the 'Account' chaincode, which recomputes the account total
+// ============================================================================================================================
+func store_valuations(stub shim.ChaincodeStubInterface, AccountChainCode string, Account string, Holdings []Securities) error {
+	if len(Holdings) == 0 {
+		return nil
+	}
+	revalueArgs := []string{"revalue_securities", Account}
+	for _, valueSecurity := range Holdings {
+		revalueArgs = append(revalueArgs, valueSecurity.SecurityId, valueSecurity.MTM, valueSecurity.ValuePercentage, valueSecurity.EffectiveValueChanged, valueSecurity.TotalValue)
+	}
+	result, err := stub.InvokeChaincode(AccountChainCode, util.ToChaincodeArgs(revalueArgs...))
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to store valuations of "+Account+" in 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return errors.New(errStr)
+	}
+	fmt.Println(result)
+	return nil
+}
+
+// ============================================================================================================================
+// value_security - price a security from the 'PriceFeed' chaincode as of AsOf and work out its effective and total value in RQV currency
+// The collateral form has to be in the ruleset, the haircut grid cell is picked by residual maturity as of AsOf, see price_security
+// ============================================================================================================================
+func value_security(stub shim.ChaincodeStubInterface, PriceChaincode string, tempSecurity Securities, ConversionRate CurrencyConversion, RQVCurrency string, AsOf string, Ruleset Ruleset) (Securities, bool, string, error) {
+	Price, errMsg, err := fetch_price(stub, PriceChaincode, tempSecurity.SecurityId, AsOf)
+	if err != nil || errMsg != "" {
+		return tempSecurity, false, errMsg, err
+	}
+	tempSecurity, Eligible, errMsg := price_security(tempSecurity, Price, ConversionRate, RQVCurrency, AsOf, Ruleset)
+	return tempSecurity, Eligible, errMsg, nil
+}
+
+// ============================================================================================================================
+// price_security - value a security at a price already fetched, with the haircut grid cell of its residual maturity as of AsOf
+// Returns false when no cell of its haircut grid fits it, it is then valued at nothing and is not eligible
+// ============================================================================================================================
+func price_security(tempSecurity Securities, Price Prices, ConversionRate CurrencyConversion, RQVCurrency string, AsOf string, Ruleset Ruleset) (Securities, bool, string) {
+	// Storing the Value percentage in the security ruleset data itself
+	ValuationPercentage, Cell, Eligible := haircut_cell(tempSecurity, AsOf, Ruleset)
+	// Held in another currency than the RQV, the FX mismatch haircut comes on top of the grid's
+	tempSecurity.FXHaircut = ""
+	if FXHaircut := fx_mismatch_haircut(tempSecurity, RQVCurrency, Ruleset); FXHaircut > 0 {
+		ValuationPercentage = math.Max(ValuationPercentage-FXHaircut, 0)
+		tempSecurity.FXHaircut = strconv.FormatFloat(FXHaircut, 'f', 2, 64)
+	}
+	tempSecurity.ValuePercentage = strconv.FormatFloat(ValuationPercentage, 'f', 2, 64)
+	tempSecurity.HaircutCell = Cell
+	tempSecurity, errMsg := revalue_security(tempSecurity, Price, ConversionRate, RQVCurrency)
+	return tempSecurity, Eligible, errMsg
+}
+
+// ============================================================================================================================
+// revalue_security - mark a security to a published price and apply the Valuation Percentage it already carries
+// ============================================================================================================================
+func revalue_security(tempSecurity Securities, Price Prices, ConversionRate CurrencyConversion, RQVCurrency string) (Securities, string) {
+	if Price.Currency != "" && tempSecurity.Currency != "" && Price.Currency != tempSecurity.Currency {
+		errMsg := "{ \"securityId\" : \"" + tempSecurity.SecurityId + "\", \"message\" : \"Market price is in " + Price.Currency + ", the security in " + tempSecurity.Currency + ".\", \"code\" : \"503\"}"
+		return tempSecurity, errMsg
+	}
+	tempSecurity.MTM = Price.Price
+	return effective_value(tempSecurity, ConversionRate, RQVCurrency)
+}
+
+// ============================================================================================================================
+// effective_value - Effective Value Changed = MTM / FX rate * Valuation Percentage / 100, and Total Value = Quantity * that
+// Decimal throughout, each figure is rounded once to the RQV currency so the stored total is the quantity times the stored
+// effective value. Figures that do not read are reported, not valued as zero.
+// ============================================================================================================================
+func effective_value(tempSecurity Securities, ConversionRate CurrencyConversion, RQVCurrency string) (Securities, string) {
+	errMsg := func(reason string) string {
+		return "{ \"securityId\" : \"" + tempSecurity.SecurityId + "\", \"message\" : \"" + reason + "\", \"code\" : \"503\"}"
+	}
+	mtm, err := amount.ParseRate(tempSecurity.MTM)
+	if err != nil {
+		return tempSecurity, errMsg("Market price: " + err.Error())
+	}
+	valuePercentage, err := amount.ParseRate(tempSecurity.ValuePercentage)
+	if err != nil {
+		return tempSecurity, errMsg("Valuation percentage: " + err.Error())
+	}
+	quantity, err := amount.ParseQuantity(tempSecurity.SecuritiesQuantity)
+	if err != nil {
+		return tempSecurity, errMsg(err.Error())
+	}
+	_rate := amount.Amount{Units: 1, Scale: 0}
+	if tempSecurity.Currency != RQVCurrency {
+		_rate, err = amount.FromFloat(ConversionRate.Rates[tempSecurity.Currency], amount.RateScale, amount.DefaultRounding)
+		if err == nil && _rate.Sign() <= 0 {
+			err = errors.New("no rate")
+		}
+		if err != nil {
+			return tempSecurity, errMsg("No conversion rate from " + tempSecurity.Currency + " to " + RQVCurrency)
+		}
+	}
+	scale := amount.ScaleOf(RQVCurrency)
+	// Effective Value =  (MTM(market Value) * valuePercentage)/100, converted at the exchange rate to RQV currency
+	effectiveValue, err := mtm.Mul(valuePercentage, amount.RateScale, amount.DefaultRounding)
+	divisor, err2 := _rate.Mul(amount.Amount{Units: 100}, amount.RateScale, amount.DefaultRounding)
+	if err == nil {
+		err = err2
+	}
+	if err == nil {
+		effectiveValue, err = effectiveValue.Div(divisor, scale, amount.DefaultRounding)
+	}
+	// Calculate Total Value = Effective Value * Quantity
+	totalValue := amount.Amount{}
+	if err == nil {
+		totalValue, err = effectiveValue.Mul(quantity, scale, amount.DefaultRounding)
+	}
+	if err != nil {
+		return tempSecurity, errMsg(err.Error())
+	}
+	tempSecurity.EffectiveValueChanged = effectiveValue.String()
+	tempSecurity.TotalValue = totalValue.String()
+	fmt.Println(tempSecurity.SecurityId + " EffectiveValueChanged: " + tempSecurity.EffectiveValueChanged + ", TotalValue: " + tempSecurity.TotalValue)
+	return tempSecurity, ""
+}
+
+// ============================================================================================================================
+// securities_to_move - quantities that have to change hands for the segregated account to hold TargetSegregated
+// ============================================================================================================================
+func securities_to_move(CurrentSegregated []Securities, TargetSegregated []Securities, LongboxAccount string, SegregatedAccount string) []SecurityMovement {
+	// Decimal quantities, so a security whose quantity does not change is not moved by a rounding difference
+	QuantityNow := make(map[string]amount.Amount)
+	QuantityTarget := make(map[string]amount.Amount)
+	for _, valueSecurity := range CurrentSegregated {
+		QuantityNow[valueSecurity.SecurityId] = add_quantity(QuantityNow[valueSecurity.SecurityId], valueSecurity.SecuritiesQuantity)
+	}
+	for _, valueSecurity := range TargetSegregated {
+		QuantityTarget[valueSecurity.SecurityId] = add_quantity(QuantityTarget[valueSecurity.SecurityId], valueSecurity.SecuritiesQuantity)
+	}
+
+	var Movements []SecurityMovement
+	movedIn := make(map[string]bool)
+	movedOut := make(map[string]bool)
+	// Into the segregated account
+	for _, valueSecurity := range TargetSegregated {
+		id := valueSecurity.SecurityId
+		if movedIn[id] {
+			continue
+		}
+		movedIn[id] = true
+		if quantity, _ := QuantityTarget[id].Sub(QuantityNow[id]); quantity.Sign() > 0 {
+			Movements = append(Movements, SecurityMovement{id, LongboxAccount, SegregatedAccount, quantity.String()})
+		}
+	}
+	// Back to the longbox account
+	for _, valueSecurity := range CurrentSegregated {
+		id := valueSecurity.SecurityId
+		if movedOut[id] {
+			continue
+		}
+		movedOut[id] = true
+		if quantity, _ := QuantityNow[id].Sub(QuantityTarget[id]); quantity.Sign() > 0 {
+			Movements = append(Movements, SecurityMovement{id, SegregatedAccount, LongboxAccount, quantity.String()})
+		}
+	}
+	return Movements
+}
+
+// add_quantity - a quantity of a security held more than once added to what is counted so far
+func add_quantity(Counted amount.Amount, SecuritiesQuantity string) amount.Amount {
+	Quantity, err := amount.ParseQuantity(SecuritiesQuantity)
+	if err == nil {
+		Counted, err = Counted.Add(Quantity)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	return Counted
+}
+
+// ============================================================================================================================
+// compliance_check - check the securities in the segregated account against the public rule set in force (PublicRuleset),
+// the private limits of Ruleset and the pledger's affiliations
+// ============================================================================================================================
+func compliance_check(SegregatedSecurities []Securities, ConversionRate CurrencyConversion, RQVCurrency string, PublicRuleset map[string]map[string]string, Ruleset Ruleset, Affiliated Affiliations) string {
+	compliance_status := "Regulatory Compliant"
+	totalValue_Pri := make(map[string]float64)
+	eligibleValue_Pub := make(map[string]float64)
+	var totalValueSegregatedAccount float64
+	for _, valueSecurity := range SegregatedSecurities {
+		//ConcentrationLimit_Pri := rulesetFetched.Security[valueSecurity.CollateralForm]["Concentration Limit"]
+		temp, errBool2 := strconv.ParseFloat(valueSecurity.MTM, 64)
+		if errBool2 != nil {
+			fmt.Println(errBool2)
+		}
+
+		ValuationPercentage_Pub, errBool3 := strconv.ParseFloat(PublicRuleset[valueSecurity.CollateralForm]["Valuation Percentage"], 64)
+		if errBool3 != nil {
+			fmt.Println(errBool3)
+		}
+
+		//ValuationPercentage_Pri := rulesetFetched.Security[valueSecurity.CollateralForm]["Valuation Percentage"]
+		effectiveValueChanged_Pri, errBool4 := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
+		if errBool4 != nil {
+			fmt.Println(errBool4)
+		}
+		totalValuePri, errBool5 := strconv.ParseFloat(valueSecurity.TotalValue, 64)
+		if errBool5 != nil {
+			fmt.Println(errBool5)
+		}
+		exchange_rate := ConversionRate.Rates[valueSecurity.Currency]
+		if valueSecurity.Currency == RQVCurrency {
+			exchange_rate = 1
+		}
+		newMTM := temp / exchange_rate
+		fmt.Println("newMTM")
+		fmt.Println(newMTM)
+		// Effective Value =  (MTM(market Value) * valuePercentage)/100
+		effectiveValueChanged_Pub := (newMTM * ValuationPercentage_Pub) / 100
+		fmt.Println("effectiveValueChanged_Pub")
+		fmt.Println(effectiveValueChanged_Pub)
+		tmpEffectiveValueChangedPub := strconv.FormatFloat(effectiveValueChanged_Pub, 'f', 2, 64)
+		effectiveValueChangedPub, errBool6 := strconv.ParseFloat(tmpEffectiveValueChangedPub, 64)
+		if errBool6 != nil {
+			fmt.Println(errBool6)
+		}
+		if effectiveValueChangedPub < effectiveValueChanged_Pri {
+			compliance_status = "Regulatory Non-Compliant"
+		}
+		fmt.Println("compliance_status: ", compliance_status)
+		totalValue_Pri[valueSecurity.CollateralForm] += totalValuePri
+		fmt.Println(totalValue_Pri[valueSecurity.CollateralForm])
+		totalValueSegregatedAccount = totalValueSegregatedAccount + totalValuePri
+		fmt.Println("totalValueSegregatedAccount: ", totalValueSegregatedAccount)
+	}
+	fmt.Println("totalValueSegregatedAccount: ", totalValueSegregatedAccount)
+	for key := range totalValue_Pri {
+		ConcentrationLimit_Pub, errBool1 := strconv.ParseFloat(PublicRuleset[key]["Concentration Limit"], 64)
+		if errBool1 != nil {
+			fmt.Println(errBool1)
+		}
+		eligibleValuePub := (ConcentrationLimit_Pub * totalValueSegregatedAccount) / 100
+		fmt.Println("eligibleValuePub: ", eligibleValuePub)
+		eligibleValue_Pub[key] += eligibleValuePub
+		fmt.Println("eligibleValue_Pub["+key+"]: ", eligibleValue_Pub[key])
+		fmt.Println("totalValue_Pri["+key+"]: ", totalValue_Pri[key])
+		if totalValue_Pri[key] > eligibleValue_Pub[key] {
+			compliance_status = "Regulatory Non-Compliant"
+		}
+		fmt.Println("compliance_status: ", compliance_status)
+	}
+	// Private issuer and issuer group limits
+	if len(issuer_breaches(SegregatedSecurities, Ruleset)) > 0 {
+		compliance_status = "Regulatory Non-Compliant"
+	}
+	// Securities issued by the pledger or its affiliates
+	if len(wrong_way_holdings(SegregatedSecurities, Affiliated)) > 0 {
+		compliance_status = "Regulatory Non-Compliant"
+	}
+	// Securities rated below the minimum of their collateral form
+	if len(rating_breaches(SegregatedSecurities, Ruleset)) > 0 {
+		compliance_status = "Regulatory Non-Compliant"
+	}
+	// Securities in a currency the ruleset does not accept
+	if len(currency_breaches(SegregatedSecurities, Ruleset)) > 0 {
+		compliance_status = "Regulatory Non-Compliant"
+	}
+	return compliance_status
+}
+
+// ============================================================================================================================
+// allocation_report - close off the report started in build_allocation_plan
+// ============================================================================================================================
+func allocation_report(Plan AllocationPlan, AllocationStatus string, Simulated bool) string {
+	reportInJson := Plan.Report
+	reportInJson += `"Allocation Mode" : "` + Plan.Allocation.Mode + `",`
+	reportInJson += `"RQV Eligible Value" : ` + limits_json(Plan.RQVEligibleValue) + `,`
+	reportInJson += `"Available Eligible" : ` + amounts_json(Plan.AvailableEligible) + `,`
+	reportInJson += `"Short Fall" : "` + short_fall(Plan.Allocation.RQVLeft).String() + `",`
+	reportInJson += `"Securities To Move" : ` + movements_json(Plan.Movements) + `,`
+	reportInJson += `"Pledger Longbox Securities" : ` + securities_json(Plan.LongboxSecurities) + `,`
+	reportInJson += `"Pledgee Segregated Securities" : ` + securities_json(Plan.SegregatedSecurities) + `,`
+	reportInJson += `"Allocation Date" : ` + Plan.MarginCallTimestamp + `,`
+	reportInJson += `"Allocation Status" : "` + AllocationStatus + `",`
+	reportInJson += `"Simulated" : ` + strconv.FormatBool(Simulated) + `,`
+	reportInJson += `"Issuer Breaches" : ` + issuer_breaches_json(issuer_breaches(Plan.SegregatedSecurities, Plan.Ruleset)) + `,`
+	reportInJson += `"Wrong Way Holdings" : ` + reasons_json(wrong_way_holdings(Plan.SegregatedSecurities, Plan.Affiliated)) + `,`
+	reportInJson += `"Rating Breaches" : ` + reasons_json(rating_breaches(Plan.SegregatedSecurities, Plan.Ruleset)) + `,`
+	reportInJson += `"Currency Breaches" : ` + reasons_json(currency_breaches(Plan.SegregatedSecurities, Plan.Ruleset)) + `,`
+	reportInJson += `"Currency Exclusions" : ` + reasons_json(Plan.CurrencyExclusions) + `,`
+	reportInJson += `"Haircut Exclusions" : ` + reasons_json(Plan.HaircutExclusions) + `,`
+	reportInJson += `"Compliance Status" : "` + Plan.ComplianceStatus + `"`
+	reportInJson += `}`
+	return reportInJson
+}
+
+// Amounts per collateral form, two decimals like the rest of the report
+func amounts_json(amounts map[string]float64) string {
+	var keys []string
+	for key := range amounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	amountsJson := `{`
+	for i, key := range keys {
+		amountsJson += `"` + key + `" : "` + strconv.FormatFloat(amounts[key], 'f', 2, 64) + `"`
+		if i < len(keys)-1 {
+			amountsJson += `,`
+		}
+	}
+	amountsJson += `}`
+	return amountsJson
+}
+
+// limits_json - concentration limits as report JSON, at the decimals they were worked out to
+func limits_json(limits map[string]amount.Amount) string {
+	var keys []string
+	for key := range limits {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	limitsJson := `{`
+	for i, key := range keys {
+		limitsJson += `"` + key + `" : "` + limits[key].String() + `"`
+		if i < len(keys)-1 {
+			limitsJson += `,`
+		}
+	}
+	limitsJson += `}`
+	return limitsJson
+}
+
+func securities_json(securities []Securities) string {
+	if len(securities) == 0 {
+		return `[]`
+	}
+	securitiesAsBytes, err := json.Marshal(securities)
+	if err != nil {
+		fmt.Println("Error while converting Securities struct to string")
+		return `[]`
+	}
+	return string(securitiesAsBytes)
+}
+
+func movements_json(movements []SecurityMovement) string {
+	if len(movements) == 0 {
+		return `[]`
+	}
+	movementsAsBytes, err := json.Marshal(movements)
+	if err != nil {
+		fmt.Println("Error while converting SecurityMovement struct to string")
+		return `[]`
+	}
+	return string(movementsAsBytes)
+}
+
+// ============================================================================================================================
+// greedy_allocation - walk the securities in the given order and take whatever fits under the concentration limits
+// ============================================================================================================================
+func greedy_allocation(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValueLeft map[string]float64, Ruleset Ruleset) (AllocationResult, error) {
+	// RQVEligibleValueLeft[CollateralType] contains what is left of the max eligible vaule for each type, counted down as securities are taken
+	// The search runs in float64, what it leaves of the RQV is worked out exactly once it is done
+	RQVLeft := RQV.Float64()
+
+	SecuritiesAllocated := make(map[string]float64)
+	TotalValueAllocated := make(map[string]float64)
+	var ReallocatedSecurities []Securities
+	
+	// Iterating through all the securities 
+	// Label: PledgerLongboxSecuritiesIterator --> to be used for break statements
+	
+	CombinedSecuritiesIterator:
+	for _, valueSecurity := range CombinedSecurities {
+		fmt.Println("RQVLeft: ", RQVLeft)
+		//fmt.Println("TotalValuePledgeeSegregated: ", TotalValuePledgeeSegregated)
+		//fmt.Println("TotalValuePledgerLongbox: ", TotalValuePledgerLongbox)
+		//var TotalValuePledgee float64
+		if RQVLeft > 0 {
+			// More Security need to be taken out
+			rqvEligibleValueLeft := concentration_left(RQVEligibleValueLeft, valueSecurity, Ruleset)
+			fmt.Println("rqvEligibleValueLeft: ",rqvEligibleValueLeft)
+			totalValue, errBool := strconv.ParseFloat(valueSecurity.TotalValue, 64)
+			if errBool != nil {
+				fmt.Println(errBool)
+			}
+			fmt.Println("totalValue: ",totalValue)
+			if rqvEligibleValueLeft > 0 {
+				if totalValue <= rqvEligibleValueLeft {
+					// At least one more this type of collateralForm to be taken out
+					if totalValue <= RQVLeft {
+						// All Security of this type will re allocated as RQV has balance
+
+						RQVLeft -= totalValue
+						fmt.Println("RQVLeft: ",RQVLeft)
+						use_concentration(RQVEligibleValueLeft, valueSecurity, totalValue, Ruleset)
+						fmt.Println(valueSecurity.CollateralForm +": ",RQVEligibleValueLeft[valueSecurity.CollateralForm])
+						ReallocatedSecurities = append(ReallocatedSecurities, valueSecurity)
+						fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
+						securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
+						if errBool != nil {
+							fmt.Println(errBool)
+						}
+						fmt.Println("securityQuantity: ",securityQuantity)
+						SecuritiesAllocated[valueSecurity.SecurityId] = securityQuantity
+						fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
+						TotalValueAllocated[valueSecurity.SecurityId] = totalValue
+						fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
+						/*TotalValuePledgee += totalValue
+						fmt.Println(TotalValuePledgee)*/
+					}else {
+						// RQV has insufficient balance to take all securities
+						securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
+						if errBool != nil {
+							fmt.Println(errBool)
+						}
+						fmt.Println("securityQuantity: ",securityQuantity)
+						effectiveValueChanged, errBool := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
+						if errBool != nil {
+							fmt.Println(errBool)
+						}
+						fmt.Println("effectiveValueChanged: ",effectiveValueChanged)
+						QuantityToTakeout := math.Floor((RQVLeft * securityQuantity)/ totalValue)
+						fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
+						if QuantityToTakeout == 0{
+							QuantityToTakeout = 1
+						}
+						totalValueToAllocate := QuantityToTakeout * effectiveValueChanged
+						fmt.Println("totalValueToAllocate: ",totalValueToAllocate)
+						if totalValueToAllocate < rqvEligibleValueLeft{
+							if totalValueToAllocate < RQVLeft{
+								QuantityToTakeout = math.Ceil((RQVLeft * securityQuantity)/ totalValue)
+								fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
+								totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
+								fmt.Println("totalValueToAllocate: ",totalValueToAllocate)
+							}
+						}
+						// Value of the whole securities taken, as stored
+						totalValueToAllocate = checked_float(allocated_line(valueSecurity, QuantityToTakeout).TotalValue)
+						RQVLeft -= totalValueToAllocate
+						fmt.Println("RQVLeft: ",RQVLeft)
+						use_concentration(RQVEligibleValueLeft, valueSecurity, totalValueToAllocate, Ruleset)
+						fmt.Println("RQVEligibleValueLeft: ",RQVEligibleValueLeft)
+						tempSecurity2 := allocated_line(valueSecurity, QuantityToTakeout)
+						if QuantityToTakeout != 0 {
+							ReallocatedSecurities = append(ReallocatedSecurities, tempSecurity2)
+						}
+						fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
+						SecuritiesAllocated[valueSecurity.SecurityId] = QuantityToTakeout
+						fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
+						TotalValueAllocated[valueSecurity.SecurityId] = totalValueToAllocate
+						fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
+						/*TotalValuePledgee += totalValueToAllocate
+						fmt.Println(TotalValuePledgee)*/
+					}
+				}else{
+					// rqvEligibleValueLeft is less than total Value
+					securityQuantity, errBool := strconv.ParseFloat(valueSecurity.SecuritiesQuantity, 64)
+					if errBool != nil {
+						fmt.Println(errBool)
+					}
+					fmt.Println("securityQuantity: ",securityQuantity)
+					effectiveValueChanged, errBool := strconv.ParseFloat(valueSecurity.EffectiveValueChanged, 64)
+					if errBool != nil {
+						fmt.Println(errBool)
+					}
+					fmt.Println("effectiveValueChanged: ",effectiveValueChanged)
+					QuantityToTakeout := math.Floor((rqvEligibleValueLeft * securityQuantity)/ totalValue)
+					fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
+					
+					totalValueToAllocate := QuantityToTakeout * effectiveValueChanged
+					fmt.Println("totalValueToAllocate: ", totalValueToAllocate)
+					if totalValueToAllocate > RQVLeft {
+						// One more security can be taken out
+						QuantityToTakeout = math.Ceil((RQVLeft * securityQuantity)/ totalValue)
+						fmt.Println("QuantityToTakeout: ", QuantityToTakeout)
+						if QuantityToTakeout == 0{
+							QuantityToTakeout = 1
+						}
+						totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
+						fmt.Println("totalValueToAllocate: ", totalValueToAllocate)
+					}
+					if totalValueToAllocate > rqvEligibleValueLeft {
+						QuantityToTakeout = 0
+						totalValueToAllocate = QuantityToTakeout * effectiveValueChanged
+					}
+					// Value of the whole securities taken, as stored
+					totalValueToAllocate = checked_float(allocated_line(valueSecurity, QuantityToTakeout).TotalValue)
+					RQVLeft -= totalValueToAllocate
+					fmt.Println("RQVLeft: ",RQVLeft)
+					use_concentration(RQVEligibleValueLeft, valueSecurity, totalValueToAllocate, Ruleset)
+					fmt.Println("RQVEligibleValueLeft: ",RQVEligibleValueLeft)
+					tempSecurity2 := allocated_line(valueSecurity, QuantityToTakeout)
+					if QuantityToTakeout != 0 {
+						ReallocatedSecurities = append(ReallocatedSecurities, tempSecurity2)
+					}
+					fmt.Println("ReallocatedSecurities: ",ReallocatedSecurities)
+					SecuritiesAllocated[valueSecurity.SecurityId] = QuantityToTakeout
+					fmt.Println(valueSecurity.SecurityId + ": " , SecuritiesAllocated[valueSecurity.SecurityId])
+					TotalValueAllocated[valueSecurity.SecurityId] = totalValueToAllocate
+					fmt.Println(valueSecurity.SecurityId + ": " , TotalValueAllocated[valueSecurity.SecurityId])
+					/*TotalValuePledgee += totalValueToAllocate
+					fmt.Println("TotalValuePledgee: "+TotalValuePledgee)*/
+				}
+			} else{
+				// no security to take out of this type of security
+			}
+		} else {
+			// Security cutting done
+			// Break from the PledgerLongboxSecuritiesIterator as Pledgee's segregated account balance reached to RQV
+			break CombinedSecuritiesIterator
+		}
+	}
+
+	fmt.Println("Final RQVLeft: ", RQVLeft)
+	fmt.Println("RQVEligibleValueLeft after calculation:")
+	fmt.Printf("%#v", RQVEligibleValueLeft)
+	fmt.Println()
+	Left, err := rqv_left(RQV, ReallocatedSecurities)
+	return AllocationResult{ReallocatedSecurities, SecuritiesAllocated, TotalValueAllocated, Left, "Greedy"}, err
+}
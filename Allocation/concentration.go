@@ -0,0 +1,232 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// Issuer and issuer group limits sit in RQVEligibleValue next to the collateral forms under these prefixes
+const (
+	IssuerLimitKey      = "Issuer "
+	IssuerGroupLimitKey = "Issuer Group "
+)
+
+// Ruleset.IssuerLimit entry that applies to issuers not listed by name
+const DefaultIssuerLimit = "Default"
+
+// One issuer or issuer group holding more than its limit allows
+type IssuerBreach struct {
+	Issuer      string `json:"Issuer,omitempty"`
+	IssuerGroup string `json:"Issuer Group,omitempty"`
+	Value       string `json:"Value"`
+	Limit       string `json:"Limit"`
+}
+
+// ============================================================================================================================
+// concentration_limits - limit of every collateral form in the ruleset as a share of the RQV
+// ============================================================================================================================
+func concentration_limits(RQV amount.Amount, Security map[string]map[string]float64) (map[string]amount.Amount, error) {
+	RQVEligibleValue := make(map[string]amount.Amount)
+	for key, value := range Security {
+		limit, err := concentration_limit(RQV, value["Concentration Limit"])
+		if err != nil {
+			return nil, errors.New(key + ": " + err.Error())
+		}
+		RQVEligibleValue[key] = limit
+	}
+	return RQVEligibleValue, nil
+}
+
+// concentration_limit - limit in percent of the RQV, rounded down to the currency so it is never passed
+func concentration_limit(RQV amount.Amount, limit float64) (amount.Amount, error) {
+	percent, err := amount.FromFloat(limit, amount.RateScale, amount.RoundHalfUp)
+	if err != nil {
+		return amount.Amount{}, err
+	}
+	// Two more decimals turn the percentage into a fraction
+	percent.Scale += 2
+	return RQV.Mul(percent, RQV.Scale, amount.RoundDown)
+}
+
+// ============================================================================================================================
+// issuer_limits - add the limits of the issuers and issuer groups of the given securities to RQVEligibleValue
+// ============================================================================================================================
+func issuer_limits(RQV amount.Amount, CombinedSecurities []Securities, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) error {
+	for _, valueSecurity := range CombinedSecurities {
+		if valueSecurity.Issuer == "" {
+			continue
+		}
+		if limit, found := issuer_limit(valueSecurity.Issuer, Ruleset); found {
+			value, err := concentration_limit(RQV, limit)
+			if err != nil {
+				return errors.New(IssuerLimitKey + valueSecurity.Issuer + ": " + err.Error())
+			}
+			RQVEligibleValue[IssuerLimitKey+valueSecurity.Issuer] = value
+		}
+		group := Ruleset.IssuerGroup[valueSecurity.Issuer]
+		if limit, found := Ruleset.IssuerGroupLimit[group]; found && group != "" {
+			value, err := concentration_limit(RQV, limit)
+			if err != nil {
+				return errors.New(IssuerGroupLimitKey + group + ": " + err.Error())
+			}
+			RQVEligibleValue[IssuerGroupLimitKey+group] = value
+		}
+	}
+	return nil
+}
+
+// issuer_limit - limit in percent for an issuer, its own entry or the default one
+func issuer_limit(Issuer string, Ruleset Ruleset) (float64, bool) {
+	limit, found := Ruleset.IssuerLimit[Issuer]
+	if !found {
+		limit, found = Ruleset.IssuerLimit[DefaultIssuerLimit]
+	}
+	return limit, found
+}
+
+// concentration_keys - the limits a security counts against: its collateral form, and its issuer and issuer group when limited
+func concentration_keys(valueSecurity Securities, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) []string {
+	return limit_keys(valueSecurity, func(key string) bool {
+		_, found := RQVEligibleValue[key]
+		return found
+	}, Ruleset)
+}
+
+// limit_keys - concentration_keys for any set of limits, limited tells which issuer and issuer group keys are in it
+func limit_keys(valueSecurity Securities, limited func(string) bool, Ruleset Ruleset) []string {
+	keys := []string{valueSecurity.CollateralForm}
+	if valueSecurity.Issuer == "" {
+		return keys
+	}
+	if limited(IssuerLimitKey + valueSecurity.Issuer) {
+		keys = append(keys, IssuerLimitKey+valueSecurity.Issuer)
+	}
+	if group := Ruleset.IssuerGroup[valueSecurity.Issuer]; group != "" && limited(IssuerGroupLimitKey+group) {
+		keys = append(keys, IssuerGroupLimitKey+group)
+	}
+	return keys
+}
+
+// eligible_left - float64 copy of the limits for the allocation searches to count down
+func eligible_left(RQVEligibleValue map[string]amount.Amount) map[string]float64 {
+	RQVEligibleValueLeft := make(map[string]float64)
+	for key, value := range RQVEligibleValue {
+		RQVEligibleValueLeft[key] = value.Float64()
+	}
+	return RQVEligibleValueLeft
+}
+
+// concentration_left - value of the security that still fits under all of its limits
+func concentration_left(RQVEligibleValueLeft map[string]float64, valueSecurity Securities, Ruleset Ruleset) float64 {
+	left := math.Inf(1)
+	for _, key := range left_keys(valueSecurity, RQVEligibleValueLeft, Ruleset) {
+		left = math.Min(left, RQVEligibleValueLeft[key])
+	}
+	return left
+}
+
+// use_concentration - take value allocated of the security off each of its limits
+func use_concentration(RQVEligibleValueLeft map[string]float64, valueSecurity Securities, value float64, Ruleset Ruleset) {
+	for _, key := range left_keys(valueSecurity, RQVEligibleValueLeft, Ruleset) {
+		RQVEligibleValueLeft[key] -= value
+	}
+}
+
+// left_keys - concentration_keys in what is left of the limits
+func left_keys(valueSecurity Securities, RQVEligibleValueLeft map[string]float64, Ruleset Ruleset) []string {
+	return limit_keys(valueSecurity, func(key string) bool {
+		_, found := RQVEligibleValueLeft[key]
+		return found
+	}, Ruleset)
+}
+
+// min_amount - the smaller of two amounts
+func min_amount(a amount.Amount, b amount.Amount) amount.Amount {
+	if b.Cmp(a) < 0 {
+		return b
+	}
+	return a
+}
+
+// ============================================================================================================================
+// issuer_breaches - issuers and issuer groups in the segregated account over their share of its total value
+// ============================================================================================================================
+func issuer_breaches(SegregatedSecurities []Securities, Ruleset Ruleset) []IssuerBreach {
+	var totalValueSegregatedAccount float64
+	IssuerValue := make(map[string]float64)
+	GroupValue := make(map[string]float64)
+	for _, valueSecurity := range SegregatedSecurities {
+		totalValue := checked_float(valueSecurity.TotalValue)
+		totalValueSegregatedAccount += totalValue
+		if valueSecurity.Issuer == "" {
+			continue
+		}
+		IssuerValue[valueSecurity.Issuer] += totalValue
+		if group := Ruleset.IssuerGroup[valueSecurity.Issuer]; group != "" {
+			GroupValue[group] += totalValue
+		}
+	}
+
+	var Breaches []IssuerBreach
+	var issuers, groups []string
+	for key := range IssuerValue {
+		issuers = append(issuers, key)
+	}
+	for key := range GroupValue {
+		groups = append(groups, key)
+	}
+	sort.Strings(issuers)
+	sort.Strings(groups)
+	for _, issuer := range issuers {
+		limit, found := issuer_limit(issuer, Ruleset)
+		eligibleValue := (limit * totalValueSegregatedAccount) / 100
+		if found && IssuerValue[issuer] > eligibleValue+solverTolerance {
+			Breaches = append(Breaches, IssuerBreach{Issuer: issuer, Value: strconv.FormatFloat(IssuerValue[issuer], 'f', 2, 64), Limit: strconv.FormatFloat(eligibleValue, 'f', 2, 64)})
+		}
+	}
+	for _, group := range groups {
+		limit, found := Ruleset.IssuerGroupLimit[group]
+		eligibleValue := (limit * totalValueSegregatedAccount) / 100
+		if found && GroupValue[group] > eligibleValue+solverTolerance {
+			Breaches = append(Breaches, IssuerBreach{IssuerGroup: group, Value: strconv.FormatFloat(GroupValue[group], 'f', 2, 64), Limit: strconv.FormatFloat(eligibleValue, 'f', 2, 64)})
+		}
+	}
+	return Breaches
+}
+
+func issuer_breaches_json(breaches []IssuerBreach) string {
+	if len(breaches) == 0 {
+		return `[]`
+	}
+	breachesAsBytes, err := json.Marshal(breaches)
+	if err != nil {
+		fmt.Println("Error while converting IssuerBreach struct to string")
+		return `[]`
+	}
+	return string(breachesAsBytes)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+func TestConcentrationLimit(t *testing.T) {
+	tests := []struct {
+		rqv      string
+		currency string
+		limit    float64
+		want     string
+	}{
+		{"1000.00", "EUR", 35, "350.00"},
+		{"1000.01", "EUR", 35, "350.00"},
+		{"333.33", "USD", 33.33, "111.09"},
+		{"0.10", "EUR", 0.1, "0.00"},
+		{"1234567", "JPY", 12.5, "154320"},
+		{"100.000", "BHD", 100, "100.000"},
+	}
+	for _, test := range tests {
+		RQV, err := amount.ParseAmount(test.rqv, test.currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := concentration_limit(RQV, test.limit)
+		if err != nil || got.String() != test.want || got.Currency != test.currency {
+			t.Errorf("concentration_limit(%s %s, %v) = %s %s, %v, want %s", test.currency, test.rqv, test.limit, got, got.Currency, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// A field of a private ruleset that is looser than the public rule set allows
+type RulesetViolation struct {
+	CollateralForm string `json:"Collateral Form"`
+	Field          string `json:"Field"`
+	Private        string `json:"Private"`
+	Public         string `json:"Public"`
+	Reason         string `json:"Reason"`
+}
+
+// ============================================================================================================================
+// ruleset_conformance - check a private ruleset is a subset of the public rule set, field by field
+// Every collateral form has to be in the public rule set, its valuation percentages (flat and in every cell of its haircut
+// grid) no higher than the public one and its concentration limit no higher than the public one
+// ============================================================================================================================
+func ruleset_conformance(Private Ruleset, Public map[string]map[string]string) []RulesetViolation {
+	var Violations []RulesetViolation
+	var Forms []string
+	for CollateralForm := range Private.Security {
+		Forms = append(Forms, CollateralForm)
+	}
+	for CollateralForm := range Private.HaircutSchedule {
+		if _, found := Private.Security[CollateralForm]; !found {
+			Forms = append(Forms, CollateralForm)
+		}
+	}
+	sort.Strings(Forms)
+
+	for _, CollateralForm := range Forms {
+		PublicForm, found := Public[CollateralForm]
+		if !found {
+			Violations = append(Violations, RulesetViolation{CollateralForm: CollateralForm, Field: "Collateral Form", Private: CollateralForm, Reason: "Not in the public rule set"})
+			continue
+		}
+		PublicValuation, _ := strconv.ParseFloat(PublicForm["Valuation Percentage"], 64)
+		PublicLimit, _ := strconv.ParseFloat(PublicForm["Concentration Limit"], 64)
+
+		if Valuation, found := Private.Security[CollateralForm]["Valuation Percentage"]; found && Valuation > PublicValuation {
+			Violations = append(Violations, RulesetViolation{CollateralForm: CollateralForm, Field: "Valuation Percentage", Private: strconv.FormatFloat(Valuation, 'f', -1, 64), Public: PublicForm["Valuation Percentage"], Reason: "Haircut less conservative than the public rule set"})
+		}
+		if Limit, found := Private.Security[CollateralForm]["Concentration Limit"]; found && Limit > PublicLimit {
+			Violations = append(Violations, RulesetViolation{CollateralForm: CollateralForm, Field: "Concentration Limit", Private: strconv.FormatFloat(Limit, 'f', -1, 64), Public: PublicForm["Concentration Limit"], Reason: "Concentration limit looser than the public rule set"})
+		}
+		for _, cell := range Private.HaircutSchedule[CollateralForm] {
+			if cell.ValuationPercentage > PublicValuation {
+				Violations = append(Violations, RulesetViolation{CollateralForm: CollateralForm, Field: "Haircut Schedule " + haircut_cell_name(CollateralForm, cell), Private: strconv.FormatFloat(cell.ValuationPercentage, 'f', -1, 64), Public: PublicForm["Valuation Percentage"], Reason: "Haircut less conservative than the public rule set"})
+			}
+		}
+	}
+	return Violations
+}
+
+// ============================================================================================================================
+// ruleset_conformance_error - the errEvent message of an allocation refused as the private ruleset is looser than the public one
+// ============================================================================================================================
+func ruleset_conformance_error(Pledger string, Pledgee string, Version int, Violations []RulesetViolation) string {
+	violationsAsBytes, _ := json.Marshal(Violations)
+	return "{ \"pledger\" : \"" + Pledger + "\", \"pledgee\" : \"" + Pledgee + "\", \"version\" : \"" + strconv.Itoa(Version) + "\", \"message\" : \"Private Security Ruleset does not conform to the public rule set.\", \"Violations\" : " + string(violationsAsBytes) + ", \"code\" : \"503\"}"
+}
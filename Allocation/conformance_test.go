@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRulesetConformance(t *testing.T) {
+	tests := []struct {
+		name       string
+		private    Ruleset
+		violations []string // collateral form: field
+	}{
+		{"tighter than the public rule set", Ruleset{Security: map[string]map[string]float64{
+			"Govt Securities": {"Valuation Percentage": 90, "Concentration Limit": 40, "Priority": 1},
+			"Equities":        {"Valuation Percentage": 85, "Concentration Limit": 10, "Priority": 2},
+		}}, nil},
+		{"no ruleset at all", Ruleset{}, nil},
+		{"haircut and limit looser", Ruleset{Security: map[string]map[string]float64{
+			"Equities": {"Valuation Percentage": 90, "Concentration Limit": 20},
+		}}, []string{"Equities: Valuation Percentage", "Equities: Concentration Limit"}},
+		{"form the public rule set does not have", Ruleset{Security: map[string]map[string]float64{
+			"Gold":            {"Valuation Percentage": 50},
+			"Corporate Bonds": {"Valuation Percentage": 88, "Concentration Limit": 10},
+		}}, []string{"Gold: Collateral Form"}},
+		{"haircut grid cell looser", Ruleset{
+			Security: map[string]map[string]float64{"Corporate Bonds": {"Valuation Percentage": 80, "Concentration Limit": 5}},
+			HaircutSchedule: map[string][]HaircutCell{"Corporate Bonds": {
+				{MaturityTo: 5, MinimumRating: "AA-", ValuationPercentage: 90},
+				{MaturityFrom: 5, ValuationPercentage: 80},
+			}},
+		}, []string{"Corporate Bonds: Haircut Schedule Corporate Bonds, 0Y-5Y, AA- or better"}},
+		{"haircut grid without a flat entry", Ruleset{
+			HaircutSchedule: map[string][]HaircutCell{"Medium Term Notes": {{ValuationPercentage: 84}}, "Bitcoin": {{ValuationPercentage: 10}}},
+		}, []string{"Bitcoin: Collateral Form", "Medium Term Notes: Haircut Schedule Medium Term Notes, Any maturity, Any rating"}},
+	}
+	for _, test := range tests {
+		var violations []string
+		for _, violation := range ruleset_conformance(test.private, SecurityJSON) {
+			violations = append(violations, violation.CollateralForm+": "+violation.Field)
+		}
+		if !reflect.DeepEqual(violations, test.violations) {
+			t.Errorf("%s: ruleset_conformance = %q, want %q", test.name, violations, test.violations)
+		}
+	}
+}
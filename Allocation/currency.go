@@ -0,0 +1,69 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+)
+
+// Valuation percentage points taken off a security in another currency than the RQV, when the ruleset does not set FXMismatchHaircut
+const DefaultFXMismatchHaircut = 8.0
+
+// currency_eligible - whether the security's currency is one the ruleset accepts, any currency when it lists none
+func currency_eligible(valueSecurity Securities, Ruleset Ruleset) bool {
+	if len(Ruleset.EligibleCurrency) == 0 {
+		return true
+	}
+	for _, currency := range Ruleset.EligibleCurrency {
+		if strings.TrimSpace(currency) == valueSecurity.Currency {
+			return true
+		}
+	}
+	return false
+}
+
+// currency_reason - why a security's currency is not eligible, for the reports
+func currency_reason(valueSecurity Securities, Ruleset Ruleset) string {
+	return valueSecurity.SecurityId + " in " + valueSecurity.Currency + ", not an eligible currency (" + strings.Join(Ruleset.EligibleCurrency, ",") + ")"
+}
+
+// fx_mismatch_haircut - valuation percentage points taken off a security whose currency differs from the RQV currency
+func fx_mismatch_haircut(valueSecurity Securities, RQVCurrency string, Ruleset Ruleset) float64 {
+	if valueSecurity.Currency == RQVCurrency {
+		return 0
+	}
+	if Ruleset.FXMismatchHaircut != nil {
+		return *Ruleset.FXMismatchHaircut
+	}
+	return DefaultFXMismatchHaircut
+}
+
+// ============================================================================================================================
+// currency_breaches - reasons for each security in the segregated account in a currency the ruleset does not accept
+// ============================================================================================================================
+func currency_breaches(SegregatedSecurities []Securities, Ruleset Ruleset) []string {
+	var Reasons []string
+	for _, valueSecurity := range SegregatedSecurities {
+		if !currency_eligible(valueSecurity, Ruleset) {
+			Reasons = append(Reasons, currency_reason(valueSecurity, Ruleset))
+		}
+	}
+	return Reasons
+}
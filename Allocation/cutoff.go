@@ -0,0 +1,82 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Allocation cutoff of a deal as the 'Deal' chaincode resolves it
+type Cutoffs struct {
+	Scope        string `json:"scope"`        // Deal, Pledgee or Default
+	CutoffTime   string `json:"cutoffTime"`   // HH:MM local time
+	Timezone     string `json:"timezone"`     // IANA time zone
+	BusinessDays string `json:"businessDays"` // comma separated weekdays, empty for every day
+	Holidays     string `json:"holidays"`     // comma separated YYYY-MM-DD dates
+}
+
+// cutoff_string - the cutoff as it is reported in events, e.g. "18:00 Europe/London Mon,Tue,Wed,Thu,Fri"
+func cutoff_string(cutoff Cutoffs) string {
+	description := cutoff.CutoffTime + " " + cutoff.Timezone
+	if cutoff.BusinessDays != "" {
+		description += " " + cutoff.BusinessDays
+	}
+	if cutoff.Holidays != "" {
+		description += " excluding " + cutoff.Holidays
+	}
+	return description
+}
+
+// ============================================================================================================================
+// within_cutoff - whether a transaction timestamp falls before the cutoff on a business day, in the cutoff's time zone
+// Returns the local time it was evaluated at, or an error message when the cutoff cannot be read
+// ============================================================================================================================
+func within_cutoff(cutoff Cutoffs, seconds int64) (bool, string, string) {
+	location, err := time.LoadLocation(cutoff.Timezone)
+	if err != nil || cutoff.Timezone == "" {
+		return false, "", "Unknown time zone " + cutoff.Timezone
+	}
+	cutoffTime, err := time.Parse("15:04", cutoff.CutoffTime)
+	if err != nil {
+		return false, "", "Invalid cutoff time " + cutoff.CutoffTime
+	}
+	local := time.Unix(seconds, 0).In(location)
+	localTime := local.Format("2006-01-02 15:04:05 MST")
+
+	if cutoff.BusinessDays != "" {
+		businessDay := false
+		for _, val := range strings.Split(cutoff.BusinessDays, ",") {
+			if strings.TrimSpace(val) == local.Weekday().String()[:3] {
+				businessDay = true
+			}
+		}
+		if !businessDay {
+			return false, localTime, ""
+		}
+	}
+	for _, val := range strings.Split(cutoff.Holidays, ",") {
+		if strings.TrimSpace(val) == local.Format("2006-01-02") {
+			return false, localTime, ""
+		}
+	}
+	minutes := local.Hour()*60 + local.Minute()
+	return minutes < cutoffTime.Hour()*60+cutoffTime.Minute(), localTime, ""
+}
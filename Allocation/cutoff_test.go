@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestWithinCutoff(t *testing.T) {
+	london := Cutoffs{CutoffTime: "18:00", Timezone: "Europe/London", BusinessDays: "Mon,Tue,Wed,Thu,Fri", Holidays: "2024-12-25"}
+	tokyo := Cutoffs{CutoffTime: "15:00", Timezone: "Asia/Tokyo", BusinessDays: "Mon,Tue,Wed,Thu,Fri"}
+	tests := []struct {
+		name      string
+		cutoff    Cutoffs
+		seconds   int64
+		within    bool
+		localTime string
+		errMsg    string
+	}{
+		{"summer time, a minute before", london, 1719853140, true, "2024-07-01 17:59:00 BST", ""},
+		{"summer time, at the cutoff", london, 1719853200, false, "2024-07-01 18:00:00 BST", ""},
+		{"winter time, a minute before", london, 1705341540, true, "2024-01-15 17:59:00 GMT", ""},
+		{"winter time, at the cutoff", london, 1705341600, false, "2024-01-15 18:00:00 GMT", ""},
+		{"saturday", london, 1720260000, false, "2024-07-06 11:00:00 BST", ""},
+		{"holiday", london, 1735120800, false, "2024-12-25 10:00:00 GMT", ""},
+		{"every day when no business days are set", Cutoffs{CutoffTime: "18:00", Timezone: "America/New_York"}, 1719871140, true, "2024-07-01 17:59:00 EDT", ""},
+		{"after the cutoff in local time", tokyo, 1719815400, false, "2024-07-01 15:30:00 JST", ""},
+		{"local monday while it is still sunday in UTC", tokyo, 1719790200, true, "2024-07-01 08:30:00 JST", ""},
+		{"unknown time zone", Cutoffs{CutoffTime: "18:00", Timezone: "Mars/Olympus"}, 1719853140, false, "", "Unknown time zone Mars/Olympus"},
+		{"no time zone", Cutoffs{CutoffTime: "18:00"}, 1719853140, false, "", "Unknown time zone "},
+		{"invalid cutoff time", Cutoffs{CutoffTime: "6pm", Timezone: "UTC"}, 1719853140, false, "", "Invalid cutoff time 6pm"},
+	}
+	for _, test := range tests {
+		within, localTime, errMsg := within_cutoff(test.cutoff, test.seconds)
+		if within != test.within || localTime != test.localTime || errMsg != test.errMsg {
+			t.Errorf("%s: within_cutoff = %v, %q, %q, want %v, %q, %q", test.name, within, localTime, errMsg, test.within, test.localTime, test.errMsg)
+		}
+	}
+}
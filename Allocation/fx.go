@@ -0,0 +1,393 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var FXSettingsStr = "_fxSettings" //name for the key/value that will store which FX provider the allocation reads rates from
+var FXRatePrefix = "_fxRates_"    //prefix of the key the published rates of a base currency are stored under
+
+// FXProvider quotes exchange rates, Rates[X] being the units of X one unit of the returned Base buys.
+// A provider answers in the base asked for when it can and in its own base otherwise, rates it does not have are left out.
+type FXProvider interface {
+	Name() string
+	Quotes(stub shim.ChaincodeStubInterface, Base string) (CurrencyConversion, string, error)
+}
+
+// Which FX provider to use and how to reach it, set with set_fx_provider
+type FXSettings struct {
+	Provider  string `json:"provider"`  // Ledger, ECB or HTTP
+	Pivot     string `json:"pivot"`     // currency cross rates are triangulated through
+	Source    string `json:"source"`    // URL of the ECB file, or of the HTTP provider with {base} for the base currency
+	Publisher string `json:"publisher"` // who may publish rates to the Ledger provider
+}
+
+// Provider used until set_fx_provider is called
+var DefaultFXSettings = FXSettings{Provider: "Ledger", Pivot: "EUR"}
+
+// Providers set_fx_provider can name
+var FXProviders = map[string]func(FXSettings) FXProvider{
+	"Ledger": func(settings FXSettings) FXProvider { return LedgerFXProvider{} },
+	"ECB":    func(settings FXSettings) FXProvider { return ECBFXProvider{settings.Source} },
+	"HTTP":   func(settings FXSettings) FXProvider { return HTTPFXProvider{settings.Source} },
+}
+
+// ============================================================================================================================
+// fetch_conversion_rates - exchange rates with RQVCurrency as the base from the configured FX provider
+// Currencies the provider has no direct rate for are crossed through the pivot currency, and listed as Triangulated
+// ============================================================================================================================
+func fetch_conversion_rates(stub shim.ChaincodeStubInterface, RQVCurrency string) (CurrencyConversion, string, error) {
+	var ConversionRate CurrencyConversion
+	Settings, err := fx_settings(stub)
+	if err != nil {
+		return ConversionRate, "", err
+	}
+	Provider := FXProviders[Settings.Provider](Settings)
+
+	Direct, errMsg, err := Provider.Quotes(stub, RQVCurrency)
+	if err != nil || (errMsg != "" && Settings.Pivot == RQVCurrency) {
+		return ConversionRate, errMsg, err
+	}
+	if errMsg != "" {
+		// No quotes in the RQV currency, all of them are crossed through the pivot
+		fmt.Println(errMsg)
+		Direct = CurrencyConversion{Base: RQVCurrency, Rates: make(map[string]float64)}
+	}
+	ConversionRate = CurrencyConversion{Base: RQVCurrency, Date: Direct.Date, Rates: make(map[string]float64), Provider: Provider.Name()}
+	if Direct.Base == RQVCurrency {
+		for currency, rate := range Direct.Rates {
+			ConversionRate.Rates[currency] = rate
+		}
+	}
+
+	// Cross the rates of the pivot, or of the provider's own base, for whatever it has no direct rate for
+	Pivot := Direct
+	if Pivot.Base == RQVCurrency && Settings.Pivot != RQVCurrency {
+		Pivot, errMsg, err = Provider.Quotes(stub, Settings.Pivot)
+		if err != nil || errMsg != "" {
+			return ConversionRate, errMsg, err
+		}
+	}
+	if PivotRate := Pivot.Rates[RQVCurrency]; Pivot.Base != RQVCurrency && PivotRate > 0 {
+		Pivot.Rates[Pivot.Base] = 1
+		for currency, rate := range Pivot.Rates {
+			if _, found := ConversionRate.Rates[currency]; !found && currency != RQVCurrency {
+				ConversionRate.Rates[currency] = rate / PivotRate
+				ConversionRate.Triangulated = append(ConversionRate.Triangulated, currency)
+			}
+		}
+		sort.Strings(ConversionRate.Triangulated)
+		ConversionRate.Pivot = Pivot.Base
+		if ConversionRate.Date == "" {
+			ConversionRate.Date = Pivot.Date
+		}
+	}
+	if len(ConversionRate.Rates) == 0 {
+		errMsg = "{ \"message\" : \"No exchange rates for " + RQVCurrency + " from the " + Provider.Name() + " FX provider.\", \"code\" : \"503\"}"
+		return ConversionRate, errMsg, nil
+	}
+
+	fmt.Println("Exchange Rate : ")
+	fmt.Println(ConversionRate)
+	return ConversionRate, "", nil
+}
+
+// fx_settings - the FX provider settings on the ledger, the defaults when none were set
+func fx_settings(stub shim.ChaincodeStubInterface) (FXSettings, error) {
+	settingsAsBytes, err := stub.GetState(FXSettingsStr)
+	if err != nil {
+		return DefaultFXSettings, errors.New("Failed to get FX provider settings")
+	}
+	if len(settingsAsBytes) == 0 {
+		return DefaultFXSettings, nil
+	}
+	Settings := FXSettings{}
+	json.Unmarshal(settingsAsBytes, &Settings)
+	return Settings, nil
+}
+
+// rates_snapshot - the rates an allocation used, as update_transaction takes Transactions.CurrencyConversionRate
+func rates_snapshot(ConversionRate CurrencyConversion) string {
+	snapshotAsBytes, _ := json.Marshal(ConversionRate)
+	return json_string(string(snapshotAsBytes))
+}
+
+// json_string - a value quoted and escaped as a json string, for arguments the 'Deal' chaincode pastes into its json as is
+func json_string(value string) string {
+	quotedAsBytes, _ := json.Marshal(value)
+	return string(quotedAsBytes)
+}
+
+// ============================================================================================================================
+// set_fx_provider - the allocation administrator chooses where exchange rates come from
+// Arguments : provider (Ledger, ECB or HTTP), pivot currency, source URL (ECB and HTTP), publisher (Ledger)
+// ============================================================================================================================
+func (t *ManageAllocations) set_fx_provider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 4 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 4\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start set_fx_provider")
+	Settings := FXSettings{Provider: args[0], Pivot: strings.TrimSpace(args[1]), Source: strings.TrimSpace(args[2]), Publisher: strings.TrimSpace(args[3])}
+
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := ""
+	if !isAdmin {
+		errMsg = "{ \"message\" : \"Only the allocation administrator can set the FX provider.\", \"code\" : \"503\"}"
+	} else if _, found := FXProviders[Settings.Provider]; !found {
+		errMsg = "{ \"message\" : \"Unknown FX provider " + Settings.Provider + ", expecting Ledger, ECB or HTTP.\", \"code\" : \"503\"}"
+	} else if Settings.Pivot == "" {
+		errMsg = "{ \"message\" : \"Pivot currency is required.\", \"code\" : \"503\"}"
+	} else if Settings.Provider != "Ledger" && !strings.HasPrefix(Settings.Source, "http") {
+		errMsg = "{ \"message\" : \"The " + Settings.Provider + " FX provider needs the URL it is read from.\", \"code\" : \"503\"}"
+	} else if Settings.Provider == "Ledger" && Settings.Publisher == "" {
+		errMsg = "{ \"message\" : \"The Ledger FX provider needs the publisher allowed to publish rates.\", \"code\" : \"503\"}"
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	jsonAsBytes, _ := json.Marshal(Settings)
+	err = stub.PutState(FXSettingsStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"provider\" : \"" + Settings.Provider + "\", \"pivot\" : \"" + Settings.Pivot + "\", \"message\" : \"FX provider set succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end set_fx_provider")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getFXProvider - the FX provider settings in use
+// ============================================================================================================================
+func (t *ManageAllocations) getFXProvider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	Settings, err := fx_settings(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Settings)
+}
+
+//-----------------------------------------------------------------------------
+
+// LedgerFXProvider reads the rates an authorised publisher stored with publish_fx_rates
+type LedgerFXProvider struct{}
+
+func (p LedgerFXProvider) Name() string { return "Ledger" }
+
+func (p LedgerFXProvider) Quotes(stub shim.ChaincodeStubInterface, Base string) (CurrencyConversion, string, error) {
+	Quotes := CurrencyConversion{}
+	ratesAsBytes, err := stub.GetState(FXRatePrefix + Base)
+	if err != nil {
+		return Quotes, "", errors.New("Failed to get exchange rates of " + Base)
+	}
+	json.Unmarshal(ratesAsBytes, &Quotes)
+	if Quotes.Base != Base {
+		// Nothing published for this base, the pivot may still cross it
+		return CurrencyConversion{Base: Base, Rates: make(map[string]float64)}, "", nil
+	}
+	return Quotes, "", nil
+}
+
+// ============================================================================================================================
+// publish_fx_rates - the Ledger FX provider's publisher stores the day's rates of a base currency
+// Arguments : base currency, date, followed by CURRENCY:rate pairs. The caller is the publisher.
+// ============================================================================================================================
+func (t *ManageAllocations) publish_fx_rates(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) < 3 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting base currency, date and at least one CURRENCY:rate\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start publish_fx_rates")
+	Publisher := caller_id(stub)
+	Quotes := CurrencyConversion{Base: strings.TrimSpace(args[0]), Date: args[1], Rates: make(map[string]float64)}
+
+	Settings, err := fx_settings(stub)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := ""
+	if Settings.Provider != "Ledger" || Publisher == "" || Publisher != Settings.Publisher {
+		errMsg = "{ \"message\" : \"" + Publisher + " is not the publisher of the Ledger FX provider.\", \"code\" : \"503\"}"
+	}
+	for _, pair := range args[2:] {
+		parts := strings.Split(pair, ":")
+		if errMsg != "" {
+			break
+		}
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			errMsg = "{ \"message\" : \"Invalid rate " + pair + ", expecting CURRENCY:rate.\", \"code\" : \"503\"}"
+			break
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || rate <= 0 {
+			errMsg = "{ \"message\" : \"Invalid rate " + pair + ", expecting a positive number.\", \"code\" : \"503\"}"
+			break
+		}
+		Quotes.Rates[strings.TrimSpace(parts[0])] = rate
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	jsonAsBytes, _ := json.Marshal(Quotes)
+	err = stub.PutState(FXRatePrefix+Quotes.Base, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"base\" : \"" + Quotes.Base + "\", \"date\" : \"" + Quotes.Date + "\", \"message\" : \"Exchange rates published succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end publish_fx_rates")
+	return nil, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ECBFXProvider reads an ECB style daily reference rates file, euro based
+// <gesmes:Envelope><Cube><Cube time="2017-03-20"><Cube currency="USD" rate="1.0745"/>...</Cube></Cube></gesmes:Envelope>
+type ECBFXProvider struct {
+	URL string
+}
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+func (p ECBFXProvider) Name() string { return "ECB" }
+
+func (p ECBFXProvider) Quotes(stub shim.ChaincodeStubInterface, Base string) (CurrencyConversion, string, error) {
+	Quotes := CurrencyConversion{Base: "EUR", Rates: make(map[string]float64)}
+	resp, errMsg := fx_get(p.URL)
+	if errMsg != "" {
+		return Quotes, errMsg, nil
+	}
+	defer resp.Body.Close()
+
+	Envelope := ecbEnvelope{}
+	if err := xml.NewDecoder(resp.Body).Decode(&Envelope); err != nil || len(Envelope.Days) == 0 {
+		errMsg := "{ \"message\" : \"Unreadable ECB reference rates from: " + p.URL + ".\", \"code\" : \"503\"}"
+		return Quotes, errMsg, nil
+	}
+	// The file lists the latest day first
+	Quotes.Date = Envelope.Days[0].Time
+	for _, line := range Envelope.Days[0].Rates {
+		rate, err := strconv.ParseFloat(line.Rate, 64)
+		if err == nil && rate > 0 {
+			Quotes.Rates[line.Currency] = rate
+		}
+	}
+	return Quotes, "", nil
+}
+
+//-----------------------------------------------------------------------------
+
+// HTTPFXProvider reads {"base": "USD", "date": "2017-03-20", "rates": {"EUR": 0.93006, ...}} from a URL, {base} in it
+// is replaced with the base currency asked for
+type HTTPFXProvider struct {
+	URL string
+}
+
+func (p HTTPFXProvider) Name() string { return "HTTP" }
+
+func (p HTTPFXProvider) Quotes(stub shim.ChaincodeStubInterface, Base string) (CurrencyConversion, string, error) {
+	Quotes := CurrencyConversion{}
+	url := strings.Replace(p.URL, "{base}", Base, -1)
+	resp, errMsg := fx_get(url)
+	if errMsg != "" {
+		return Quotes, errMsg, nil
+	}
+	defer resp.Body.Close()
+
+	var Response struct {
+		Base  string             `json:"base"`
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&Response); err != nil || Response.Base == "" {
+		errMsg := "{ \"message\" : \"Unreadable Currency Exchange Rates from: " + url + ".\", \"code\" : \"503\"}"
+		return Quotes, errMsg, nil
+	}
+	Quotes = CurrencyConversion{Base: Response.Base, Date: Response.Date, Rates: make(map[string]float64)}
+	for currency, rate := range Response.Rates {
+		if rate > 0 {
+			Quotes.Rates[currency] = rate
+		}
+	}
+	return Quotes, "", nil
+}
+
+// fx_get - GET a rates URL, the errEvent message when it does not answer with 200
+func fx_get(url string) (*http.Response, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		fmt.Println("Do: ", err)
+		return nil, "{ \"message\" : \"Unable to fetch Currency Exchange Rates from: " + url + ".\", \"code\" : \"503\"}"
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "{ \"message\" : \"Currency Exchange Rates from: " + url + " answered " + strconv.Itoa(resp.StatusCode) + ".\", \"code\" : \"503\"}"
+	}
+	return resp, ""
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// stateStub answers GetState from a map, the only call the Ledger FX provider makes
+type stateStub struct {
+	shim.ChaincodeStubInterface
+	State map[string][]byte
+}
+
+func (stub stateStub) GetState(key string) ([]byte, error) { return stub.State[key], nil }
+
+func TestFetchConversionRatesTriangulation(t *testing.T) {
+	published := func(quotes ...CurrencyConversion) stateStub {
+		stub := stateStub{State: make(map[string][]byte)}
+		for _, quote := range quotes {
+			quoteAsBytes, _ := json.Marshal(quote)
+			stub.State[FXRatePrefix+quote.Base] = quoteAsBytes
+		}
+		return stub
+	}
+	EUR := CurrencyConversion{Base: "EUR", Date: "2017-03-01", Rates: map[string]float64{"USD": 1.10, "GBP": 0.85, "JPY": 160}}
+	USD := CurrencyConversion{Base: "USD", Date: "2017-03-02", Rates: map[string]float64{"JPY": 145}}
+
+	tests := []struct {
+		name         string
+		stub         stateStub
+		rqvCurrency  string
+		rates        map[string]float64
+		triangulated []string
+		pivot        string
+		date         string
+		failed       bool
+	}{
+		{"direct rates kept, the rest crossed through the pivot", published(EUR, USD), "USD",
+			map[string]float64{"JPY": 145, "EUR": 1 / 1.10, "GBP": 0.85 / 1.10}, []string{"EUR", "GBP"}, "EUR", "2017-03-02", false},
+		{"nothing published in the RQV currency", published(EUR), "USD",
+			map[string]float64{"JPY": 160 / 1.10, "EUR": 1 / 1.10, "GBP": 0.85 / 1.10}, []string{"EUR", "GBP", "JPY"}, "EUR", "2017-03-01", false},
+		{"RQV in the pivot currency", published(EUR, USD), "EUR",
+			map[string]float64{"USD": 1.10, "GBP": 0.85, "JPY": 160}, nil, "", "2017-03-01", false},
+		{"pivot has no rate for the RQV currency", published(EUR), "CHF", nil, nil, "", "", true},
+		{"nothing published", published(), "EUR", nil, nil, "", "", true},
+	}
+	for _, test := range tests {
+		ConversionRate, errMsg, err := fetch_conversion_rates(test.stub, test.rqvCurrency)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.failed {
+			if errMsg == "" {
+				t.Errorf("%s: rates %v, want an errEvent message", test.name, ConversionRate.Rates)
+			}
+			continue
+		}
+		if errMsg != "" {
+			t.Errorf("%s: %s", test.name, errMsg)
+			continue
+		}
+		if len(ConversionRate.Rates) != len(test.rates) {
+			t.Errorf("%s: rates %v, want %v", test.name, ConversionRate.Rates, test.rates)
+		}
+		for currency, rate := range test.rates {
+			if math.Abs(ConversionRate.Rates[currency]-rate) > 1e-12 {
+				t.Errorf("%s: rate of %s = %v, want %v", test.name, currency, ConversionRate.Rates[currency], rate)
+			}
+		}
+		if !reflect.DeepEqual(ConversionRate.Triangulated, test.triangulated) || ConversionRate.Pivot != test.pivot {
+			t.Errorf("%s: triangulated %v through %q, want %v through %q", test.name, ConversionRate.Triangulated, ConversionRate.Pivot, test.triangulated, test.pivot)
+		}
+		if ConversionRate.Base != test.rqvCurrency || ConversionRate.Date != test.date || ConversionRate.Provider != "Ledger" {
+			t.Errorf("%s: %s rates of %s from %s, want %s rates of %s from Ledger", test.name, ConversionRate.Base, ConversionRate.Date, ConversionRate.Provider, test.rqvCurrency, test.date)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// One cell of a haircut grid, a residual maturity bucket crossed with a rating band
+type HaircutCell struct {
+	MaturityFrom        float64 `json:"MaturityFrom"`  // residual maturity in years, inclusive
+	MaturityTo          float64 `json:"MaturityTo"`    // residual maturity in years, exclusive, 0 leaves the bucket open ended
+	MinimumRating       string  `json:"MinimumRating"` // worst rating the band covers, empty covers any rating
+	ValuationPercentage float64 `json:"Valuation Percentage"`
+}
+
+// Cell reported for collateral forms valued with the flat Valuation Percentage
+const FlatHaircutCell = "Flat"
+
+// residual_maturity - years left until the security matures as of the given time, false when it has no maturity date
+func residual_maturity(valueSecurity Securities, AsOf string) (float64, bool) {
+	maturity, errBool := strconv.ParseInt(valueSecurity.MaturityDate, 10, 64)
+	if errBool != nil {
+		return 0, false
+	}
+	asOf, errBool := strconv.ParseInt(AsOf, 10, 64)
+	if errBool != nil {
+		fmt.Println(errBool)
+	}
+	return float64(maturity-asOf) / (365.25 * 24 * 60 * 60), true
+}
+
+// ============================================================================================================================
+// haircut_cell - valuation percentage of the security from the haircut grid of its collateral form, and the cell it came from
+// Forms without a grid keep the flat Valuation Percentage. A security that fits no cell of its grid is not eligible.
+// ============================================================================================================================
+func haircut_cell(valueSecurity Securities, AsOf string, Ruleset Ruleset) (float64, string, bool) {
+	Grid := Ruleset.HaircutSchedule[valueSecurity.CollateralForm]
+	if len(Grid) == 0 {
+		return Ruleset.Security[valueSecurity.CollateralForm]["Valuation Percentage"], FlatHaircutCell, true
+	}
+	maturity, hasMaturity := residual_maturity(valueSecurity, AsOf)
+	notch, _, rated := security_rating(valueSecurity)
+	// Cells are listed best rating band first, so the first one that fits is the one the security belongs to
+	for _, cell := range Grid {
+		if hasMaturity {
+			if maturity < cell.MaturityFrom || (cell.MaturityTo > 0 && maturity >= cell.MaturityTo) {
+				continue
+			}
+		} else if cell.MaturityFrom > 0 || cell.MaturityTo > 0 {
+			continue
+		}
+		if cell.MinimumRating != "" {
+			minimumNotch, found := rating_notch(cell.MinimumRating)
+			if !found || !rated || notch > minimumNotch {
+				continue
+			}
+		}
+		return cell.ValuationPercentage, haircut_cell_name(valueSecurity.CollateralForm, cell), true
+	}
+	return 0, "", false
+}
+
+// haircut_reason - why a security is not eligible under the haircut grid of its collateral form, for the reports
+func haircut_reason(valueSecurity Securities) string {
+	return valueSecurity.SecurityId + " fits no cell of the " + valueSecurity.CollateralForm + " haircut grid for its residual maturity and rating, not eligible"
+}
+
+// haircut_cell_name - e.g. "Govt Securities, 1Y-5Y, AA- or better"
+func haircut_cell_name(CollateralForm string, cell HaircutCell) string {
+	bucket := "Any maturity"
+	if cell.MaturityTo > 0 {
+		bucket = strconv.FormatFloat(cell.MaturityFrom, 'f', -1, 64) + "Y-" + strconv.FormatFloat(cell.MaturityTo, 'f', -1, 64) + "Y"
+	} else if cell.MaturityFrom > 0 {
+		bucket = strconv.FormatFloat(cell.MaturityFrom, 'f', -1, 64) + "Y+"
+	}
+	band := "Any rating"
+	if cell.MinimumRating != "" {
+		band = cell.MinimumRating + " or better"
+	}
+	return CollateralForm + ", " + bucket + ", " + band
+}
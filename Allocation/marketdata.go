@@ -0,0 +1,207 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/mukutb/TCM-new/amount"
+)
+
+var MarketDataPolicyStr = "_marketDataPolicy" //name for the key/value that will store how fresh market data has to be
+
+// Status a margin call is left in when its market data does not pass validate_market_data
+const MarketDataBlockedStatus = "Allocation Blocked - Market Data"
+
+// How fresh market data has to be for an allocation to use it, set with set_market_data_policy
+type MarketDataPolicy struct {
+	MaxPriceAge string `json:"maxPriceAge"` // seconds a price may be older than the transaction using it
+}
+
+// Policy used until set_market_data_policy is called, a day
+var DefaultMarketDataPolicy = MarketDataPolicy{MaxPriceAge: "86400"}
+
+// A security whose market data an allocation cannot use, and why
+type MarketDataIssue struct {
+	SecurityId string `json:"Security ID"`
+	Currency   string `json:"Currency"`
+	Reason     string `json:"Reason"`
+}
+
+// ============================================================================================================================
+// validate_market_data - price every security an allocation values as of AsOf and check the prices and rates before anything moves
+// Each security needs a positive price no older than the policy allows in its own currency and a positive rate to RQVCurrency.
+// Price age is measured against the time the transaction was submitted, not a time the caller supplies.
+// Returns the prices by security ID and an issue per offending security.
+// ============================================================================================================================
+func validate_market_data(stub shim.ChaincodeStubInterface, PriceChaincode string, Priced []Securities, ConversionRate CurrencyConversion, RQVCurrency string, AsOf string) (map[string]Prices, []MarketDataIssue, error) {
+	Policy, err := market_data_policy(stub)
+	if err != nil {
+		return nil, nil, err
+	}
+	MaxPriceAge, _ := strconv.ParseInt(Policy.MaxPriceAge, 10, 64)
+	// Without the transaction's time no price can be shown fresh enough, every security is held up
+	var now int64
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil || txTimestamp == nil || txTimestamp.Seconds <= 0 {
+		fmt.Println("No transaction timestamp to measure price age against")
+	} else {
+		now = txTimestamp.Seconds
+	}
+
+	Latest := make(map[string]Prices)
+	var Issues []MarketDataIssue
+	Checked := make(map[string]bool)
+	for _, valueSecurity := range Priced {
+		if Checked[valueSecurity.SecurityId] {
+			continue
+		}
+		Checked[valueSecurity.SecurityId] = true
+		issue := func(reason string) {
+			Issues = append(Issues, MarketDataIssue{SecurityId: valueSecurity.SecurityId, Currency: valueSecurity.Currency, Reason: reason})
+		}
+		Price, errMsg, err := fetch_price(stub, PriceChaincode, valueSecurity.SecurityId, AsOf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if errMsg != "" {
+			issue("No market price")
+			continue
+		}
+		if price, err := amount.ParseRate(Price.Price); err != nil || price.Sign() <= 0 {
+			issue("Market price " + Price.Price + " is not a positive number")
+			continue
+		}
+		if Price.Currency != "" && valueSecurity.Currency != "" && Price.Currency != valueSecurity.Currency {
+			issue("Market price is in " + Price.Currency + ", the security in " + valueSecurity.Currency)
+			continue
+		}
+		if timestamp, err := strconv.ParseInt(Price.Timestamp, 10, 64); err != nil {
+			issue("Market price has no valid timestamp")
+			continue
+		} else if now == 0 {
+			issue("No transaction timestamp to measure the age of the market price against")
+			continue
+		} else if now-timestamp > MaxPriceAge {
+			issue("Market price of " + Price.Timestamp + " is more than " + Policy.MaxPriceAge + " seconds old")
+			continue
+		}
+		Latest[valueSecurity.SecurityId] = Price
+	}
+
+	// Every security valued is converted to the RQV currency
+	Converted := make(map[string]bool)
+	for _, valueSecurity := range Priced {
+		if valueSecurity.Currency == RQVCurrency || Converted[valueSecurity.SecurityId] {
+			continue
+		}
+		Converted[valueSecurity.SecurityId] = true
+		if ConversionRate.Rates[valueSecurity.Currency] <= 0 {
+			Issues = append(Issues, MarketDataIssue{SecurityId: valueSecurity.SecurityId, Currency: valueSecurity.Currency, Reason: "No conversion rate from " + valueSecurity.Currency + " to " + RQVCurrency})
+		}
+	}
+	return Latest, Issues, nil
+}
+
+// ============================================================================================================================
+// market_data_error - the errEvent message of an allocation blocked by its market data, listing every offending security
+// ============================================================================================================================
+func market_data_error(TransactionID string, Issues []MarketDataIssue) string {
+	issuesAsBytes, _ := json.Marshal(Issues)
+	return "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + MarketDataBlockedStatus + "\", \"Offending Securities\" : " + string(issuesAsBytes) + ", \"code\" : \"503\"}"
+}
+
+// market_data_policy - the market data policy on the ledger, the default when none was set
+func market_data_policy(stub shim.ChaincodeStubInterface) (MarketDataPolicy, error) {
+	policyAsBytes, err := stub.GetState(MarketDataPolicyStr)
+	if err != nil {
+		return DefaultMarketDataPolicy, errors.New("Failed to get market data policy")
+	}
+	if len(policyAsBytes) == 0 {
+		return DefaultMarketDataPolicy, nil
+	}
+	Policy := MarketDataPolicy{}
+	json.Unmarshal(policyAsBytes, &Policy)
+	return Policy, nil
+}
+
+// ============================================================================================================================
+// set_market_data_policy - the allocation administrator sets how old a price may be for an allocation to use it
+// Arguments : maxPriceAge (seconds)
+// ============================================================================================================================
+func (t *ManageAllocations) set_market_data_policy(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start set_market_data_policy")
+	Policy := MarketDataPolicy{MaxPriceAge: strings.TrimSpace(args[0])}
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := ""
+	if !isAdmin {
+		errMsg = "{ \"message\" : \"Only the allocation administrator can set the market data policy.\", \"code\" : \"503\"}"
+	} else if MaxPriceAge, err := strconv.ParseInt(Policy.MaxPriceAge, 10, 64); err != nil || MaxPriceAge <= 0 {
+		errMsg = "{ \"message\" : \"Invalid maximum price age " + Policy.MaxPriceAge + ", expecting a number of seconds.\", \"code\" : \"503\"}"
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	jsonAsBytes, _ := json.Marshal(Policy)
+	err = stub.PutState(MarketDataPolicyStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"maxPriceAge\" : \"" + Policy.MaxPriceAge + "\", \"message\" : \"Market data policy set succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end set_market_data_policy")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getMarketDataPolicy - the market data policy in use
+// ============================================================================================================================
+func (t *ManageAllocations) getMarketDataPolicy(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	Policy, err := market_data_policy(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Policy)
+}
@@ -0,0 +1,89 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// A price as the 'PriceFeed' chaincode publishes it
+type Prices struct {
+	SecurityId string `json:"securityId"`
+	Price      string `json:"price"`
+	Currency   string `json:"currency"`
+	Timestamp  string `json:"timestamp"`
+	ProviderId string `json:"providerId"`
+	Signature  string `json:"signature"`
+}
+
+// ============================================================================================================================
+// fetch_price - the price of a security from the 'PriceFeed' chaincode, the one in force at AsOf or the latest when AsOf is blank
+// Returns the errEvent message to raise when there is no price
+// ============================================================================================================================
+func fetch_price(stub shim.ChaincodeStubInterface, PriceChaincode string, SecurityId string, AsOf string) (Prices, string, error) {
+	queryArgs := util.ToChaincodeArgs("getPrice", SecurityId)
+	if AsOf != "" {
+		queryArgs = util.ToChaincodeArgs("getPriceAsOf", SecurityId, AsOf)
+	}
+	priceAsBytes, err := stub.QueryChaincode(PriceChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch price of "+SecurityId+" from 'PriceFeed' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Prices{}, "", errors.New(errStr)
+	}
+	Price := Prices{}
+	json.Unmarshal(priceAsBytes, &Price)
+	if Price.SecurityId != SecurityId {
+		errMsg := "{ \"securityId\" : \"" + SecurityId + "\", \"message\" : \"No market price for " + SecurityId + ".\", \"code\" : \"503\"}"
+		return Price, errMsg, nil
+	}
+	return Price, "", nil
+}
+
+// ============================================================================================================================
+// fetch_prices - the latest price of each security from the 'PriceFeed' chaincode in one query
+// Returns the errEvent message to raise when any of them has no price
+// ============================================================================================================================
+func fetch_prices(stub shim.ChaincodeStubInterface, PriceChaincode string, SecuritiesList []Securities) (map[string]Prices, string, error) {
+	batchArgs := []string{"getPrices_batch"}
+	for _, valueSecurity := range SecuritiesList {
+		batchArgs = append(batchArgs, valueSecurity.SecurityId)
+	}
+	pricesAsBytes, err := stub.QueryChaincode(PriceChaincode, util.ToChaincodeArgs(batchArgs...))
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch prices from 'PriceFeed' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, "", errors.New(errStr)
+	}
+	Latest := make(map[string]Prices)
+	json.Unmarshal(pricesAsBytes, &Latest)
+	for _, valueSecurity := range SecuritiesList {
+		if _, found := Latest[valueSecurity.SecurityId]; !found {
+			errMsg := "{ \"securityId\" : \"" + valueSecurity.SecurityId + "\", \"message\" : \"No market price for " + valueSecurity.SecurityId + ".\", \"code\" : \"503\"}"
+			return Latest, errMsg, nil
+		}
+	}
+	return Latest, "", nil
+}
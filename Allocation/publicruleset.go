@@ -0,0 +1,56 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// ============================================================================================================================
+// fetch_public_ruleset - read the public rule set in force at AsOf from the 'Deal' chaincode, and its version
+// Until an amendment is approved on the ledger the compiled SecurityJSON stays in force, as version 0
+// ============================================================================================================================
+func fetch_public_ruleset(stub shim.ChaincodeStubInterface, DealChaincode string, AsOf string) (map[string]map[string]string, int, error) {
+	queryArgs := util.ToChaincodeArgs("getPublicRuleset", AsOf)
+	rulesetAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch public rule set from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, 0, errors.New(errStr)
+	}
+	var RulesetVersion struct {
+		Version int                          `json:"version"`
+		Ruleset map[string]map[string]string `json:"ruleset"`
+	}
+	json.Unmarshal(rulesetAsBytes, &RulesetVersion)
+	PublicRuleset := SecurityJSON
+	if RulesetVersion.Version > 0 {
+		PublicRuleset = RulesetVersion.Ruleset
+	}
+	fmt.Println("Public rule set version " + strconv.Itoa(RulesetVersion.Version) + " : ")
+	fmt.Println(PublicRuleset)
+	return PublicRuleset, RulesetVersion.Version, nil
+}
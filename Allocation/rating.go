@@ -0,0 +1,335 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// Rating notches of S&P / Fitch and Moody's, best first
+var ratingScale = [][]string{
+	{"AAA", "Aaa"}, {"AA+", "Aa1"}, {"AA", "Aa2"}, {"AA-", "Aa3"},
+	{"A+", "A1"}, {"A", "A2"}, {"A-", "A3"},
+	{"BBB+", "Baa1"}, {"BBB", "Baa2"}, {"BBB-", "Baa3"},
+	{"BB+", "Ba1"}, {"BB", "Ba2"}, {"BB-", "Ba3"},
+	{"B+", "B1"}, {"B", "B2"}, {"B-", "B3"},
+	{"CCC+", "Caa1"}, {"CCC", "Caa2"}, {"CCC-", "Caa3"},
+	{"CC", "Ca"}, {"C", "C"}, {"D", "D"}}
+
+// rating_notch - position of a rating on ratingScale, 0 being the best; false for an unknown rating
+func rating_notch(Rating string) (int, bool) {
+	Rating = strings.TrimSpace(Rating)
+	for notch, ratings := range ratingScale {
+		for _, rating := range ratings {
+			if rating == Rating {
+				return notch, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ============================================================================================================================
+// security_rating - worst of the agency ratings a security carries, e.g. "S&P:AA-,Moody's:A1,Fitch:AA"
+// The agency prefix is optional. Ratings not on ratingScale are ignored, false when none is left.
+// ============================================================================================================================
+func security_rating(valueSecurity Securities) (int, string, bool) {
+	worstNotch, worstRating, rated := 0, "", false
+	for _, rating := range strings.Split(valueSecurity.Rating, ",") {
+		if i := strings.LastIndex(rating, ":"); i >= 0 {
+			rating = rating[i+1:]
+		}
+		rating = strings.TrimSpace(rating)
+		notch, found := rating_notch(rating)
+		if found && (!rated || notch > worstNotch) {
+			worstNotch, worstRating, rated = notch, rating, true
+		}
+	}
+	return worstNotch, worstRating, rated
+}
+
+// ============================================================================================================================
+// merge_rating - agency ratings of Current with those given in Update replacing the entries of the same agency
+// A rating without an agency replaces the entry without one; an empty rating ("Moody's:") removes the entry
+// ============================================================================================================================
+func merge_rating(Current string, Update string) string {
+	var agencies []string
+	ratings := make(map[string]string)
+	for _, list := range []string{Current, Update} {
+		for _, entry := range strings.Split(list, ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			agency, rating := "", entry
+			if i := strings.LastIndex(entry, ":"); i >= 0 {
+				agency, rating = strings.TrimSpace(entry[:i]), entry[i+1:]
+			}
+			if _, found := ratings[agency]; !found {
+				agencies = append(agencies, agency)
+			}
+			ratings[agency] = strings.TrimSpace(rating)
+		}
+	}
+	var merged []string
+	for _, agency := range agencies {
+		if ratings[agency] == "" {
+			continue
+		}
+		if agency == "" {
+			merged = append(merged, ratings[agency])
+		} else {
+			merged = append(merged, agency+":"+ratings[agency])
+		}
+	}
+	return strings.Join(merged, ",")
+}
+
+// rating_eligible - whether the security is rated at least the minimum its collateral form asks for in the ruleset
+func rating_eligible(valueSecurity Securities, Ruleset Ruleset) bool {
+	minimum := Ruleset.MinimumRating[valueSecurity.CollateralForm]
+	if minimum == "" {
+		return true
+	}
+	minimumNotch, found := rating_notch(minimum)
+	notch, _, rated := security_rating(valueSecurity)
+	return found && rated && notch <= minimumNotch
+}
+
+// ============================================================================================================================
+// rating_breaches - reasons for each security in the segregated account rated below the minimum of its collateral form
+// ============================================================================================================================
+func rating_breaches(SegregatedSecurities []Securities, Ruleset Ruleset) []string {
+	var Reasons []string
+	for _, valueSecurity := range SegregatedSecurities {
+		if rating_eligible(valueSecurity, Ruleset) {
+			continue
+		}
+		_, rating, rated := security_rating(valueSecurity)
+		if !rated {
+			rating = "unrated"
+		}
+		Reasons = append(Reasons, valueSecurity.SecurityId+" rated "+rating+", below the "+Ruleset.MinimumRating[valueSecurity.CollateralForm]+" minimum for "+valueSecurity.CollateralForm)
+	}
+	return Reasons
+}
+
+// ============================================================================================================================
+// rating_changed - record a new rating for a security and, for every deal whose segregated account holds it below the
+// minimum rating, mark the covered margin call non-compliant and raise a substitution margin call
+// Deals whose ruleset cannot be read or does not conform are skipped; every deal's outcome goes out in one event at the end
+// Only the ratings of the agencies named in Rating change, e.g. "Moody's:Baa3" leaves the S&P and Fitch ratings as they are
+// Arguments : DealChaincode, AccountChainCode, SecurityId, Rating, Timestamp
+// ============================================================================================================================
+func (t *ManageAllocations) rating_changed(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 5 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 5\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start rating_changed")
+
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	SecurityId := args[2]
+	Rating := args[3]
+	Timestamp := args[4]
+
+	// Ratings are published by the administrator only
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		errMsg := "{ \"message\" : \"Only the allocation administrator can publish rating changes\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// The Account chaincode keeps the rating on every holding and tells which accounts hold the security,
+	// it answers nothing when it refuses the update
+	invokeArgs := util.ToChaincodeArgs("update_rating", SecurityId, Rating)
+	accountsAsBytes, err := stub.InvokeChaincode(AccountChainCode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update rating in 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	if len(accountsAsBytes) == 0 {
+		errMsg := "{ \"message\" : \"Rating of " + SecurityId + " not updated by the 'Account' chaincode\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	var HoldingAccounts []string
+	json.Unmarshal(accountsAsBytes, &HoldingAccounts)
+	Holding := make(map[string]bool)
+	for _, account := range HoldingAccounts {
+		Holding[account] = true
+	}
+
+	queryArgs := util.ToChaincodeArgs("get_AllDeal", " ")
+	dealsAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	AllDeals := make(map[string]Deals)
+	json.Unmarshal(dealsAsBytes, &AllDeals)
+	var DealIDs []string
+	for key := range AllDeals {
+		DealIDs = append(DealIDs, key)
+	}
+	sort.Strings(DealIDs)
+
+	// Minimum ratings are checked against the deal rulesets that conform to the public rule set in force
+	PublicRuleset, _, err := fetch_public_ruleset(stub, DealChaincode, Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deals whose ruleset cannot be read or is looser than the public rule set are skipped, both lists are reported at the end
+	Substituted := "["
+	NotChecked := "["
+	for _, DealID := range DealIDs {
+		DealData := AllDeals[DealID]
+		if !Holding[DealData.SegregatedAccount] {
+			continue
+		}
+
+		// The holding as the segregated account has it, with the new rating
+		queryArgs = util.ToChaincodeArgs("getSecurities_byAccount", DealData.SegregatedAccount)
+		SecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to fetch securities of "+DealData.SegregatedAccount+" from 'Account' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		var SecuritiesJSON []Securities
+		json.Unmarshal(SecuritiesString, &SecuritiesJSON)
+		HoldingSecurity := Securities{}
+		for _, valueSecurity := range SecuritiesJSON {
+			if valueSecurity.SecurityId == SecurityId {
+				HoldingSecurity = valueSecurity
+			}
+		}
+		HoldingSecurity.Rating = merge_rating(HoldingSecurity.Rating, Rating)
+
+		// Minimum ratings are agreed between the pledger and pledgee of each deal
+		Ruleset, _, errMsg, err := fetch_ruleset(stub, DealChaincode, DealData.Pledger, DealData.Pledgee, Timestamp, PublicRuleset)
+		if err != nil {
+			return nil, err
+		}
+		if errMsg != "" {
+			NotChecked = deal_error(NotChecked, DealID, errMsg)
+			continue
+		}
+		if rating_eligible(HoldingSecurity, Ruleset) {
+			fmt.Println(SecurityId + " still eligible for " + DealID)
+			continue
+		}
+
+		TransactionData, err := covering_transaction(stub, DealChaincode, DealID)
+		if err != nil {
+			return nil, err
+		}
+		if TransactionData.TransactionId == "" {
+			fmt.Println(DealID + " has no allocated margin call, nothing to substitute")
+			continue
+		}
+
+		invokeArgs = util.ToChaincodeArgs("update_transaction_ComplianceStatus", TransactionData.TransactionId, "Regulatory Non-Compliant")
+		result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to update compliance status in 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+
+		invokeArgs = util.ToChaincodeArgs("create_substitution_call", DealID, TransactionData.TransactionId, SecurityId, Timestamp)
+		result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to create substitution call from 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+
+		tosend := "{ \"dealId\" : \"" + DealID + "\", \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"securityId\" : \"" + SecurityId + "\", " +
+			"\"Rating\" : \"" + HoldingSecurity.Rating + "\", \"Minimum Rating\" : \"" + Ruleset.MinimumRating[HoldingSecurity.CollateralForm] + "\", " +
+			"\"Compliance Status\" : \"Regulatory Non-Compliant\"}"
+		fmt.Println(tosend)
+		Substituted = json_list(Substituted, tosend)
+	}
+
+	// Only the last event of a transaction is kept, every deal's outcome goes out in one
+	tosend := "{ \"securityId\" : \"" + SecurityId + "\", \"Rating\" : \"" + Rating + "\", \"message\" : \"Rating updated succcessfully\", \"code\" : \"200\", \"Substitution Calls\" : " + Substituted + "], \"Not Checked\" : " + NotChecked + "]}"
+	event := "evtsender"
+	if NotChecked != "[" {
+		tosend = "{ \"securityId\" : \"" + SecurityId + "\", \"Rating\" : \"" + Rating + "\", \"message\" : \"Deals not checked against the new rating\", \"code\" : \"503\", \"Substitution Calls\" : " + Substituted + "], \"Not Checked\" : " + NotChecked + "]}"
+		event = "errEvent"
+	}
+	fmt.Println(tosend)
+	err = stub.SetEvent(event, []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end rating_changed")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// covering_transaction - the deal's last allocated margin call, the one its segregated account covers
+// ============================================================================================================================
+func covering_transaction(stub shim.ChaincodeStubInterface, DealChaincode string, DealID string) (Transactions, error) {
+	queryArgs := util.ToChaincodeArgs("getTransactions_byDealID", DealID)
+	transactionsAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Transactions{}, errors.New(errStr)
+	}
+	var DealTransactions []Transactions
+	json.Unmarshal(transactionsAsBytes, &DealTransactions)
+	TransactionData := Transactions{}
+	for _, valueTransaction := range DealTransactions {
+		if valueTransaction.AllocationStatus == "Allocation Successful" {
+			TransactionData = valueTransaction
+		}
+	}
+	return TransactionData, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestSecurityRating(t *testing.T) {
+	tests := []struct {
+		rating string
+		notch  int
+		worst  string
+		rated  bool
+	}{
+		{"AAA", 0, "AAA", true},
+		{"Aaa", 0, "Aaa", true},
+		{"S&P:AA-,Moody's:A1,Fitch:AA", 4, "A1", true},
+		{"S&P:A, Moody's:Baa2", 8, "Baa2", true},
+		{" BBB- ", 9, "BBB-", true},
+		{"Fitch:NR,S&P:BB+", 10, "BB+", true},
+		{"D", 21, "D", true},
+		{"", 0, "", false},
+		{"NR", 0, "", false},
+		{"S&P:aa", 0, "", false},
+	}
+	for _, test := range tests {
+		notch, worst, rated := security_rating(Securities{Rating: test.rating})
+		if notch != test.notch || worst != test.worst || rated != test.rated {
+			t.Errorf("security_rating(%q) = %d, %q, %v, want %d, %q, %v", test.rating, notch, worst, rated, test.notch, test.worst, test.rated)
+		}
+	}
+}
+
+func TestMergeRating(t *testing.T) {
+	tests := []struct {
+		current string
+		update  string
+		merged  string
+	}{
+		{"S&P:AA-,Moody's:A1,Fitch:AA", "Moody's:Baa3", "S&P:AA-,Moody's:Baa3,Fitch:AA"},
+		{"S&P:AA-, Moody's:A1", "Fitch:A+", "S&P:AA-,Moody's:A1,Fitch:A+"},
+		{"S&P:AA-,Moody's:A1,Fitch:AA", "Moody's:", "S&P:AA-,Fitch:AA"},
+		{"S&P:AA-,Moody's:A1", "Moody's:A2,S&P:A", "S&P:A,Moody's:A2"},
+		{"AAA", "BB", "BB"},
+		{"AAA", "S&P:BB", "AAA,S&P:BB"},
+		{"", "Fitch:AA", "Fitch:AA"},
+	}
+	for _, test := range tests {
+		merged := merge_rating(test.current, test.update)
+		if merged != test.merged {
+			t.Errorf("merge_rating(%q, %q) = %q, want %q", test.current, test.update, merged, test.merged)
+		}
+	}
+}
+
+func TestRatingEligible(t *testing.T) {
+	ruleset := Ruleset{MinimumRating: map[string]string{"Corporate Bonds": "A-", "Govt Securities": "Baa3"}}
+
+	tests := []struct {
+		form     string
+		rating   string
+		eligible bool
+	}{
+		{"Corporate Bonds", "A-", true},
+		{"Corporate Bonds", "A3", true},
+		{"Corporate Bonds", "S&P:AA,Moody's:Baa1", false},
+		{"Corporate Bonds", "", false},
+		{"Govt Securities", "BBB-", true},
+		{"Govt Securities", "BB+", false},
+		{"Equities", "", true},
+	}
+	for _, test := range tests {
+		eligible := rating_eligible(Securities{CollateralForm: test.form, Rating: test.rating}, ruleset)
+		if eligible != test.eligible {
+			t.Errorf("rating_eligible(%s, %q) = %v, want %v", test.form, test.rating, eligible, test.eligible)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// Pending margin calls in the order they are re-allocated, oldest margin call date first
+type TransactionsByMarginCallDate []Transactions
+
+func (slice TransactionsByMarginCallDate) Len() int { return len(slice) }
+func (slice TransactionsByMarginCallDate) Less(i, j int) bool {
+	date1, err1 := strconv.ParseInt(slice[i].MarginCAllDate, 10, 64)
+	date2, err2 := strconv.ParseInt(slice[j].MarginCAllDate, 10, 64)
+	if err1 != nil || err2 != nil {
+		return slice[i].MarginCAllDate < slice[j].MarginCAllDate
+	}
+	return date1 < date2
+}
+func (slice TransactionsByMarginCallDate) Swap(i, j int) { slice[i], slice[j] = slice[j], slice[i] }
+
+// ============================================================================================================================
+// reallocate_pending - run start_allocation's allocation for each pending margin call, oldest first, between the accounts
+// recorded on its deal. Earlier calls take the new collateral first.
+// Returns the summary JSON of which calls are fully covered, which still have a shortfall and which could not be run
+// ============================================================================================================================
+func reallocate_pending(stub shim.ChaincodeStubInterface, DealChaincode string, AccountChainCode string, PriceChaincode string, Pending []Transactions, AllocationDate string) (string, error) {
+	sort.Stable(TransactionsByMarginCallDate(Pending))
+
+	Covered := "["
+	Shortfall := "["
+	NotAllocated := "["
+	for _, ValueTransaction := range Pending {
+		queryArgs := util.ToChaincodeArgs("getDeal_byID", ValueTransaction.DealID)
+		dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return "", errors.New(errStr)
+		}
+		DealData := Deals{}
+		json.Unmarshal(dealAsBytes, &DealData)
+
+		reason := ""
+		if DealData.DealID != ValueTransaction.DealID {
+			reason = ValueTransaction.DealID + " Not Found."
+		} else if DealData.LongboxAccount == "" || DealData.SegregatedAccount == "" {
+			reason = "No accounts recorded on " + DealData.DealID + ", allocate it with start_allocation first."
+		} else {
+			Plan, errMsg, err := allocate(stub, []string{DealChaincode, AccountChainCode, PriceChaincode, DealData.DealID, ValueTransaction.TransactionId, DealData.LongboxAccount, DealData.SegregatedAccount, AllocationDate})
+			if err != nil {
+				return "", err
+			}
+			if errMsg != "" {
+				// errMsg is an errEvent body, keep its message
+				var Rejected struct {
+					Message string `json:"message"`
+				}
+				json.Unmarshal([]byte(errMsg), &Rejected)
+				reason = Rejected.Message
+			} else if Plan.Allocation.RQVLeft.Sign() > 0 {
+				if Shortfall != "[" {
+					Shortfall += ","
+				}
+				Shortfall += `{"Transaction ID" : "` + ValueTransaction.TransactionId + `", "Deal ID" : "` + DealData.DealID + `", "RQVLeft" : "` + Plan.Allocation.RQVLeft.String() + `"}`
+				continue
+			} else {
+				if Covered != "[" {
+					Covered += ","
+				}
+				Covered += `{"Transaction ID" : "` + ValueTransaction.TransactionId + `", "Deal ID" : "` + DealData.DealID + `"}`
+				continue
+			}
+		}
+		fmt.Println(ValueTransaction.TransactionId + " not re-allocated: " + reason)
+		if NotAllocated != "[" {
+			NotAllocated += ","
+		}
+		NotAllocated += `{"Transaction ID" : "` + ValueTransaction.TransactionId + `", "Deal ID" : "` + ValueTransaction.DealID + `", "Reason" : "` + reason + `"}`
+	}
+	return `{"Fully Covered" : ` + Covered + `], "Shortfall" : ` + Shortfall + `], "Not Allocated" : ` + NotAllocated + `]}`, nil
+}
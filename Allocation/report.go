@@ -0,0 +1,228 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var AllocationReportIndexStr = "_allocationReportIndex"         //name for the key/value that will store a list of all transactionIds with a report
+var AllocationReportPrefix = "_allocationReport_"               //prefix of the key each allocation report is stored under, followed by the transactionId
+var AllocationReportHistoryPrefix = "_allocationReportHistory_" //prefix of the key every allocation report of a transaction is kept under, followed by the transactionId
+
+// The fields of a stored report the queries select on
+type AllocationReportKey struct {
+	DealID         string      `json:"Deal ID"`
+	TransactionId  string      `json:"Transaction ID"`
+	AllocationDate json.Number `json:"Allocation Date"`
+}
+
+// ============================================================================================================================
+// store_allocation_report - keep the report of an allocation on the ledger under its transaction ID
+// The latest allocation of a margin call is the one under its transaction ID, every attempt is added to its history
+// ============================================================================================================================
+func store_allocation_report(stub shim.ChaincodeStubInterface, TransactionId string, reportInJson string) error {
+	err := stub.PutState(AllocationReportPrefix+TransactionId, []byte(reportInJson))
+	if err != nil {
+		return err
+	}
+	historyAsBytes, err := stub.GetState(AllocationReportHistoryPrefix + TransactionId)
+	if err != nil {
+		return errors.New("Failed to get Allocation report history of " + TransactionId)
+	}
+	var reportHistory []json.RawMessage
+	json.Unmarshal(historyAsBytes, &reportHistory)
+	reportHistory = append(reportHistory, json.RawMessage(reportInJson))
+	historyAsBytes, err = json.Marshal(reportHistory)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(AllocationReportHistoryPrefix+TransactionId, historyAsBytes)
+	if err != nil {
+		return err
+	}
+	indexAsBytes, err := stub.GetState(AllocationReportIndexStr)
+	if err != nil {
+		return errors.New("Failed to get Allocation report index")
+	}
+	var reportIndex []string
+	json.Unmarshal(indexAsBytes, &reportIndex)
+	for _, val := range reportIndex {
+		if val == TransactionId {
+			return nil
+		}
+	}
+	reportIndex = append(reportIndex, TransactionId)
+	jsonAsBytes, _ := json.Marshal(reportIndex)
+	return stub.PutState(AllocationReportIndexStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getAllocationReport_byTransaction - the stored allocation report of a transaction
+// ============================================================================================================================
+func (t *ManageAllocations) getAllocationReport_byTransaction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	fmt.Println("start getAllocationReport_byTransaction")
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'TransactionId' as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	reportAsBytes, err := stub.GetState(AllocationReportPrefix + args[0])
+	if err != nil || len(reportAsBytes) == 0 {
+		errMsg := "{ \"message\" : \"No allocation report for " + args[0] + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("end getAllocationReport_byTransaction")
+	return reportAsBytes, nil
+}
+
+// ============================================================================================================================
+// getAllocationReportHistory_byTransaction - every stored allocation report of a transaction, oldest first
+// ============================================================================================================================
+func (t *ManageAllocations) getAllocationReportHistory_byTransaction(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	fmt.Println("start getAllocationReportHistory_byTransaction")
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'TransactionId' as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	historyAsBytes, err := stub.GetState(AllocationReportHistoryPrefix + args[0])
+	if err != nil || len(historyAsBytes) == 0 {
+		errMsg := "{ \"message\" : \"No allocation report for " + args[0] + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("end getAllocationReportHistory_byTransaction")
+	return historyAsBytes, nil
+}
+
+// ============================================================================================================================
+// getAllocationReports_byDeal - every stored allocation report of a deal, oldest first
+// ============================================================================================================================
+func (t *ManageAllocations) getAllocationReports_byDeal(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	fmt.Println("start getAllocationReports_byDeal")
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'DealId' as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	DealID := args[0]
+	jsonResp, err := allocation_reports(stub, func(key AllocationReportKey) bool {
+		return key.DealID == DealID
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end getAllocationReports_byDeal")
+	return []byte(jsonResp), nil
+}
+
+// ============================================================================================================================
+// getAllocationReports_byDateRange - every stored allocation report dated from StartDate to EndDate, both included
+// Arguments : StartDate, EndDate as Unix timestamps in seconds
+// ============================================================================================================================
+func (t *ManageAllocations) getAllocationReports_byDateRange(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	fmt.Println("start getAllocationReports_byDateRange")
+	if len(args) != 2 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'StartDate' and 'EndDate' as arguments\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	StartDate, err := strconv.ParseInt(args[0], 10, 64)
+	EndDate, err2 := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || err2 != nil || EndDate < StartDate {
+		errMsg := "{ \"message\" : \"Invalid date range " + args[0] + " to " + args[1] + ", expecting Unix timestamps.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	jsonResp, err := allocation_reports(stub, func(key AllocationReportKey) bool {
+		AllocationDate, err := key.AllocationDate.Int64()
+		if err != nil {
+			fmt.Println("Report " + key.TransactionId + " has no readable Allocation Date")
+			return false
+		}
+		return AllocationDate >= StartDate && AllocationDate <= EndDate
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end getAllocationReports_byDateRange")
+	return []byte(jsonResp), nil
+}
+
+// allocation_reports - json array of the stored reports picked by selected, in the order they were first stored
+func allocation_reports(stub shim.ChaincodeStubInterface, selected func(AllocationReportKey) bool) (string, error) {
+	indexAsBytes, err := stub.GetState(AllocationReportIndexStr)
+	if err != nil {
+		return "", errors.New("Failed to get Allocation report index")
+	}
+	var reportIndex []string
+	json.Unmarshal(indexAsBytes, &reportIndex)
+	jsonResp := "["
+	for _, val := range reportIndex {
+		reportAsBytes, err := stub.GetState(AllocationReportPrefix + val)
+		if err != nil {
+			errResp := "{\"Error\":\"Failed to get state for " + AllocationReportPrefix + val + "\"}"
+			return "", errors.New(errResp)
+		}
+		key := AllocationReportKey{}
+		json.Unmarshal(reportAsBytes, &key)
+		if !selected(key) {
+			continue
+		}
+		if jsonResp != "[" {
+			jsonResp += ","
+		}
+		jsonResp += string(reportAsBytes)
+	}
+	jsonResp += "]"
+	return jsonResp, nil
+}
@@ -0,0 +1,263 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// ============================================================================================================================
+// revalue_all - mark the longbox and segregated holdings of every deal to market with the haircuts they were allocated with
+// Deals missing FX or price data are skipped; every deal's outcome goes out in one event at the end, as only the last is kept
+// Arguments : DealChaincode, AccountChainCode, PriceChaincode, RevaluationTimestamp
+// ============================================================================================================================
+func (t *ManageAllocations) revalue_all(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 4 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 4\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start revalue_all")
+
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	PriceChaincode := args[2]
+	RevaluationTimestamp := args[3]
+
+	// Every deal in the Deal chaincode's index
+	queryArgs := util.ToChaincodeArgs("get_AllDeal", " ")
+	dealsAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	AllDeals := make(map[string]Deals)
+	json.Unmarshal(dealsAsBytes, &AllDeals)
+	var DealIDs []string
+	for key := range AllDeals {
+		DealIDs = append(DealIDs, key)
+	}
+	sort.Strings(DealIDs)
+
+	// An account shared by several deals is priced once per RQV currency
+	AccountValues := make(map[string]amount.Amount)
+	ConversionRates := make(map[string]CurrencyConversion)
+	// Deals missing FX or price data are left out, both lists are reported at the end
+	Revalued := "["
+	NotRevalued := "["
+
+	for _, DealID := range DealIDs {
+		DealData := AllDeals[DealID]
+		if DealData.LongboxAccount == "" || DealData.SegregatedAccount == "" {
+			fmt.Println(DealID + " has no accounts linked, not revalued")
+			continue
+		}
+
+		// The margin call the segregated account currently covers
+		TransactionData, err := covering_transaction(stub, DealChaincode, DealID)
+		if err != nil {
+			return nil, err
+		}
+		if TransactionData.TransactionId == "" {
+			fmt.Println(DealID + " has no allocated margin call, not revalued")
+			continue
+		}
+		// Covered on the deal's CSA terms
+		RQV, err := call_amount(TransactionData)
+		if err != nil {
+			errMsg := "{ \"dealId\" : \"" + DealID + "\", \"transactionId\" : \"" + TransactionData.TransactionId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+			NotRevalued = deal_error(NotRevalued, DealID, errMsg)
+			continue
+		}
+		RQVCurrency := TransactionData.Currency
+
+		ConversionRate, found := ConversionRates[RQVCurrency]
+		if !found {
+			var errMsg string
+			ConversionRate, errMsg, err = fetch_conversion_rates(stub, RQVCurrency)
+			if err != nil {
+				return nil, err
+			}
+			if errMsg != "" {
+				NotRevalued = deal_error(NotRevalued, DealID, errMsg)
+				continue
+			}
+			ConversionRates[RQVCurrency] = ConversionRate
+		}
+
+		LongboxKey := DealData.LongboxAccount + "|" + RQVCurrency
+		SegregatedKey := DealData.SegregatedAccount + "|" + RQVCurrency
+		errMsg := ""
+		for _, account := range []string{DealData.LongboxAccount, DealData.SegregatedAccount} {
+			if _, found := AccountValues[account+"|"+RQVCurrency]; found {
+				continue
+			}
+			AccountValue, accountErrMsg, err := revalue_account(stub, AccountChainCode, PriceChaincode, account, ConversionRate, RQVCurrency)
+			if err != nil {
+				return nil, err
+			}
+			if accountErrMsg != "" {
+				errMsg = accountErrMsg
+				break
+			}
+			AccountValues[account+"|"+RQVCurrency] = AccountValue
+		}
+		if errMsg != "" {
+			NotRevalued = deal_error(NotRevalued, DealID, errMsg)
+			continue
+		}
+		SegregatedAmount := AccountValues[SegregatedKey]
+		LongboxValue := AccountValues[LongboxKey].String()
+		SegregatedValue := SegregatedAmount.String()
+
+		// Keep the deal's account totals in line
+		invokeArgs := util.ToChaincodeArgs("set_account_values",
+			DealData.DealID,
+			LongboxValue,
+			SegregatedValue)
+		result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to update Deal from 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+
+		// Collateral value over RQV, under 1 the deal is short
+		CoverageRatio := "0.0000"
+		if RQV.Sign() > 0 {
+			Coverage, err := SegregatedAmount.Div(RQV, 4, amount.DefaultRounding)
+			if err != nil {
+				return nil, err
+			}
+			CoverageRatio = Coverage.String()
+		}
+		// Short of the call amount, by how much
+		ShortFall := amount.Zero(RQVCurrency)
+		if SegregatedAmount.Cmp(RQV) < 0 {
+			ShortFall, err = RQV.Sub(SegregatedAmount)
+			if err != nil {
+				return nil, err
+			}
+		}
+		tosend := "{ \"dealId\" : \"" + DealID + "\", \"transactionId\" : \"" + TransactionData.TransactionId + "\", " +
+			"\"RQV\" : \"" + TransactionData.RQV + "\", \"Call Amount\" : \"" + RQV.String() + "\", \"Currency\" : \"" + RQVCurrency + "\", " +
+			"\"Longbox Value\" : \"" + LongboxValue + "\", \"Segregated Value\" : \"" + SegregatedValue + "\", " +
+			"\"Coverage Ratio\" : \"" + CoverageRatio + "\", \"Short Fall\" : \"" + ShortFall.String() + "\", \"Revaluation Date\" : " + RevaluationTimestamp + "}"
+		fmt.Println(tosend)
+		Revalued = json_list(Revalued, tosend)
+
+		// Margin calls are for the total collateral, the Deal chaincode raises the follow-up call for the full exposure
+		// on its CSA terms, which re-apply the independent amount and threshold, and records the shortfall with it
+		if ShortFall.Sign() > 0 {
+			invokeArgs = util.ToChaincodeArgs("create_margin_call", DealData.DealID, TransactionData.RQV, RQVCurrency, RevaluationTimestamp, ShortFall.String())
+			result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+			if err != nil {
+				errStr := fmt.Sprintf("Failed to create margin call from 'Deal' chaincode. Got error: %s", err.Error())
+				fmt.Printf(errStr)
+				return nil, errors.New(errStr)
+			}
+			fmt.Println(result)
+		}
+	}
+
+	tosend := "{ \"message\" : \"Deals revalued succcessfully\", \"code\" : \"200\", \"Revalued\" : " + Revalued + "], \"Not Revalued\" : " + NotRevalued + "]}"
+	event := "evtsender"
+	if NotRevalued != "[" {
+		tosend = "{ \"message\" : \"Deals not revalued\", \"code\" : \"503\", \"Revalued\" : " + Revalued + "], \"Not Revalued\" : " + NotRevalued + "]}"
+		event = "errEvent"
+	}
+	fmt.Println(tosend)
+	err = stub.SetEvent(event, []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end revalue_all")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// deal_error - add a deal's error message to a JSON list of deals a run over every deal had to leave out
+// ============================================================================================================================
+func deal_error(List string, DealID string, errMsg string) string {
+	fmt.Println(DealID + " left out: " + errMsg)
+	return json_list(List, "{\"Deal ID\" : \"" + DealID + "\", \"Error\" : " + errMsg + "}")
+}
+
+// json_list - add a JSON object to a list opened with "[" and closed by the caller
+func json_list(List string, Item string) string {
+	if List != "[" {
+		List += ","
+	}
+	return List + Item
+}
+
+// ============================================================================================================================
+// revalue_account - reprice every security of an account in RQV currency, store the new values and return the account total
+// ============================================================================================================================
+func revalue_account(stub shim.ChaincodeStubInterface, AccountChainCode string, PriceChaincode string, Account string, ConversionRate CurrencyConversion, RQVCurrency string) (amount.Amount, string, error) {
+	queryArgs := util.ToChaincodeArgs("getSecurities_byAccount", Account)
+	SecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch securities of "+Account+" from 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return amount.Amount{}, "", errors.New(errStr)
+	}
+	var SecuritiesJSON []Securities
+	json.Unmarshal(SecuritiesString, &SecuritiesJSON)
+	if len(SecuritiesJSON) == 0 {
+		return amount.Zero(RQVCurrency), "", nil
+	}
+
+	Latest, errMsg, err := fetch_prices(stub, PriceChaincode, SecuritiesJSON)
+	if err != nil || errMsg != "" {
+		return amount.Amount{}, errMsg, err
+	}
+
+	var Revalued []Securities
+	for _, tempSecurity := range SecuritiesJSON {
+		tempSecurity, errMsg := revalue_security(tempSecurity, Latest[tempSecurity.SecurityId], ConversionRate, RQVCurrency)
+		if errMsg != "" {
+			return amount.Amount{}, errMsg, nil
+		}
+		Revalued = append(Revalued, tempSecurity)
+	}
+	AccountValue, err := total_value(Revalued, RQVCurrency)
+	if err != nil {
+		return amount.Amount{}, "", err
+	}
+	err = store_valuations(stub, AccountChainCode, Account, Revalued)
+	if err != nil {
+		return amount.Amount{}, "", err
+	}
+	return AccountValue, "", nil
+}
@@ -0,0 +1,247 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// Objectives understood by optimal_allocation
+const (
+	MinimumExcess = "Minimum Excess" // cover the RQV with the smallest effective value over it
+	MinimumCost   = "Minimum Cost"   // cover the RQV with the smallest market value handed over
+)
+
+// Upper bound on the number of search nodes visited, past it the solver settles for the best allocation found so far
+var SolverNodeLimit = 200000
+
+// Amounts closer than this are treated as equal (half a cent)
+const solverTolerance = 0.005
+
+// AllocationResult is what an allocation run proposes to move into the segregated account
+type AllocationResult struct {
+	ReallocatedSecurities []Securities
+	SecuritiesAllocated   map[string]float64 // Security ID -> quantity allocated
+	TotalValueAllocated   map[string]float64 // Security ID -> effective value allocated
+	RQVLeft               amount.Amount      // exact, <= 0 once the RQV is covered
+	Mode                  string             // how the allocation was arrived at, for the report
+}
+
+// One line the solver may draw whole units from
+type allocationCandidate struct {
+	Security  Securities
+	Quantity  float64 // whole units available
+	UnitValue float64 // effective value of one unit in RQV currency
+	UnitCost  float64 // market value of one unit in RQV currency
+}
+
+// Used for candidate sort, same idea as SecurityArrayStruct
+type candidateOrder struct {
+	List      []allocationCandidate
+	Objective string
+}
+
+func (order candidateOrder) Len() int { return len(order.List) }
+func (order candidateOrder) Swap(i, j int) {
+	order.List[i], order.List[j] = order.List[j], order.List[i]
+}
+func (order candidateOrder) Less(i, j int) bool {
+	if order.Objective == MinimumCost {
+		ratioI := order.List[i].UnitCost / order.List[i].UnitValue
+		ratioJ := order.List[j].UnitCost / order.List[j].UnitValue
+		if ratioI != ratioJ {
+			return ratioI < ratioJ
+		}
+	}
+	return order.List[i].UnitValue > order.List[j].UnitValue
+}
+
+// Search state shared by the recursion
+type allocationSearch struct {
+	Candidates     []allocationCandidate
+	RQV            float64
+	Objective      string
+	Reachable      []map[string]float64 // Reachable[k][form] = value held in form by candidates k..n-1, issuer limits left out of the bound
+	EligibleLeft   map[string]float64
+	Ruleset        Ruleset // issuer groups the limits in EligibleLeft are kept by
+	Quantities     []float64
+	BestQuantities []float64
+	BestScore      float64
+	Found          bool
+	Nodes          int
+	Truncated      bool // SolverNodeLimit reached before every quantity was tried
+}
+
+// ============================================================================================================================
+// optimal_allocation - find whole-unit quantities that cover the RQV within the concentration limits at the lowest objective
+// ============================================================================================================================
+func optimal_allocation(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, objective string, Ruleset Ruleset) (AllocationResult, bool, error) {
+	EligibleLeft := eligible_left(RQVEligibleValue)
+	var candidates []allocationCandidate
+	for _, valueSecurity := range CombinedSecurities {
+		securityQuantity := checked_float(valueSecurity.SecuritiesQuantity)
+		effectiveValueChanged := checked_float(valueSecurity.EffectiveValueChanged)
+		valuePercentage := checked_float(valueSecurity.ValuePercentage)
+		quantity := math.Floor(securityQuantity)
+		if quantity < 1 || effectiveValueChanged <= 0 || concentration_left(EligibleLeft, valueSecurity, Ruleset) <= 0 {
+			continue
+		}
+		// Market value is the effective value with the haircut taken back out
+		unitCost := effectiveValueChanged
+		if valuePercentage > 0 {
+			unitCost = (effectiveValueChanged * 100) / valuePercentage
+		}
+		candidates = append(candidates, allocationCandidate{valueSecurity, quantity, effectiveValueChanged, unitCost})
+	}
+
+	// Largest units first lets the search close the gap quickly; for cost, the cheapest cover per unit of value first
+	sort.Stable(candidateOrder{candidates, objective})
+
+	search := allocationSearch{
+		Candidates:     candidates,
+		RQV:            RQV.Float64(),
+		Objective:      objective,
+		Reachable:      make([]map[string]float64, len(candidates)+1),
+		EligibleLeft:   EligibleLeft,
+		Ruleset:        Ruleset,
+		Quantities:     make([]float64, len(candidates)),
+		BestQuantities: make([]float64, len(candidates)),
+		BestScore:      math.Inf(1),
+	}
+	search.Reachable[len(candidates)] = make(map[string]float64)
+	for k := len(candidates) - 1; k >= 0; k-- {
+		search.Reachable[k] = make(map[string]float64)
+		for key, value := range search.Reachable[k+1] {
+			search.Reachable[k][key] = value
+		}
+		search.Reachable[k][candidates[k].Security.CollateralForm] += candidates[k].Quantity * candidates[k].UnitValue
+	}
+
+	search.explore(0, 0, 0)
+	fmt.Println("Solver nodes visited: ", search.Nodes)
+	if search.Truncated {
+		fmt.Println("Solver stopped at the node limit: ", SolverNodeLimit)
+	}
+	if !search.Found {
+		fmt.Println("Solver found no allocation covering RQV: ", RQV)
+		return AllocationResult{}, false, nil
+	}
+
+	result := AllocationResult{
+		SecuritiesAllocated: make(map[string]float64),
+		TotalValueAllocated: make(map[string]float64),
+	}
+	for k, candidate := range candidates {
+		quantity := search.BestQuantities[k]
+		if quantity == 0 {
+			continue
+		}
+		tempSecurity := allocated_line(candidate.Security, quantity)
+		result.ReallocatedSecurities = append(result.ReallocatedSecurities, tempSecurity)
+		result.SecuritiesAllocated[candidate.Security.SecurityId] = quantity
+		result.TotalValueAllocated[candidate.Security.SecurityId] = checked_float(tempSecurity.TotalValue)
+	}
+	if search.Truncated {
+		result.Mode = "best found within the node limit"
+	}
+	var err error
+	result.RQVLeft, err = rqv_left(RQV, result.ReallocatedSecurities)
+	if err != nil {
+		return AllocationResult{}, false, err
+	}
+	fmt.Println("Optimal allocation ("+objective+"): ", result.ReallocatedSecurities)
+	fmt.Println("Optimal allocation excess: ", result.RQVLeft.Neg())
+	return result, true, nil
+}
+
+// ============================================================================================================================
+// explore - depth first branch and bound over candidate k onwards, given the value and cost already allocated
+// Returns false when no smaller quantity of the previous candidate can do better, so the caller stops trying them
+// ============================================================================================================================
+func (s *allocationSearch) explore(k int, allocated float64, cost float64) bool {
+	s.Nodes++
+	if s.Nodes > SolverNodeLimit {
+		s.Truncated = true
+		return false
+	}
+	if allocated >= s.RQV-solverTolerance {
+		// Covered. Taking more can only add excess or cost, so this branch ends here.
+		score := allocated - s.RQV
+		if s.Objective == MinimumCost {
+			score = cost
+		}
+		if score < s.BestScore-solverTolerance {
+			s.BestScore = score
+			s.Found = true
+			copy(s.BestQuantities, s.Quantities)
+		}
+		return true
+	}
+	if k == len(s.Candidates) {
+		return false
+	}
+	// Nothing beats covering the RQV to the cent
+	if s.Found && s.Objective == MinimumExcess && s.BestScore <= solverTolerance {
+		return false
+	}
+	// Fewer units of the previous candidate cost less, so those are still worth trying
+	if s.Objective == MinimumCost && cost >= s.BestScore {
+		return true
+	}
+	// Even taking everything that is left, capped by the concentration limits, must be able to reach the RQV
+	reachable := allocated
+	for form, value := range s.Reachable[k] {
+		reachable += math.Min(value, math.Max(s.EligibleLeft[form], 0))
+	}
+	// Fewer units of the previous candidate can only reach less
+	if reachable < s.RQV-solverTolerance {
+		return false
+	}
+
+	candidate := s.Candidates[k]
+	highest := math.Min(candidate.Quantity, math.Floor((concentration_left(s.EligibleLeft, candidate.Security, s.Ruleset)+solverTolerance)/candidate.UnitValue))
+	highest = math.Min(highest, math.Ceil((s.RQV-allocated-solverTolerance)/candidate.UnitValue))
+	if highest < 0 {
+		highest = 0
+	}
+	// Every quantity down to leaving the security out, until the rest can no longer reach the RQV
+	for quantity := highest; quantity >= 0; quantity-- {
+		if !s.take(k, quantity, allocated, cost) {
+			break
+		}
+	}
+	return true
+}
+
+// take - allocate quantity units of candidate k and continue the search with the next candidate
+func (s *allocationSearch) take(k int, quantity float64, allocated float64, cost float64) bool {
+	candidate := s.Candidates[k]
+	value := quantity * candidate.UnitValue
+	s.Quantities[k] = quantity
+	use_concentration(s.EligibleLeft, candidate.Security, value, s.Ruleset)
+	more := s.explore(k+1, allocated+value, cost+quantity*candidate.UnitCost)
+	use_concentration(s.EligibleLeft, candidate.Security, -value, s.Ruleset)
+	s.Quantities[k] = 0
+	return more
+}
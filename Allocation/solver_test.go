@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// security - a line of the longbox as optimal_allocation reads it
+func security(id string, form string, quantity int, effectiveValue string, valuePercentage string) Securities {
+	return Securities{
+		SecurityId:            id,
+		CollateralForm:        form,
+		SecuritiesQuantity:    strconv.Itoa(quantity),
+		EffectiveValueChanged: effectiveValue,
+		ValuePercentage:       valuePercentage,
+		Currency:              "EUR",
+	}
+}
+
+// limits - concentration limits in EUR as optimal_allocation reads them
+func limits(values map[string]string) map[string]amount.Amount {
+	RQVEligibleValue := make(map[string]amount.Amount)
+	for key, value := range values {
+		RQVEligibleValue[key], _ = amount.ParseAmount(value, "EUR")
+	}
+	return RQVEligibleValue
+}
+
+func TestOptimalAllocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		securities []Securities
+		rqv        string
+		eligible   map[string]string
+		objective  string
+		solved     bool
+		want       map[string]float64
+		rqvLeft    string
+	}{
+		{
+			// 1 x 101 + 9 x 100, nine units below the 10 of the larger security that would cover it alone
+			name: "exact cover far below the largest quantity",
+			securities: []Securities{
+				security("A", "Equities", 10, "100.00", "100"),
+				security("B", "Equities", 10, "101.00", "100"),
+			},
+			rqv:       "1001.00",
+			eligible:  map[string]string{"Equities": "2000.00"},
+			objective: MinimumExcess,
+			solved:    true,
+			want:      map[string]float64{"A": 9, "B": 1},
+			rqvLeft:   "0.00",
+		},
+		{
+			name: "smallest excess over the RQV",
+			securities: []Securities{
+				security("A", "Equities", 5, "30.00", "100"),
+				security("B", "Equities", 5, "20.00", "100"),
+			},
+			rqv:       "75.00",
+			eligible:  map[string]string{"Equities": "200.00"},
+			objective: MinimumExcess,
+			solved:    true,
+			want:      map[string]float64{"A": 2, "B": 1},
+			rqvLeft:   "-5.00",
+		},
+		{
+			name: "concentration limit moves the cover to another form",
+			securities: []Securities{
+				security("A", "Equities", 10, "100.00", "100"),
+				security("G", "Govt Securities", 10, "50.00", "100"),
+			},
+			rqv:       "300.00",
+			eligible:  map[string]string{"Equities": "100.00", "Govt Securities": "300.00"},
+			objective: MinimumExcess,
+			solved:    true,
+			want:      map[string]float64{"A": 1, "G": 4},
+			rqvLeft:   "0.00",
+		},
+		{
+			name: "lowest market value handed over",
+			securities: []Securities{
+				security("A", "Equities", 10, "50.00", "50"),
+				security("G", "Govt Securities", 10, "45.00", "90"),
+			},
+			rqv:       "90.00",
+			eligible:  map[string]string{"Equities": "1000.00", "Govt Securities": "1000.00"},
+			objective: MinimumCost,
+			solved:    true,
+			want:      map[string]float64{"G": 2},
+			rqvLeft:   "0.00",
+		},
+		{
+			name: "not enough collateral",
+			securities: []Securities{
+				security("A", "Equities", 2, "100.00", "100"),
+			},
+			rqv:       "500.00",
+			eligible:  map[string]string{"Equities": "500.00"},
+			objective: MinimumExcess,
+			solved:    false,
+		},
+	}
+	for _, test := range tests {
+		RQV, err := amount.ParseAmount(test.rqv, "EUR")
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, solved, err := optimal_allocation(test.securities, RQV, limits(test.eligible), test.objective, Ruleset{})
+		if err != nil {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if solved != test.solved {
+			t.Errorf("%s: solved = %v, want %v", test.name, solved, test.solved)
+			continue
+		}
+		if !solved {
+			continue
+		}
+		if len(result.SecuritiesAllocated) != len(test.want) {
+			t.Errorf("%s: allocated %v, want %v", test.name, result.SecuritiesAllocated, test.want)
+		}
+		for id, quantity := range test.want {
+			if result.SecuritiesAllocated[id] != quantity {
+				t.Errorf("%s: allocated %v, want %v", test.name, result.SecuritiesAllocated, test.want)
+				break
+			}
+		}
+		if result.RQVLeft.String() != test.rqvLeft {
+			t.Errorf("%s: RQVLeft = %s, want %s", test.name, result.RQVLeft, test.rqvLeft)
+		}
+		if result.Mode != "" {
+			t.Errorf("%s: Mode = %q, want the search to finish", test.name, result.Mode)
+		}
+	}
+}
+
+func TestOptimalAllocationNodeLimit(t *testing.T) {
+	defer func(limit int) { SolverNodeLimit = limit }(SolverNodeLimit)
+	SolverNodeLimit = 3
+
+	RQV, _ := amount.ParseAmount("703.00", "EUR")
+	securities := []Securities{
+		security("A", "Equities", 10, "100.00", "100"),
+		security("B", "Equities", 10, "101.00", "100"),
+	}
+	result, solved, err := optimal_allocation(securities, RQV, limits(map[string]string{"Equities": "1000.00"}), MinimumExcess, Ruleset{})
+	if err != nil || !solved {
+		t.Fatalf("solved = %v, %v, want the best allocation found before the limit", solved, err)
+	}
+	if result.Mode == "" {
+		t.Error("Mode is empty, want the result marked as cut off by the node limit")
+	}
+	if result.RQVLeft.Sign() > 0 {
+		t.Errorf("RQVLeft = %s, want the RQV covered", result.RQVLeft)
+	}
+}
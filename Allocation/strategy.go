@@ -0,0 +1,358 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// AllocationStrategy decides which securities, and how many of each, go into the segregated account.
+// RQVEligibleValue holds the concentration limit of every collateral form in RQV currency,
+// and of limited issuers and issuer groups under IssuerLimitKey and IssuerGroupLimitKey.
+// The figures of CombinedSecurities have been through check_figures.
+// Ruleset is the deal's ruleset, for the priority of each collateral form and the issuer groups.
+type AllocationStrategy interface {
+	Name() string
+	Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error)
+}
+
+// Strategy used when a deal does not name one
+var DefaultAllocationStrategy = "Optimal"
+
+// Strategies a deal can name in `allocationStrategy`
+var AllocationStrategies = map[string]AllocationStrategy{
+	"Priority Greedy":       PriorityGreedyStrategy{},
+	"Optimal":               OptimalStrategy{"Optimal", MinimumExcess, PriorityGreedyStrategy{}},
+	"Cheapest to Deliver":   OptimalStrategy{"Cheapest to Deliver", MinimumCost, HighestQualityFirstStrategy{}},
+	"Fewest Line Items":     FewestLineItemsStrategy{},
+	"Highest Quality First": HighestQualityFirstStrategy{},
+	"Pro Rata":              ProRataStrategy{},
+}
+
+// ============================================================================================================================
+// get_allocation_strategy - resolve the strategy named on a deal, falling back to the default for deals that name none
+// ============================================================================================================================
+func get_allocation_strategy(name string) (AllocationStrategy, bool) {
+	if name == "" || name == " " {
+		name = DefaultAllocationStrategy
+	}
+	strategy, found := AllocationStrategies[name]
+	return strategy, found
+}
+
+// Used for sorting securities by an arbitrary rule
+type securityOrder struct {
+	List []Securities
+	By   func(a, b Securities) bool
+}
+
+func (order securityOrder) Len() int           { return len(order.List) }
+func (order securityOrder) Swap(i, j int)      { order.List[i], order.List[j] = order.List[j], order.List[i] }
+func (order securityOrder) Less(i, j int) bool { return order.By(order.List[i], order.List[j]) }
+
+// security_float - read a numeric field of a security for the allocation search
+func security_float(value string) (float64, error) {
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errors.New("Invalid figure '" + value + "'")
+	}
+	return result, nil
+}
+
+// ============================================================================================================================
+// check_figures - every figure the allocation search reads off the securities must parse, checked once before it starts
+// A holding with a figure that does not read is an error rather than nothing held
+// ============================================================================================================================
+func check_figures(SecuritiesList []Securities) error {
+	for _, valueSecurity := range SecuritiesList {
+		figures := []string{valueSecurity.SecuritiesQuantity, valueSecurity.EffectiveValueChanged, valueSecurity.TotalValue}
+		if valueSecurity.ValuePercentage != "" {
+			figures = append(figures, valueSecurity.ValuePercentage)
+		}
+		for _, figure := range figures {
+			if _, err := security_float(figure); err != nil {
+				return errors.New(valueSecurity.SecurityId + " of " + valueSecurity.AccountNumber + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// checked_float - a figure of a security that has been through check_figures, read again by the search
+func checked_float(value string) float64 {
+	result, _ := security_float(value)
+	return result
+}
+
+// ============================================================================================================================
+// allocated_line - the security with quantity of it, at a total value of quantity times its effective value rounded once
+// The effective value has been through effective_value already, so it reads at the decimals it was written with
+// ============================================================================================================================
+func allocated_line(valueSecurity Securities, quantity float64) Securities {
+	Quantity, err := amount.FromFloat(quantity, amount.QuantityScale, amount.DefaultRounding)
+	if err != nil {
+		fmt.Println(err)
+	}
+	EffectiveValue, err := amount.ParseDecimal(valueSecurity.EffectiveValueChanged, amount.DecimalPlaces(valueSecurity.EffectiveValueChanged), amount.DefaultRounding)
+	if err != nil {
+		fmt.Println(err)
+	}
+	TotalValue, err := EffectiveValue.Mul(Quantity, EffectiveValue.Scale, amount.DefaultRounding)
+	if err != nil {
+		fmt.Println(err)
+	}
+	valueSecurity.SecuritiesQuantity = Quantity.String()
+	valueSecurity.TotalValue = TotalValue.String()
+	return valueSecurity
+}
+
+// total_value - exact sum of the total values of the securities, as written by effective_value and allocated_line
+func total_value(SecuritiesList []Securities, Currency string) (amount.Amount, error) {
+	Total := amount.Zero(Currency)
+	for _, valueSecurity := range SecuritiesList {
+		Value, err := amount.ParseAmount(valueSecurity.TotalValue, Currency)
+		if err == nil {
+			Total, err = Total.Add(Value)
+		}
+		if err != nil {
+			return amount.Amount{}, errors.New("Total value of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+	}
+	return Total, nil
+}
+
+// rqv_left - exact part of the RQV the allocated lines leave uncovered, negative when they cover more
+func rqv_left(RQV amount.Amount, Allocated []Securities) (amount.Amount, error) {
+	Allocation, err := total_value(Allocated, RQV.Currency)
+	if err != nil {
+		return amount.Amount{}, err
+	}
+	return RQV.Sub(Allocation)
+}
+
+// short_fall - what is still to cover of the RQV, nothing once it is covered
+func short_fall(RQVLeft amount.Amount) amount.Amount {
+	if RQVLeft.Sign() < 0 {
+		return amount.Zero(RQVLeft.Currency)
+	}
+	return RQVLeft
+}
+
+// amount_string - a figure the allocation search worked out in float64, rounded once to the decimals of the currency
+func amount_string(value float64, Currency string) string {
+	Value, err := amount.FromFloat(value, amount.ScaleOf(Currency), amount.DefaultRounding)
+	if err != nil {
+		fmt.Println(err)
+		return "NA"
+	}
+	return Value.String()
+}
+
+// ============================================================================================================================
+// Priority Greedy - walk the securities in ruleset "Priority" order, richest security first within a priority
+// ============================================================================================================================
+type PriorityGreedyStrategy struct{}
+
+func (s PriorityGreedyStrategy) Name() string { return "Priority Greedy" }
+
+func (s PriorityGreedyStrategy) Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error) {
+	sorted := append([]Securities(nil), CombinedSecurities...)
+	sort.Sort(by_priority(sorted, Ruleset))
+	result, err := greedy_allocation(sorted, RQV, eligible_left(RQVEligibleValue), Ruleset)
+	result.Mode = s.Name()
+	return result, err
+}
+
+// ============================================================================================================================
+// Optimal / Cheapest to Deliver - solve for whole-unit quantities, walk the fallback strategy if the solver gives up
+// ============================================================================================================================
+type OptimalStrategy struct {
+	StrategyName string
+	Objective    string
+	Fallback     AllocationStrategy
+}
+
+func (s OptimalStrategy) Name() string { return s.StrategyName }
+
+func (s OptimalStrategy) Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error) {
+	result, solved, err := optimal_allocation(CombinedSecurities, RQV, RQVEligibleValue, s.Objective, Ruleset)
+	if err != nil {
+		return result, err
+	}
+	if solved {
+		if result.Mode != "" {
+			result.Mode = s.Name() + " (" + s.Objective + ", " + result.Mode + ")"
+		} else {
+			result.Mode = s.Name() + " (" + s.Objective + ")"
+		}
+		return result, nil
+	}
+	fmt.Println(s.Name() + " allocation not found. Falling back to " + s.Fallback.Name())
+	result, err = s.Fallback.Allocate(CombinedSecurities, RQV, RQVEligibleValue, Ruleset)
+	result.Mode = s.Fallback.Name() + " (fallback)"
+	return result, err
+}
+
+// ============================================================================================================================
+// Fewest Line Items - largest holdings first, so the RQV is covered by as few securities as possible
+// ============================================================================================================================
+type FewestLineItemsStrategy struct{}
+
+func (s FewestLineItemsStrategy) Name() string { return "Fewest Line Items" }
+
+func (s FewestLineItemsStrategy) Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error) {
+	sorted := append([]Securities(nil), CombinedSecurities...)
+	sort.Stable(securityOrder{sorted, func(a, b Securities) bool {
+		return checked_float(a.TotalValue) > checked_float(b.TotalValue)
+	}})
+	result, err := greedy_allocation(sorted, RQV, eligible_left(RQVEligibleValue), Ruleset)
+	result.Mode = s.Name()
+	return result, err
+}
+
+// ============================================================================================================================
+// Highest Quality First - smallest haircut (highest valuation percentage) first
+// ============================================================================================================================
+type HighestQualityFirstStrategy struct{}
+
+func (s HighestQualityFirstStrategy) Name() string { return "Highest Quality First" }
+
+func (s HighestQualityFirstStrategy) Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error) {
+	sorted := append([]Securities(nil), CombinedSecurities...)
+	sort.Stable(securityOrder{sorted, func(a, b Securities) bool {
+		valuePercentageA := checked_float(a.ValuePercentage)
+		valuePercentageB := checked_float(b.ValuePercentage)
+		if valuePercentageA != valuePercentageB {
+			return valuePercentageA > valuePercentageB
+		}
+		return checked_float(a.EffectiveValueChanged) > checked_float(b.EffectiveValueChanged)
+	}})
+	result, err := greedy_allocation(sorted, RQV, eligible_left(RQVEligibleValue), Ruleset)
+	result.Mode = s.Name()
+	return result, err
+}
+
+// ============================================================================================================================
+// Pro Rata - split the RQV across collateral forms in proportion to the eligible value available in each form
+// ============================================================================================================================
+type ProRataStrategy struct{}
+
+func (s ProRataStrategy) Name() string { return "Pro Rata" }
+
+func (s ProRataStrategy) Allocate(CombinedSecurities []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (AllocationResult, error) {
+	sorted := append([]Securities(nil), CombinedSecurities...)
+	sort.Sort(by_priority(sorted, Ruleset))
+
+	AvailableEligible := make(map[string]float64)
+	var AvailableEligibleCollateral float64
+	for _, valueSecurity := range sorted {
+		AvailableEligible[valueSecurity.CollateralForm] += checked_float(valueSecurity.TotalValue)
+	}
+	for key := range AvailableEligible {
+		AvailableEligible[key] = math.Min(AvailableEligible[key], RQVEligibleValue[key].Float64())
+		AvailableEligibleCollateral += AvailableEligible[key]
+	}
+	if AvailableEligibleCollateral <= 0 {
+		result, err := greedy_allocation(sorted, RQV, eligible_left(RQVEligibleValue), Ruleset)
+		result.Mode = s.Name()
+		return result, err
+	}
+
+	// Each form's share of the RQV, never above its concentration limit
+	ProRataTarget := make(map[string]float64)
+	for key, value := range AvailableEligible {
+		ProRataTarget[key] = math.Min((RQV.Float64()*value)/AvailableEligibleCollateral, RQVEligibleValue[key].Float64())
+	}
+	// Issuer limits hold whatever the form's share
+	for key, value := range RQVEligibleValue {
+		if _, found := ProRataTarget[key]; !found {
+			ProRataTarget[key] = value.Float64()
+		}
+	}
+	fmt.Println("ProRataTarget: ", ProRataTarget)
+	result, err := greedy_allocation(sorted, RQV, ProRataTarget, Ruleset)
+	result.Mode = s.Name()
+	if err != nil || result.RQVLeft.Sign() <= 0 {
+		return result, err
+	}
+
+	// Whole units rarely split exactly, top up from what is left within the full concentration limits
+	RQVEligibleValueLeft := eligible_left(RQVEligibleValue)
+	for _, valueSecurity := range result.ReallocatedSecurities {
+		use_concentration(RQVEligibleValueLeft, valueSecurity, checked_float(valueSecurity.TotalValue), Ruleset)
+	}
+	topUp, err := greedy_allocation(remaining_securities(sorted, result), result.RQVLeft, RQVEligibleValueLeft, Ruleset)
+	if err != nil {
+		return result, err
+	}
+	result, err = merge_allocations(RQV, result, topUp)
+	result.Mode = s.Name()
+	return result, err
+}
+
+// ============================================================================================================================
+// remaining_securities - what is still held of each security once an allocation has been taken out
+// ============================================================================================================================
+func remaining_securities(CombinedSecurities []Securities, allocated AllocationResult) []Securities {
+	var remaining []Securities
+	for _, valueSecurity := range CombinedSecurities {
+		quantityLeft := checked_float(valueSecurity.SecuritiesQuantity) - allocated.SecuritiesAllocated[valueSecurity.SecurityId]
+		if quantityLeft <= 0 {
+			continue
+		}
+		remaining = append(remaining, allocated_line(valueSecurity, quantityLeft))
+	}
+	return remaining
+}
+
+// ============================================================================================================================
+// merge_allocations - add a second allocation pass onto the first, adding up lines of the same security
+// ============================================================================================================================
+func merge_allocations(RQV amount.Amount, first AllocationResult, second AllocationResult) (AllocationResult, error) {
+	merged := AllocationResult{
+		SecuritiesAllocated: make(map[string]float64),
+		TotalValueAllocated: make(map[string]float64),
+		Mode:                first.Mode,
+	}
+	position := make(map[string]int)
+	for _, pass := range []AllocationResult{first, second} {
+		for _, valueSecurity := range pass.ReallocatedSecurities {
+			id := valueSecurity.SecurityId
+			merged.SecuritiesAllocated[id] += pass.SecuritiesAllocated[id]
+			valueSecurity = allocated_line(valueSecurity, merged.SecuritiesAllocated[id])
+			merged.TotalValueAllocated[id] = checked_float(valueSecurity.TotalValue)
+			if i, found := position[id]; found {
+				merged.ReallocatedSecurities[i] = valueSecurity
+			} else {
+				position[id] = len(merged.ReallocatedSecurities)
+				merged.ReallocatedSecurities = append(merged.ReallocatedSecurities, valueSecurity)
+			}
+		}
+	}
+	var err error
+	merged.RQVLeft, err = rqv_left(RQV, merged.ReallocatedSecurities)
+	return merged, err
+}
@@ -0,0 +1,548 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/mukutb/TCM-new/amount"
+)
+
+// Substitution requested by the pledger on the Deal chaincode
+type Substitutions struct {
+	SubstitutionId string `json:"substitutionId"`
+	DealID         string `json:"dealId"`
+	TransactionID  string `json:"transactionId"`
+	Pledger        string `json:"pledger"`
+	Pledgee        string `json:"pledgee"`
+	Withdrawals    string `json:"withdrawals"`  //securityId:quantity,... coming back out of the segregated account
+	Replacements   string `json:"replacements"` //securityId:quantity,... going in from the longbox account
+	RequestDate    string `json:"requestDate"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason"`
+}
+
+// ============================================================================================================================
+// substitute_collateral - carry out an approved substitution if the segregated account still covers the RQV afterwards
+// ============================================================================================================================
+func (t *ManageAllocations) substitute_collateral(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 7 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 7\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start substitute_collateral")
+
+	// Alloting Params
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	PriceChaincode := args[2]
+	SubstitutionID := args[3]
+	PledgerLongboxAccount := args[4]
+	PledgeeSegregatedAccount := args[5]
+	SubstitutionTimestamp := args[6]
+
+	// Fetch the Substitution, only approved ones go through
+	queryArgs := util.ToChaincodeArgs("getSubstitution_byID", SubstitutionID)
+	substitutionAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	SubstitutionData := Substitutions{}
+	json.Unmarshal(substitutionAsBytes, &SubstitutionData)
+	errMsg := ""
+	if SubstitutionData.SubstitutionId != SubstitutionID {
+		errMsg = "{ \"message\" : \"" + SubstitutionID + " Not Found.\", \"code\" : \"503\"}"
+	} else if SubstitutionData.Status == "Pending Approval" {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"Substitution is waiting for approval from " + SubstitutionData.Pledgee + ".\", \"code\" : \"503\"}"
+	} else if SubstitutionData.Status != "Approved" {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"Substitution is " + SubstitutionData.Status + " and can't be carried out.\", \"code\" : \"503\"}"
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// Fetch Deal details from Blockchain
+	queryArgs = util.ToChaincodeArgs("getDeal_byID", SubstitutionData.DealID)
+	dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	DealData := Deals{}
+	json.Unmarshal(dealAsBytes, &DealData)
+
+	// The transaction carrying the RQV the segregated account has to keep covering
+	queryArgs = util.ToChaincodeArgs("getTransaction_byID", SubstitutionData.TransactionID)
+	transactionAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	TransactionData := Transactions{}
+	json.Unmarshal(transactionAsBytes, &TransactionData)
+	if DealData.DealID != SubstitutionData.DealID || TransactionData.TransactionId != SubstitutionData.TransactionID {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"Deal or Transaction of the substitution Not Found.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// Securities are only swapped between the longbox and segregated accounts recorded on the deal
+	if PledgerLongboxAccount != DealData.LongboxAccount || PledgeeSegregatedAccount != DealData.SegregatedAccount {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + PledgerLongboxAccount + " and " + PledgeeSegregatedAccount + " are not the accounts recorded on " + DealData.DealID + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	// What the segregated account has to keep covering, the RQV on the deal's CSA terms
+	RQV, err := call_amount(TransactionData)
+	if err != nil {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	RQVCurrency := TransactionData.Currency
+	fmt.Println("RQV : ", RQV)
+
+	//-----------------------------------------------------------------------------
+
+	PublicRuleset, PublicRulesetVersion, err := fetch_public_ruleset(stub, DealChaincode, SubstitutionTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	Ruleset, _, errMsg, err := fetch_ruleset(stub, DealChaincode, DealData.Pledger, DealData.Pledgee, SubstitutionTimestamp, PublicRuleset)
+	if err != nil {
+		return nil, err
+	}
+	Affiliated, err := fetch_affiliations(stub, DealChaincode, DealData.Pledger)
+	if err != nil {
+		return nil, err
+	}
+	var ConversionRate CurrencyConversion
+	if errMsg == "" {
+		ConversionRate, errMsg, err = fetch_conversion_rates(stub, RQVCurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	WithdrawalIds, Withdrawals, err := security_quantities(SubstitutionData.Withdrawals)
+	if err != nil {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	ReplacementIds, Replacements, err := security_quantities(SubstitutionData.Replacements)
+	if err != nil {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// Value what the pledgee holds and the replacements offered from the longbox
+	var SegregatedSecurities, LongboxSecurities []Securities
+	for _, account := range []string{PledgeeSegregatedAccount, PledgerLongboxAccount} {
+		queryArgs = util.ToChaincodeArgs("getSecurities_byAccount", account)
+		SecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to fetch securities of "+account+" from 'Account' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		var SecuritiesJSON []Securities
+		json.Unmarshal(SecuritiesString, &SecuritiesJSON)
+		for _, tempSecurity := range SecuritiesJSON {
+			if account == PledgerLongboxAccount {
+				if _, found := Replacements[tempSecurity.SecurityId]; !found {
+					continue
+				}
+			}
+			if len(Ruleset.Security[tempSecurity.CollateralForm]) > 0 {
+				var Eligible bool
+				tempSecurity, Eligible, errMsg, err = value_security(stub, PriceChaincode, tempSecurity, ConversionRate, RQVCurrency, SubstitutionTimestamp, Ruleset)
+				if err != nil {
+					return nil, err
+				}
+				if errMsg != "" {
+					err = stub.SetEvent("errEvent", []byte(errMsg))
+					if err != nil {
+						return nil, err
+					}
+					return nil, nil
+				}
+				if !Eligible {
+					// No cell of its haircut grid fits it, it counts for nothing and swap_securities turns it down as a replacement
+					fmt.Println(haircut_reason(tempSecurity))
+				}
+			} else {
+				// Not eligible under the ruleset, it counts for nothing towards the RQV
+				tempSecurity.EffectiveValueChanged = "0.00"
+				tempSecurity.TotalValue = "0.00"
+			}
+			if account == PledgerLongboxAccount {
+				LongboxSecurities = append(LongboxSecurities, tempSecurity)
+			} else {
+				SegregatedSecurities = append(SegregatedSecurities, tempSecurity)
+			}
+		}
+	}
+
+	err = check_figures(append(append([]Securities(nil), SegregatedSecurities...), LongboxSecurities...))
+	if err != nil {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	var SwappedSecurities []Securities
+	var Reasons, Breaches []string
+	var ValueBefore, ValueAfter amount.Amount
+	RQVEligibleValue, err := concentration_limits(RQV, Ruleset.Security)
+	if err == nil {
+		err = issuer_limits(RQV, append(append([]Securities(nil), SegregatedSecurities...), LongboxSecurities...), RQVEligibleValue, Ruleset)
+	}
+	if err == nil {
+		SwappedSecurities, Reasons, err = swap_securities(SegregatedSecurities, LongboxSecurities, WithdrawalIds, Withdrawals, ReplacementIds, Replacements, Ruleset, Affiliated)
+	}
+	if err == nil {
+		ValueBefore, _, err = substitution_check(SegregatedSecurities, SegregatedSecurities, RQV, RQVEligibleValue, Ruleset)
+	}
+	if err == nil && len(Reasons) == 0 {
+		ValueAfter, Breaches, err = substitution_check(SegregatedSecurities, SwappedSecurities, RQV, RQVEligibleValue, Ruleset)
+	}
+	if err != nil {
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if len(Reasons) == 0 {
+		Reasons = Breaches
+	}
+	fmt.Println("Collateral value before: ", ValueBefore, " after: ", ValueAfter)
+
+	if len(Reasons) > 0 {
+		// Record why on the substitution and leave both accounts alone
+		invokeArgs := util.ToChaincodeArgs("update_substitution_status", SubstitutionID, "Substitution Failed", strings.Join(Reasons, "; "))
+		result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to update Substitution status from 'Deal' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+		ReasonsAsBytes, _ := json.Marshal(Reasons)
+		errMsg = "{ \"substitutionId\" : \"" + SubstitutionID + "\", \"message\" : \"Substitution Failed\", \"reasons\" : " + string(ReasonsAsBytes) + ", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Both legs go in this transaction, if either transfer fails neither is kept
+	var Movements []SecurityMovement
+	legs := []struct {
+		From, To   string
+		Ids        []string
+		Quantities map[string]amount.Amount
+	}{
+		{PledgeeSegregatedAccount, PledgerLongboxAccount, WithdrawalIds, Withdrawals},
+		{PledgerLongboxAccount, PledgeeSegregatedAccount, ReplacementIds, Replacements},
+	}
+	for _, leg := range legs {
+		transferArgs := []string{"transfer_securities", leg.From, leg.To}
+		for _, id := range leg.Ids {
+			quantity := leg.Quantities[id].String()
+			Movements = append(Movements, SecurityMovement{id, leg.From, leg.To, quantity})
+			transferArgs = append(transferArgs, id, quantity)
+		}
+		result, err := stub.InvokeChaincode(AccountChainCode, util.ToChaincodeArgs(transferArgs...))
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to transfer securities from "+leg.From+" to "+leg.To+" in 'Account' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+	}
+
+	invokeArgs := util.ToChaincodeArgs("update_substitution_status", SubstitutionID, "Substituted", "")
+	result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update Substitution status from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	//-----------------------------------------------------------------------------
+
+	respbody, _ := json.Marshal(ConversionRate)
+	reportInJson := `{`
+	reportInJson += `"Deal ID" : "` + DealData.DealID + `",`
+	reportInJson += `"Transaction ID" : "` + TransactionData.TransactionId + `",`
+	reportInJson += `"Substitution ID" : "` + SubstitutionID + `",`
+	reportInJson += `"Pledgee" : "` + DealData.Pledgee + `",`
+	reportInJson += `"Pledger" : "` + DealData.Pledger + `",`
+	reportInJson += `"Pledger Longbox Account" : "` + PledgerLongboxAccount + `",`
+	reportInJson += `"Pledgee Segregated Account" : "` + PledgeeSegregatedAccount + `",`
+	reportInJson += `"RQV" : "` + TransactionData.RQV + `",`
+	reportInJson += `"Call Amount" : "` + RQV.String() + `",`
+	reportInJson += `"Currency" : "` + RQVCurrency + `",`
+	reportInJson += `"Public Rule Set Version" : ` + strconv.Itoa(PublicRulesetVersion) + `,`
+	reportInJson += `"Currency Conversion Rate" : ` + string(respbody) + `,`
+	reportInJson += `"Collateral Value Before" : "` + ValueBefore.String() + `",`
+	reportInJson += `"Collateral Value After" : "` + ValueAfter.String() + `",`
+	reportInJson += `"Securities To Move" : ` + movements_json(Movements) + `,`
+	reportInJson += `"Pledgee Segregated Securities" : ` + securities_json(SwappedSecurities) + `,`
+	reportInJson += `"Substitution Date" : ` + SubstitutionTimestamp + `,`
+	reportInJson += `"Substitution Status" : "Substituted",`
+	reportInJson += `"Wrong Way Holdings" : ` + reasons_json(wrong_way_holdings(SwappedSecurities, Affiliated)) + `,`
+	reportInJson += `"Rating Breaches" : ` + reasons_json(rating_breaches(SwappedSecurities, Ruleset)) + `,`
+	reportInJson += `"Currency Breaches" : ` + reasons_json(currency_breaches(SwappedSecurities, Ruleset)) + `,`
+	reportInJson += `"Compliance Status" : "` + compliance_check(SwappedSecurities, ConversionRate, RQVCurrency, PublicRuleset, Ruleset, Affiliated) + `"`
+	reportInJson += `}`
+	fmt.Println(reportInJson)
+
+	//Sending Report
+	err = stub.SetEvent("evtsender", []byte(reportInJson))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end substitute_collateral")
+	return nil, nil
+}
+
+// security_quantities splits securityId:quantity,... into the ids in the order given and the quantity of each
+func security_quantities(list string) ([]string, map[string]amount.Amount, error) {
+	var ids []string
+	quantities := make(map[string]amount.Amount)
+	for _, line := range strings.Split(list, ",") {
+		parts := strings.Split(line, ":")
+		if len(parts) != 2 {
+			continue
+		}
+		id := strings.TrimSpace(parts[0])
+		quantity, err := amount.ParseQuantity(strings.TrimSpace(parts[1]))
+		if err == nil {
+			quantity, err = quantity.Add(quantities[id])
+		}
+		if err != nil {
+			return nil, nil, errors.New("Quantity of " + id + ": " + err.Error())
+		}
+		if _, found := quantities[id]; !found {
+			ids = append(ids, id)
+		}
+		quantities[id] = quantity
+	}
+	return ids, quantities, nil
+}
+
+// ============================================================================================================================
+// swap_securities - segregated holdings once the withdrawals are out and the replacements are in
+// Returns why the swap can't be made instead when a security isn't there to move or isn't eligible
+// ============================================================================================================================
+func swap_securities(SegregatedSecurities []Securities, LongboxSecurities []Securities, WithdrawalIds []string, Withdrawals map[string]amount.Amount, ReplacementIds []string, Replacements map[string]amount.Amount, Ruleset Ruleset, Affiliated Affiliations) ([]Securities, []string, error) {
+	var Reasons []string
+	Held := make(map[string]amount.Amount)
+	for _, valueSecurity := range SegregatedSecurities {
+		quantity, err := amount.ParseQuantity(valueSecurity.SecuritiesQuantity)
+		if err == nil {
+			Held[valueSecurity.SecurityId], err = quantity.Add(Held[valueSecurity.SecurityId])
+		}
+		if err != nil {
+			return nil, nil, errors.New("Quantity of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+	}
+	Available := make(map[string]Securities)
+	Offered := make(map[string]amount.Amount)
+	for _, valueSecurity := range LongboxSecurities {
+		quantity, err := amount.ParseQuantity(valueSecurity.SecuritiesQuantity)
+		if err != nil {
+			return nil, nil, errors.New("Quantity of " + valueSecurity.SecurityId + ": " + err.Error())
+		}
+		Available[valueSecurity.SecurityId] = valueSecurity
+		Offered[valueSecurity.SecurityId] = quantity
+	}
+	for _, id := range WithdrawalIds {
+		if Held[id].Cmp(Withdrawals[id]) < 0 {
+			Reasons = append(Reasons, id+": segregated account holds "+quantity_string(Held[id])+", "+Withdrawals[id].String()+" requested")
+		}
+	}
+	for _, id := range ReplacementIds {
+		valueSecurity, found := Available[id]
+		if !found || Offered[id].Cmp(Replacements[id]) < 0 {
+			Reasons = append(Reasons, id+": longbox account holds "+quantity_string(Offered[id])+", "+Replacements[id].String()+" offered")
+		} else if len(Ruleset.Security[valueSecurity.CollateralForm]) > 0 && valueSecurity.HaircutCell == "" {
+			Reasons = append(Reasons, id+": "+haircut_reason(valueSecurity))
+		} else if checked_float(valueSecurity.EffectiveValueChanged) <= 0 {
+			Reasons = append(Reasons, id+": "+valueSecurity.CollateralForm+" is not eligible under the rule set")
+		} else if wrong_way(valueSecurity, Affiliated) {
+			Reasons = append(Reasons, id+": issued by "+valueSecurity.Issuer+", affiliated with pledger "+Affiliated.Pledger)
+		} else if !rating_eligible(valueSecurity, Ruleset) {
+			Reasons = append(Reasons, id+": rated "+valueSecurity.Rating+", below the "+Ruleset.MinimumRating[valueSecurity.CollateralForm]+" minimum for "+valueSecurity.CollateralForm)
+		} else if !currency_eligible(valueSecurity, Ruleset) {
+			Reasons = append(Reasons, id+": "+currency_reason(valueSecurity, Ruleset))
+		}
+	}
+	if len(Reasons) > 0 {
+		return nil, Reasons, nil
+	}
+
+	var Swapped []Securities
+	Merged := make(map[string]bool)
+	for _, valueSecurity := range SegregatedSecurities {
+		id := valueSecurity.SecurityId
+		if Merged[id] {
+			continue
+		}
+		quantity, err := Held[id].Sub(Withdrawals[id])
+		if err == nil {
+			quantity, err = quantity.Add(Replacements[id])
+		}
+		if err != nil {
+			return nil, nil, errors.New("Quantity of " + id + ": " + err.Error())
+		}
+		Merged[id] = true
+		if quantity.Sign() > 0 {
+			Swapped = append(Swapped, allocated_line(valueSecurity, quantity.Float64()))
+		}
+	}
+	for _, id := range ReplacementIds {
+		if Merged[id] {
+			continue
+		}
+		Swapped = append(Swapped, allocated_line(Available[id], Replacements[id].Float64()))
+	}
+	sort.Sort(by_priority(Swapped, Ruleset))
+	return Swapped, nil, nil
+}
+
+// quantity_string - a quantity held, at the decimals quantities are kept to
+func quantity_string(quantity amount.Amount) string {
+	Quantity, err := quantity.Round(amount.QuantityScale, amount.DefaultRounding)
+	if err != nil {
+		return quantity.String()
+	}
+	return Quantity.String()
+}
+
+// ============================================================================================================================
+// substitution_check - value counted towards the RQV after the swap, and the rules the swap would break
+// A collateral form, issuer or issuer group may stay over its limit, but the swap can't add to it
+// ============================================================================================================================
+func substitution_check(Before []Securities, After []Securities, RQV amount.Amount, RQVEligibleValue map[string]amount.Amount, Ruleset Ruleset) (amount.Amount, []string, error) {
+	Currency := RQV.Currency
+	var Reasons []string
+	HeldBefore := make(map[string]amount.Amount)
+	HeldAfter := make(map[string]amount.Amount)
+	Forms := make(map[string]bool)
+	for _, list := range []struct {
+		Securities []Securities
+		Held       map[string]amount.Amount
+	}{{Before, HeldBefore}, {After, HeldAfter}} {
+		for _, valueSecurity := range list.Securities {
+			value, err := amount.ParseAmount(valueSecurity.TotalValue, Currency)
+			if err != nil {
+				return amount.Amount{}, nil, errors.New("Total value of " + valueSecurity.SecurityId + ": " + err.Error())
+			}
+			for _, key := range concentration_keys(valueSecurity, RQVEligibleValue, Ruleset) {
+				list.Held[key], err = held_value(list.Held, key, Currency).Add(value)
+				if err != nil {
+					return amount.Amount{}, nil, err
+				}
+			}
+		}
+	}
+	for _, valueSecurity := range After {
+		Forms[valueSecurity.CollateralForm] = true
+	}
+	var keys []string
+	for key := range HeldAfter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	CollateralValue := amount.Zero(Currency)
+	for _, key := range keys {
+		limit := held_value(RQVEligibleValue, key, Currency)
+		if Forms[key] {
+			var err error
+			CollateralValue, err = CollateralValue.Add(min_amount(HeldAfter[key], limit))
+			if err != nil {
+				return amount.Amount{}, nil, err
+			}
+		}
+		if HeldAfter[key].Cmp(limit) > 0 && HeldAfter[key].Cmp(held_value(HeldBefore, key, Currency)) > 0 {
+			Reasons = append(Reasons, key+": "+HeldAfter[key].String()+" held over its concentration limit of "+limit.String())
+		}
+	}
+	if CollateralValue.Cmp(RQV) < 0 {
+		Reasons = append(Reasons, "Collateral value "+CollateralValue.String()+" would be under the RQV of "+RQV.String())
+	}
+	return CollateralValue, Reasons, nil
+}
@@ -0,0 +1,189 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// The parts of a stored allocation report needed to reverse it
+type StoredAllocation struct {
+	DealID                   string             `json:"Deal ID"`
+	TransactionId            string             `json:"Transaction ID"`
+	PledgerLongboxAccount    string             `json:"Pledger Longbox Account"`
+	PledgeeSegregatedAccount string             `json:"Pledgee Segregated Account"`
+	Currency                 string             `json:"Currency"`
+	Movements                []SecurityMovement `json:"Securities To Move"`
+	AllocationStatus         string             `json:"Allocation Status"`
+}
+
+// ============================================================================================================================
+// undo_allocation - reverse a successful allocation from its stored report: every security moved goes back where it came
+// from, the margin call is ready for allocation again and the deal no longer has a last successful allocation date
+// Arguments : DealChaincode, AccountChainCode, TransactionId
+// ============================================================================================================================
+func (t *ManageAllocations) undo_allocation(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 3 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 3\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start undo_allocation")
+
+	DealChaincode := args[0]
+	AccountChainCode := args[1]
+	TransactionID := args[2]
+
+	reportAsBytes, err := stub.GetState(AllocationReportPrefix + TransactionID)
+	if err != nil {
+		return nil, errors.New("Failed to get allocation report of " + TransactionID)
+	}
+	Report := StoredAllocation{}
+	json.Unmarshal(reportAsBytes, &Report)
+	if Report.TransactionId != TransactionID || Report.AllocationStatus != "Allocation Successful" {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"No successful allocation report for " + TransactionID + ", nothing to undo.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// Only the allocation the segregated account reflects now can be reversed, and only once
+	TransactionData, err := covering_transaction(stub, DealChaincode, Report.DealID)
+	if err != nil {
+		return nil, err
+	}
+	if TransactionData.TransactionId != TransactionID {
+		errMsg := "{ \"transactionId\" : \"" + TransactionID + "\", \"message\" : \"" + TransactionID + " is not the last successful allocation of " + Report.DealID + ", it cannot be undone.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	queryArgs := util.ToChaincodeArgs("getDeal_byID", Report.DealID)
+	dealAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to query chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	DealData := Deals{}
+	json.Unmarshal(dealAsBytes, &DealData)
+	if DealData.DealID != Report.DealID {
+		errMsg := "{ \"message\" : \"" + Report.DealID + " Not Found.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	//-----------------------------------------------------------------------------
+
+	// Move every security back, one transfer per direction. A holding that has since gone fails the transfer and the undo with it.
+	var Reversals []SecurityMovement
+	for _, valueMovement := range Report.Movements {
+		Reversals = append(Reversals, SecurityMovement{valueMovement.SecurityId, valueMovement.To, valueMovement.From, valueMovement.Quantity})
+	}
+	function := "transfer_securities"
+	for _, Direction := range [][]string{{Report.PledgeeSegregatedAccount, Report.PledgerLongboxAccount}, {Report.PledgerLongboxAccount, Report.PledgeeSegregatedAccount}} {
+		transferArgs := []string{function, Direction[0], Direction[1]}
+		for _, valueMovement := range Reversals {
+			if valueMovement.From == Direction[0] {
+				transferArgs = append(transferArgs, valueMovement.SecurityId, valueMovement.Quantity)
+			}
+		}
+		if len(transferArgs) == 3 {
+			continue
+		}
+		result, err := stub.InvokeChaincode(AccountChainCode, util.ToChaincodeArgs(transferArgs...))
+		if err != nil {
+			errStr := fmt.Sprintf("Failed to transfer securities from "+Direction[0]+" to "+Direction[1]+" in 'Account' chaincode. Got error: %s", err.Error())
+			fmt.Printf(errStr)
+			return nil, errors.New(errStr)
+		}
+		fmt.Println(result)
+	}
+	fmt.Println("Securities returned between accounts")
+
+	//-----------------------------------------------------------------------------
+
+	// The margin call is open again
+	invokeArgs := util.ToChaincodeArgs("update_transaction_AllocationStatus", TransactionID, "Ready for Allocation")
+	result, err := stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update Transaction status from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	// Segregated total as the account holds it after the return
+	queryArgs = util.ToChaincodeArgs("getSecurities_byAccount", Report.PledgeeSegregatedAccount)
+	SecuritiesString, err := stub.QueryChaincode(AccountChainCode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch securities of "+Report.PledgeeSegregatedAccount+" from 'Account' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	var SegregatedSecurities []Securities
+	json.Unmarshal(SecuritiesString, &SegregatedSecurities)
+	SegregatedValue, err := total_value(SegregatedSecurities, Report.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// No successful allocation stands any more
+	invokeArgs = util.ToChaincodeArgs("set_account_values",
+		DealData.DealID,
+		DealData.TotalValueLongBoxAccount,
+		SegregatedValue.String(),
+		"")
+	result, err = stub.InvokeChaincode(DealChaincode, invokeArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to update Deal from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return nil, errors.New(errStr)
+	}
+	fmt.Println(result)
+
+	tosend := "{ \"transactionId\" : \"" + TransactionID + "\", \"dealId\" : \"" + Report.DealID + "\", " +
+		"\"Securities Returned\" : " + movements_json(Reversals) + ", \"Total Value Segregated Account\" : \"" + SegregatedValue.String() + "\", " +
+		"\"Allocation Status\" : \"Ready for Allocation\", \"message\" : \"Allocation reversed succcessfully\", \"code\" : \"200\"}"
+	fmt.Println(tosend)
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end undo_allocation")
+	return nil, nil
+}
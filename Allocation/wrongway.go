@@ -0,0 +1,89 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// Pledger of a deal and the issuers affiliated with it, as fetch_affiliations reads them
+type Affiliations struct {
+	Pledger string
+	Issuers map[string]bool
+}
+
+// ============================================================================================================================
+// fetch_affiliations - read the issuers affiliated with the pledger from the Deal chaincode
+// ============================================================================================================================
+func fetch_affiliations(stub shim.ChaincodeStubInterface, DealChaincode string, Pledger string) (Affiliations, error) {
+	queryArgs := util.ToChaincodeArgs("getAffiliations_byCounterparty", Pledger)
+	affiliationsAsBytes, err := stub.QueryChaincode(DealChaincode, queryArgs)
+	if err != nil {
+		errStr := fmt.Sprintf("Failed to fetch affiliations of "+Pledger+" from 'Deal' chaincode. Got error: %s", err.Error())
+		fmt.Printf(errStr)
+		return Affiliations{}, errors.New(errStr)
+	}
+	var Affiliates []string
+	json.Unmarshal(affiliationsAsBytes, &Affiliates)
+
+	// Securities the pledger issued itself are as bad as its affiliates'
+	Affiliated := Affiliations{Pledger: Pledger, Issuers: map[string]bool{Pledger: true}}
+	for _, issuer := range Affiliates {
+		Affiliated.Issuers[issuer] = true
+	}
+	fmt.Println("Issuers affiliated with the pledger: ", Affiliated.Issuers)
+	return Affiliated, nil
+}
+
+// wrong_way - whether the security was issued by the pledger or one of its affiliates
+func wrong_way(valueSecurity Securities, Affiliated Affiliations) bool {
+	return valueSecurity.Issuer != "" && Affiliated.Issuers[valueSecurity.Issuer]
+}
+
+// ============================================================================================================================
+// wrong_way_holdings - reasons for each security in the segregated account issued by the pledger or its affiliates
+// ============================================================================================================================
+func wrong_way_holdings(SegregatedSecurities []Securities, Affiliated Affiliations) []string {
+	var Reasons []string
+	for _, valueSecurity := range SegregatedSecurities {
+		if wrong_way(valueSecurity, Affiliated) {
+			Reasons = append(Reasons, valueSecurity.SecurityId+" issued by "+valueSecurity.Issuer+", affiliated with pledger "+Affiliated.Pledger)
+		}
+	}
+	return Reasons
+}
+
+// Reasons as a json array for the reports
+func reasons_json(reasons []string) string {
+	if len(reasons) == 0 {
+		return `[]`
+	}
+	reasonsAsBytes, err := json.Marshal(reasons)
+	if err != nil {
+		fmt.Println("Error while converting reasons to string")
+		return `[]`
+	}
+	return string(reasonsAsBytes)
+}
@@ -0,0 +1,145 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("fmt"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim")
+
+var affiliationPrefix = "_affiliations_" //key prefix for the list of issuers affiliated with a counterparty
+
+// ============================================================================================================================
+// add_affiliation - register issuers as affiliated with a counterparty (the counterparty itself, its parent, subsidiaries...)
+// Arguments : counterparty, followed by one or more issuers
+// ============================================================================================================================
+func(t * ManageDeals) add_affiliation(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) < 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting counterparty and at least one issuer\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start add_affiliation")
+    _counterparty:= args[0]
+    var affiliations[] string
+    affiliationsAsBytes, err:= stub.GetState(affiliationPrefix + _counterparty)
+    if err != nil {
+        return nil, err
+    }
+    json.Unmarshal(affiliationsAsBytes, &affiliations)
+    for _, _issuer:= range args[1: ] {
+        _issuer = strings.TrimSpace(_issuer)
+        found:= false
+        for _, val:= range affiliations {
+            if val == _issuer {
+                found = true
+            }
+        }
+        if !found && _issuer != "" {
+            affiliations = append(affiliations, _issuer)
+        }
+    }
+    jsonAsBytes, _:= json.Marshal(affiliations)
+    err = stub.PutState(affiliationPrefix + _counterparty, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"counterparty\" : \"" + _counterparty + "\", \"message\" : \"Affiliations added succcessfully\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end add_affiliation")
+    return nil, nil
+}
+// ============================================================================================================================
+// remove_affiliation - take issuers off a counterparty's affiliations
+// Arguments : counterparty, followed by one or more issuers
+// ============================================================================================================================
+func(t * ManageDeals) remove_affiliation(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) < 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting counterparty and at least one issuer\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start remove_affiliation")
+    _counterparty:= args[0]
+    var affiliations, kept[] string
+    affiliationsAsBytes, err:= stub.GetState(affiliationPrefix + _counterparty)
+    if err != nil {
+        return nil, err
+    }
+    json.Unmarshal(affiliationsAsBytes, &affiliations)
+    for _, val:= range affiliations {
+        removed:= false
+        for _, _issuer:= range args[1: ] {
+            if val == strings.TrimSpace(_issuer) {
+                removed = true
+            }
+        }
+        if !removed {
+            kept = append(kept, val)
+        }
+    }
+    jsonAsBytes, _:= json.Marshal(kept)
+    err = stub.PutState(affiliationPrefix + _counterparty, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"counterparty\" : \"" + _counterparty + "\", \"message\" : \"Affiliations removed succcessfully\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end remove_affiliation")
+    return nil, nil
+}
+// ============================================================================================================================
+// getAffiliations_byCounterparty - issuers affiliated with a counterparty as a json array
+// ============================================================================================================================
+func(t * ManageDeals) getAffiliations_byCounterparty(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 1 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 'counterparty' as an argument\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    var affiliations[] string
+    affiliationsAsBytes, err:= stub.GetState(affiliationPrefix + args[0])
+    if err != nil {
+        return nil, err
+    }
+    json.Unmarshal(affiliationsAsBytes, &affiliations)
+    if len(affiliations) == 0 {
+        return [] byte("[]"), nil
+    }
+    jsonAsBytes, _:= json.Marshal(affiliations)
+    return jsonAsBytes, nil
+}
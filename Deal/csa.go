@@ -0,0 +1,174 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "strings"
+        "github.com/hyperledger/fabric/core/chaincode/shim"
+        "github.com/mukutb/TCM-new/amount")
+
+// ============================================================================================================================
+// csa_call - call amount for a margin call of rqv on the deal's CSA terms
+// Returns an empty amount when the change from what the segregated account holds is under the minimum transfer amount,
+// and an error message when the call is in a currency the CSA does not accept or its figures do not read
+// ============================================================================================================================
+func csa_call(res_Deal Deals, _rqv string, _currency string) (string, string) {
+    if res_Deal.EligibleCurrency != "" {
+        eligible:= false
+        for _, val:= range strings.Split(res_Deal.EligibleCurrency, ",") {
+            if strings.TrimSpace(val) == _currency {
+                eligible = true
+            }
+        }
+        if !eligible {
+            return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"Currency " + _currency + " is not eligible under the CSA, expecting " + res_Deal.EligibleCurrency + ".\", \"code\" : \"503\"}"
+        }
+    }
+    _exposure, err:= amount.ParseAmount(_rqv, _currency)
+    if err != nil {
+        return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"Invalid RQV " + _rqv + ".\", \"code\" : \"503\"}"
+    }
+    _callAmount, err:= csa_amount(res_Deal, _exposure)
+    if err != nil {
+        return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+    }
+
+    // Only the change from what is held moves, the minimum transfer amount applies to it either way
+    _held, err:= csa_term(res_Deal.TotalValueSegregatedAccount, _currency)
+    if err != nil {
+        return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"Segregated account value: " + err.Error() + "\", \"code\" : \"503\"}"
+    }
+    _mta, err:= csa_term(res_Deal.MinimumTransferAmount, _currency)
+    if err != nil {
+        return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"Minimum transfer amount: " + err.Error() + "\", \"code\" : \"503\"}"
+    }
+    _transfer, err:= _callAmount.Sub(_held)
+    if err != nil {
+        return "", "{ \"dealId\" : \"" + res_Deal.DealID + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+    }
+    if _transfer.Sign() == 0 || _transfer.Abs().Cmp(_mta) < 0 {
+        fmt.Println("Transfer of " + _transfer.Abs().String() + " under the minimum transfer amount")
+        return "", ""
+    }
+    return _callAmount.String(), ""
+}
+// ============================================================================================================================
+// csa_amount - collateral the pledgee should hold for an exposure: exposure plus independent amount less threshold, rounded
+// ============================================================================================================================
+func csa_amount(res_Deal Deals, _exposure amount.Amount) (amount.Amount, error) {
+    _independentAmount, err:= csa_term(res_Deal.IndependentAmount, _exposure.Currency)
+    if err != nil {
+        return amount.Amount{}, errors.New("Independent amount: " + err.Error())
+    }
+    _threshold, err:= csa_term(res_Deal.Threshold, _exposure.Currency)
+    if err != nil {
+        return amount.Amount{}, errors.New("Threshold: " + err.Error())
+    }
+    _amount, err:= _exposure.Add(_independentAmount)
+    if err == nil {
+        _amount, err = _amount.Sub(_threshold)
+    }
+    if err != nil {
+        return amount.Amount{}, err
+    }
+    if _amount.Sign() <= 0 {
+        return amount.Zero(_exposure.Currency), nil
+    }
+    return csa_round(_amount, res_Deal.Rounding)
+}
+// ============================================================================================================================
+// csa_round - round an amount by the CSA rounding convention, "Up 10000", "Down 1000" or "Nearest 100"
+// A bare unit rounds up, a blank convention leaves the amount as it is
+// ============================================================================================================================
+func csa_round(_amount amount.Amount, _rounding string) (amount.Amount, error) {
+    fields:= strings.Fields(_rounding)
+    if len(fields) == 0 {
+        return _amount, nil
+    }
+    if len(fields) == 1 {
+        fields = append([] string {"Up"}, fields...)
+    }
+    _unit, err:= amount.ParseAmount(fields[1], _amount.Currency)
+    if err != nil || _unit.Sign() <= 0 || len(fields) != 2 {
+        return amount.Amount{}, errors.New("Unreadable rounding " + _rounding)
+    }
+    var _mode amount.RoundingMode
+    switch fields[0] {
+    case "Up":
+        _mode = amount.RoundCeiling
+    case "Down":
+        _mode = amount.RoundFloor
+    case "Nearest":
+        _mode = amount.RoundHalfUp
+    default:
+        return amount.Amount{}, errors.New("Unreadable rounding " + _rounding)
+    }
+    // Whole number of units, then back to an amount in the currency
+    _units, err:= _amount.Div(_unit, 0, _mode)
+    if err != nil {
+        return amount.Amount{}, err
+    }
+    return _units.Mul(_unit, _amount.Scale, _mode)
+}
+// ============================================================================================================================
+// csa_term - a CSA amount stored on the deal, in the currency of the call; blank counts as zero
+// ============================================================================================================================
+func csa_term(_term string, _currency string) (amount.Amount, error) {
+    if strings.TrimSpace(_term) == "" {
+        return amount.Zero(_currency), nil
+    }
+    return amount.ParseAmount(_term, _currency)
+}
+// ============================================================================================================================
+// set_csa_terms - record the CSA terms margin calls on a Deal are made on
+// Amounts are blank for none and read in the currency of each call, marginCallConfirmation is "Required" or blank
+// ============================================================================================================================
+func(t * ManageDeals) set_csa_terms(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 7 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting dealId, minimumTransferAmount, threshold, marginCallConfirmation, rounding, independentAmount and eligibleCurrency\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    return update_deal_fields(stub, args[0], "Deal CSA terms updated succcessfully", func(res * Deals) string {
+        _names:= map[int] string {1: "Minimum transfer amount", 2: "Threshold", 5: "Independent amount"}
+        for _, i:= range [] int {1, 2, 5} {
+            if _, err:= csa_term(args[i], ""); err != nil {
+                return "{ \"dealId\" : \"" + args[0] + "\", \"message\" : \"" + _names[i] + ": " + err.Error() + "\", \"code\" : \"503\"}"
+            }
+        }
+        if args[3] != "" && args[3] != "Required" {
+            return "{ \"dealId\" : \"" + args[0] + "\", \"message\" : \"Margin call confirmation must be 'Required' or blank.\", \"code\" : \"503\"}"
+        }
+        if _, err:= csa_round(amount.Zero(""), args[4]); err != nil {
+            return "{ \"dealId\" : \"" + args[0] + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+        }
+        res.MinimumTransferAmount = args[1]
+        res.Threshold = args[2]
+        res.MarginCallConfirmation = args[3]
+        res.Rounding = args[4]
+        res.IndependentAmount = args[5]
+        res.EligibleCurrency = args[6]
+        return ""
+    })
+}
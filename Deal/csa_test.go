@@ -0,0 +1,87 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/mukutb/TCM-new/amount"
+)
+
+func TestCsaAmount(t *testing.T) {
+    tests := []struct {
+        exposure string
+        currency string
+        independentAmount string
+        threshold string
+        rounding string
+        want string
+    }{
+        {"1000000.00", "EUR", "", "", "", "1000000.00"},
+        {"1000000.00", "EUR", "50000", "250000", "", "800000.00"},
+        {"1234567.89", "EUR", "", "", "Up 10000", "1240000.00"},
+        {"1234567.89", "EUR", "", "", "Down 10000", "1230000.00"},
+        {"1234567.89", "EUR", "", "", "Nearest 1000", "1235000.00"},
+        {"1234567.89", "EUR", "", "", "1000", "1235000.00"},
+        {"100000.00", "EUR", "", "250000", "Up 10000", "0.00"},
+        {"250000.00", "EUR", "", "250000", "", "0.00"},
+        {"123456789", "JPY", "1000000", "", "Up 100000", "124500000"},
+    }
+    for _, test := range tests {
+        exposure, err := amount.ParseAmount(test.exposure, test.currency)
+        if err != nil {
+            t.Fatal(err)
+        }
+        res_Deal := Deals{IndependentAmount: test.independentAmount, Threshold: test.threshold, Rounding: test.rounding}
+        got, err := csa_amount(res_Deal, exposure)
+        if err != nil || got.String() != test.want || got.Currency != test.currency {
+            t.Errorf("csa_amount(%s %s, %q, %q, %q) = %s %s, %v, want %s", test.currency, test.exposure, test.independentAmount, test.threshold, test.rounding, got, got.Currency, err, test.want)
+        }
+    }
+}
+
+func TestCsaAmountRejects(t *testing.T) {
+    exposure, err := amount.ParseAmount("1000.00", "EUR")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, res_Deal := range []Deals{
+        {IndependentAmount: "ten"},
+        {Threshold: "1,000"},
+        {Rounding: "Sideways 100"},
+        {Rounding: "Up 0"},
+        {Rounding: "Up -100"},
+        {Rounding: "Up 100 EUR"},
+    } {
+        if got, err := csa_amount(res_Deal, exposure); err == nil {
+            t.Errorf("csa_amount(%+v) = %s, want an error", res_Deal, got)
+        }
+    }
+}
+
+func TestCsaRound(t *testing.T) {
+    tests := []struct {
+        value string
+        currency string
+        rounding string
+        want string
+    }{
+        {"10000.00", "EUR", "Up 10000", "10000.00"},
+        {"10000.01", "EUR", "Up 10000", "20000.00"},
+        {"19999.99", "EUR", "Down 10000", "10000.00"},
+        {"14999.99", "EUR", "Nearest 10000", "10000.00"},
+        {"15000.00", "EUR", "Nearest 10000", "20000.00"},
+        {"0.01", "USD", "Up 0.05", "0.05"},
+        {"1234.567", "BHD", "Down 0.5", "1234.500"},
+        {"1234.56", "EUR", "", "1234.56"},
+        {"1234.56", "EUR", "  ", "1234.56"},
+    }
+    for _, test := range tests {
+        value, err := amount.ParseAmount(test.value, test.currency)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got, err := csa_round(value, test.rounding)
+        if err != nil || got.String() != test.want {
+            t.Errorf("csa_round(%s %s, %q) = %s, %v, want %s", test.currency, test.value, test.rounding, got, err, test.want)
+        }
+    }
+}
@@ -0,0 +1,158 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "time"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim")
+
+var cutoffPrefix = "_cutoff_" //key prefix for the allocation cutoff of a deal ("_cutoff_Deal_<dealId>") or a pledgee ("_cutoff_Pledgee_<pledgee>")
+
+type Cutoffs struct { // Time of day collateral has to arrive by for a pending margin call to be allocated that day
+    Scope string `json:"scope"` // Deal, Pledgee or Default
+    CutoffTime string `json:"cutoffTime"` // HH:MM local time, collateral arriving from then on is too late
+    Timezone string `json:"timezone"` // IANA time zone, e.g. Europe/London
+    BusinessDays string `json:"businessDays"` // comma separated weekdays, e.g. Mon,Tue,Wed,Thu,Fri; empty for every day
+    Holidays string `json:"holidays"` // comma separated YYYY-MM-DD dates that are not business days
+}
+
+// Cutoff of deals and pledgees without one, the 18:59 UTC the allocation used before cutoffs were configurable
+var defaultCutoff = Cutoffs{Scope: "Default", CutoffTime: "19:00", Timezone: "UTC"}
+
+var weekdays = map[string]bool{"Mon": true, "Tue": true, "Wed": true, "Thu": true, "Fri": true, "Sat": true, "Sun": true}
+
+// ============================================================================================================================
+// set_cutoff - configure the allocation cutoff of a deal or of every deal of a pledgee; a deal's own cutoff wins
+// Arguments : scope (Deal or Pledgee), dealId or pledgee, cutoffTime (HH:MM), timezone (IANA), businessDays, holidays
+// ============================================================================================================================
+func(t * ManageDeals) set_cutoff(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 6 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 6\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start set_cutoff")
+    _cutoff:= Cutoffs {
+        Scope: args[0],
+        CutoffTime: strings.TrimSpace(args[2]),
+        Timezone: strings.TrimSpace(args[3]),
+        BusinessDays: strings.TrimSpace(args[4]),
+        Holidays: strings.TrimSpace(args[5]),
+    }
+    _id:= args[1]
+    err = valid_cutoff(_cutoff)
+    if err == nil && _cutoff.Scope != "Deal" && _cutoff.Scope != "Pledgee" {
+        err = errors.New("Scope has to be Deal or Pledgee")
+    }
+    if err != nil {
+        errMsg:= "{ \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    jsonAsBytes, _:= json.Marshal(_cutoff)
+    err = stub.PutState(cutoffPrefix + _cutoff.Scope + "_" + _id, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"" + strings.ToLower(_cutoff.Scope) + "\" : \"" + _id + "\", \"message\" : \"Cutoff set succcessfully\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end set_cutoff")
+    return nil, nil
+}
+// ============================================================================================================================
+// valid_cutoff - check the cutoff time, time zone and calendar read
+// ============================================================================================================================
+func valid_cutoff(_cutoff Cutoffs) error {
+    if _, err:= time.Parse("15:04", _cutoff.CutoffTime); err != nil {
+        return errors.New("Invalid cutoff time " + _cutoff.CutoffTime + ", expecting HH:MM")
+    }
+    if _, err:= time.LoadLocation(_cutoff.Timezone); err != nil || _cutoff.Timezone == "" {
+        return errors.New("Unknown time zone " + _cutoff.Timezone)
+    }
+    if _cutoff.BusinessDays != "" {
+        for _, val:= range strings.Split(_cutoff.BusinessDays, ",") {
+            if !weekdays[strings.TrimSpace(val)] {
+                return errors.New("Invalid business day " + val + ", expecting Mon to Sun")
+            }
+        }
+    }
+    if _cutoff.Holidays != "" {
+        for _, val:= range strings.Split(_cutoff.Holidays, ",") {
+            if _, err:= time.Parse("2006-01-02", strings.TrimSpace(val)); err != nil {
+                return errors.New("Invalid holiday " + val + ", expecting YYYY-MM-DD")
+            }
+        }
+    }
+    return nil
+}
+// ============================================================================================================================
+// getCutoff_byDeal - the cutoff that applies to a deal: its own, else its pledgee's, else the default
+// ============================================================================================================================
+func(t * ManageDeals) getCutoff_byDeal(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 1 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 'DealId' as an argument\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start getCutoff_byDeal")
+    _dealId:= args[0]
+    dealAsBytes, err:= stub.GetState(_dealId)
+    if err != nil {
+        return nil, errors.New("Failed to get Deal " + _dealId)
+    }
+    res_Deal:= Deals {}
+    json.Unmarshal(dealAsBytes, &res_Deal)
+    if res_Deal.DealID != _dealId {
+        errMsg:= "{ \"message\" : \"" + _dealId + " Not Found.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    for _, _key:= range [] string {cutoffPrefix + "Deal_" + _dealId, cutoffPrefix + "Pledgee_" + res_Deal.Pledgee} {
+        cutoffAsBytes, err:= stub.GetState(_key)
+        if err != nil {
+            return nil, err
+        }
+        if len(cutoffAsBytes) > 0 {
+            fmt.Println("end getCutoff_byDeal")
+            return cutoffAsBytes, nil
+        }
+    }
+    fmt.Println("end getCutoff_byDeal")
+    return json.Marshal(defaultCutoff)
+}
@@ -0,0 +1,224 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "time"
+        "strconv"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim"
+        "github.com/mukutb/TCM-new/amount")
+
+// Allocation statuses of a margin call that still has to be settled
+var openAllocationStatus = map[string]bool {
+    "Ready for Allocation": true,
+    "Deal Unmatched. Can't be allocated": true,
+    "Allocation in progress": true,
+    "Pending due to insufficient collateral": true,
+}
+
+// ============================================================================================================================
+// create_margin_call - raise the follow-up margin call when a Deal's collateral is revalued under what it has to cover
+// Margin calls are for the total collateral, so the call is for the full exposure and the shortfall is recorded with it
+// The call goes through create_transaction, so the deal's CSA terms decide the amount and whether it is made at all
+// Arguments : dealId, rqv (the full exposure), currency, valuation timestamp (seconds), shortfall
+// ============================================================================================================================
+func(t * ManageDeals) create_margin_call(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 5 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting dealId, rqv, currency, valuation date and shortfall\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start create_margin_call")
+    _dealId:= args[0]
+    _rqv:= args[1]
+    _currency:= args[2]
+    _valuationDate:= args[3]
+    _shortFall:= args[4]
+    _valuationSeconds, errBool:= strconv.ParseInt(_valuationDate, 10, 64)
+    if errBool != nil {
+        errMsg:= "{ \"dealId\" : \"" + _dealId + "\", \"message\" : \"Invalid valuation date " + _valuationDate + ".\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    res_Deal:= Deals {}
+    dealAsBytes, err:= stub.GetState(_dealId)
+    if err != nil {
+        return nil, errors.New("Failed to get Deal " + _dealId)
+    }
+    json.Unmarshal(dealAsBytes, &res_Deal)
+    if res_Deal.DealID != _dealId {
+        errMsg:= "{ \"message\" : \"" + _dealId + " Not Found.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    // One margin call at a time, the open one has to settle first
+    _openTransactionId, err:= open_margin_call(stub, res_Deal)
+    if err != nil {
+        return nil, err
+    }
+    if _openTransactionId != "" {
+        tosend:= "{ \"dealId\" : \"" + _dealId + "\", \"transactionId\" : \"" + _openTransactionId + "\", \"message\" : \"Margin call " + _openTransactionId + " is still open, no new margin call raised.\", \"code\" : \"200\"}"
+        err = stub.SetEvent("evtsender", [] byte(tosend))
+        if err != nil {
+            return nil, err
+        }
+        return nil, nil
+    }
+
+    _transactionStatus:= "Matched"
+    if res_Deal.MarginCallConfirmation == "Required" {
+        _transactionStatus = "Unmatched"
+    }
+    _marginCallDate:= next_business_day(_valuationSeconds)
+    var temp[] string
+    temp = append(temp, _dealId + "-MC-" + _valuationDate, _valuationDate, _dealId, res_Deal.Pledger, res_Deal.Pledgee, _rqv, _currency, strconv.FormatInt(_marginCallDate, 10), _transactionStatus)
+    fmt.Println("end create_margin_call")
+    // call_transaction links it to the deal through addTransaction_inDeal
+    return t.call_transaction(stub, temp, _shortFall)
+}
+// ============================================================================================================================
+// create_substitution_call - raise a margin call for the RQV a deal already covers, so the next allocation replaces a
+// security that is no longer eligible
+// Arguments : dealId, transactionId of the margin call currently covered, securityId, timestamp (seconds)
+// ============================================================================================================================
+func(t * ManageDeals) create_substitution_call(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 4 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting dealId, transactionId, securityId and timestamp\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start create_substitution_call")
+    _dealId:= args[0]
+    _transactionId:= args[1]
+    _securityId:= args[2]
+    _timestamp:= args[3]
+    _seconds, errBool:= strconv.ParseInt(_timestamp, 10, 64)
+    if errBool != nil {
+        errMsg:= "{ \"dealId\" : \"" + _dealId + "\", \"message\" : \"Invalid timestamp " + _timestamp + ".\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    res_Deal:= Deals {}
+    dealAsBytes, err:= stub.GetState(_dealId)
+    if err != nil {
+        return nil, errors.New("Failed to get Deal " + _dealId)
+    }
+    json.Unmarshal(dealAsBytes, &res_Deal)
+    res_Transaction:= Transactions {}
+    transactionAsBytes, err:= stub.GetState(_transactionId)
+    if err != nil {
+        return nil, errors.New("Failed to get Transaction " + _transactionId)
+    }
+    json.Unmarshal(transactionAsBytes, &res_Transaction)
+    if res_Deal.DealID != _dealId || res_Transaction.DealID != _dealId {
+        errMsg:= "{ \"message\" : \"" + _dealId + " or " + _transactionId + " Not Found.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    // An open margin call reallocates the segregated account anyway
+    _openTransactionId, err:= open_margin_call(stub, res_Deal)
+    if err != nil {
+        return nil, err
+    }
+    if _openTransactionId != "" {
+        tosend:= "{ \"dealId\" : \"" + _dealId + "\", \"transactionId\" : \"" + _openTransactionId + "\", \"message\" : \"Margin call " + _openTransactionId + " is still open and will replace " + _securityId + ", no substitution call raised.\", \"code\" : \"200\"}"
+        err = stub.SetEvent("evtsender", [] byte(tosend))
+        if err != nil {
+            return nil, err
+        }
+        return nil, nil
+    }
+
+    _transactionStatus:= "Matched"
+    if res_Deal.MarginCallConfirmation == "Required" {
+        _transactionStatus = "Unmatched"
+    }
+    var temp[] string
+    temp = append(temp, _dealId + "-SC-" + _securityId + "-" + _timestamp, _timestamp, _dealId, res_Deal.Pledger, res_Deal.Pledgee, res_Transaction.RQV, res_Transaction.Currency, strconv.FormatInt(next_business_day(_seconds), 10), _transactionStatus)
+    // Same amount as the call it replaces, a substitution is made whatever the minimum transfer amount
+    _exposure, err:= amount.ParseAmount(res_Transaction.RQV, res_Transaction.Currency)
+    _callAmount:= amount.Amount{}
+    if err == nil {
+        _callAmount, err = csa_amount(res_Deal, _exposure)
+    }
+    if err != nil {
+        errMsg:= "{ \"transactionId\" : \"" + _transactionId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil, nil
+    }
+    fmt.Println("end create_substitution_call")
+    return t.put_transaction(stub, temp, _callAmount.String(), "NA")
+}
+// ============================================================================================================================
+// open_margin_call - id of the deal's margin call that has not settled yet, empty if there is none
+// ============================================================================================================================
+func open_margin_call(stub shim.ChaincodeStubInterface, res_Deal Deals) (string, error) {
+    for _, _transactionId:= range strings.Split(res_Deal.Transactions, ",") {
+        res_Transaction:= Transactions {}
+        transactionAsBytes, err:= stub.GetState(_transactionId)
+        if err != nil {
+            return "", errors.New("Failed to get Transaction " + _transactionId)
+        }
+        json.Unmarshal(transactionAsBytes, &res_Transaction)
+        if openAllocationStatus[res_Transaction.AllocationStatus] {
+            return _transactionId, nil
+        }
+    }
+    return "", nil
+}
+// ============================================================================================================================
+// next_business_day - start of the first weekday after the given time, in seconds
+// ============================================================================================================================
+func next_business_day(seconds int64) int64 {
+    day:= time.Unix(seconds, 0).UTC().Truncate(24 * time.Hour).AddDate(0, 0, 1)
+    for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+        day = day.AddDate(0, 0, 1)
+    }
+    return day.Unix()
+}
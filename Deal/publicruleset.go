@@ -0,0 +1,367 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "strconv"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim")
+
+var publicRulesetStr = "_publicRuleset" //name for the key/value that will store every version of the public rule set
+var rulesetGovernanceStr = "_rulesetGovernance" //name for the key/value that will store who governs the public rule set
+
+type RulesetGovernance struct { // Who may amend the public rule set
+    Admin string `json:"admin"` // regulator or admin proposing amendments
+    Approvers [] string `json:"approvers"` // parties every amendment needs the approval of
+}
+
+// ============================================================================================================================
+// ruleset_governance - who governs the public rule set, an empty admin when the chaincode was deployed without one
+// ============================================================================================================================
+func ruleset_governance(stub shim.ChaincodeStubInterface) (RulesetGovernance, error) {
+    governance:= RulesetGovernance {}
+    governanceAsBytes, err:= stub.GetState(rulesetGovernanceStr)
+    if err != nil {
+        return governance, errors.New("Failed to get public rule set governance")
+    }
+    json.Unmarshal(governanceAsBytes, &governance)
+    return governance, nil
+}
+// ============================================================================================================================
+// public_ruleset_versions - every version of the public rule set, oldest first
+// ============================================================================================================================
+func public_ruleset_versions(stub shim.ChaincodeStubInterface) ([] RulesetVersions, error) {
+    var versions[] RulesetVersions
+    versionsAsBytes, err:= stub.GetState(publicRulesetStr)
+    if err != nil {
+        return nil, errors.New("Failed to get public rule set")
+    }
+    json.Unmarshal(versionsAsBytes, &versions)
+    return versions, nil
+}
+// ============================================================================================================================
+// new_governance - the governance named by an admin and a comma separated list of approvers
+// ============================================================================================================================
+func new_governance(_admin string, _approvers string) RulesetGovernance {
+    _governance:= RulesetGovernance {Admin: strings.TrimSpace(_admin)}
+    for _, val:= range strings.Split(_approvers, ",") {
+        if strings.TrimSpace(val) != "" {
+            _governance.Approvers = append(_governance.Approvers, strings.TrimSpace(val))
+        }
+    }
+    return _governance
+}
+// ============================================================================================================================
+// set_ruleset_governance - the admin hands the public rule set over to a new admin and approvers
+// Governance is first named when the chaincode is deployed, see Init. The caller has to be the admin in place.
+// Arguments : admin, approvers (comma separated)
+// ============================================================================================================================
+func(t * ManageDeals) set_ruleset_governance(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 2\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start set_ruleset_governance")
+    _caller:= caller_id(stub)
+    governance, err:= ruleset_governance(stub)
+    if err != nil {
+        return nil, err
+    }
+    _governance:= new_governance(args[0], args[1])
+    errMsg:= ""
+    if governance.Admin == "" {
+        errMsg = "{ \"message\" : \"The public rule set has no admin, it is named when the chaincode is deployed.\", \"code\" : \"503\"}"
+    } else if _caller == "" || _caller != governance.Admin {
+        errMsg = "{ \"message\" : \"Only " + governance.Admin + " can change the public rule set governance.\", \"code\" : \"503\"}"
+    } else if _governance.Admin == "" || len(_governance.Approvers) == 0 {
+        errMsg = "{ \"message\" : \"The public rule set needs an admin and at least one approver.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    jsonAsBytes, _:= json.Marshal(_governance)
+    err = stub.PutState(rulesetGovernanceStr, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"admin\" : \"" + _governance.Admin + "\", \"approvers\" : \"" + strings.Join(_governance.Approvers, ",") + "\", \"message\" : \"Public rule set governance set succcessfully\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end set_ruleset_governance")
+    return nil, nil
+}
+// ============================================================================================================================
+// propose_public_ruleset - the admin proposes an amendment of the public rule set, it applies once every approver approves
+// Arguments : effectiveFrom (Unix timestamp), public rule set json e.g. {"Equities":{"Valuation Percentage":"85","Concentration Limit":"10","Priority":"6"}}
+// The caller is the proposer.
+// ============================================================================================================================
+func(t * ManageDeals) propose_public_ruleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 2\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start propose_public_ruleset")
+    _proposer:= caller_id(stub)
+    _effectiveFrom:= args[0]
+    _ruleset:= args[1]
+
+    governance, err:= ruleset_governance(stub)
+    if err != nil {
+        return nil, err
+    }
+    versions, err:= public_ruleset_versions(stub)
+    if err != nil {
+        return nil, err
+    }
+    errMsg:= ""
+    if governance.Admin == "" || _proposer != governance.Admin {
+        errMsg = "{ \"message\" : \"Only the public rule set admin can propose amendments.\", \"code\" : \"503\"}"
+    } else if _, err:= strconv.ParseInt(_effectiveFrom, 10, 64); err != nil {
+        errMsg = "{ \"message\" : \"Invalid effective from date " + _effectiveFrom + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+    } else if err:= valid_public_ruleset(_ruleset); err != nil {
+        errMsg = "{ \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+    } else if len(versions) > 0 && versions[len(versions) - 1].Status == "Pending Approval" {
+        errMsg = "{ \"message\" : \"Version " + strconv.Itoa(versions[len(versions) - 1].Version) + " is still waiting for approval.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    _version:= len(versions) + 1
+    _rulesetJson:= json.RawMessage(_ruleset)
+    versions = append(versions, RulesetVersions {
+        Version: _version,
+        EffectiveFrom: _effectiveFrom,
+        Ruleset: &_rulesetJson,
+        ProposedBy: _proposer,
+        ApprovedBy: [] string {},
+        Status: "Pending Approval",
+    })
+    jsonAsBytes, _:= json.Marshal(versions)
+    err = stub.PutState(publicRulesetStr, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"version\" : \"" + strconv.Itoa(_version) + "\", \"effectiveFrom\" : \"" + _effectiveFrom + "\", \"message\" : \"Public rule set amendment proposed succcessfully, waiting for approval\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end propose_public_ruleset")
+    return nil, nil
+}
+// ============================================================================================================================
+// valid_public_ruleset - every collateral form needs a Valuation Percentage from 0 to 100 and a Concentration Limit of 0 or more
+// ============================================================================================================================
+func valid_public_ruleset(_ruleset string) error {
+    var parsed map[string]map[string]string
+    if err:= json.Unmarshal([] byte(_ruleset), &parsed); err != nil || len(parsed) == 0 {
+        return errors.New("Public rule set has to map each collateral form to its Valuation Percentage and Concentration Limit.")
+    }
+    for _form, _terms:= range parsed {
+        _valuation, err:= strconv.ParseFloat(_terms["Valuation Percentage"], 64)
+        if err != nil || _valuation < 0 || _valuation > 100 {
+            return errors.New("Invalid Valuation Percentage " + _terms["Valuation Percentage"] + " for " + _form)
+        }
+        _limit, err:= strconv.ParseFloat(_terms["Concentration Limit"], 64)
+        if err != nil || _limit < 0 {
+            return errors.New("Invalid Concentration Limit " + _terms["Concentration Limit"] + " for " + _form)
+        }
+    }
+    return nil
+}
+// ============================================================================================================================
+// approve_public_ruleset - a designated approver approves or rejects an amendment; it is approved once all of them have
+// Arguments : version, 'Approved' or 'Rejected'. The caller is the approver.
+// ============================================================================================================================
+func(t * ManageDeals) approve_public_ruleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 2\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start approve_public_ruleset")
+    _approver:= caller_id(stub)
+    _decision:= args[1]
+
+    governance, err:= ruleset_governance(stub)
+    if err != nil {
+        return nil, err
+    }
+    versions, err:= public_ruleset_versions(stub)
+    if err != nil {
+        return nil, err
+    }
+    _designated:= false
+    for _, val:= range governance.Approvers {
+        if _approver != "" && val == _approver {
+            _designated = true
+        }
+    }
+    _version, err:= strconv.Atoi(args[0])
+    errMsg:= ""
+    if err != nil || _version < 1 || _version > len(versions) {
+        errMsg = "{ \"message\" : \"Version " + args[0] + " of the public rule set Not Found.\", \"code\" : \"503\"}"
+    } else if versions[_version - 1].Status != "Pending Approval" {
+        errMsg = "{ \"message\" : \"Version " + args[0] + " is " + versions[_version - 1].Status + ", not pending approval.\", \"code\" : \"503\"}"
+    } else if !_designated {
+        errMsg = "{ \"message\" : \"" + _approver + " is not an approver of the public rule set.\", \"code\" : \"503\"}"
+    } else if _decision != "Approved" && _decision != "Rejected" {
+        errMsg = "{ \"message\" : \"Decision has to be 'Approved' or 'Rejected'.\", \"code\" : \"503\"}"
+    }
+    if errMsg == "" {
+        for _, val:= range versions[_version - 1].ApprovedBy {
+            if val == _approver {
+                errMsg = "{ \"message\" : \"" + _approver + " already approved version " + args[0] + ".\", \"code\" : \"503\"}"
+            }
+        }
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    // One rejection is enough to turn an amendment down, every approver has to approve it
+    if _decision == "Rejected" {
+        versions[_version - 1].Status = "Rejected"
+    } else {
+        versions[_version - 1].ApprovedBy = append(versions[_version - 1].ApprovedBy, _approver)
+        _approved:= map[string] bool {}
+        for _, val:= range versions[_version - 1].ApprovedBy {
+            _approved[val] = true
+        }
+        versions[_version - 1].Status = "Approved"
+        for _, val:= range governance.Approvers {
+            if !_approved[val] {
+                versions[_version - 1].Status = "Pending Approval"
+            }
+        }
+    }
+    jsonAsBytes, _:= json.Marshal(versions)
+    err = stub.PutState(publicRulesetStr, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"version\" : \"" + args[0] + "\", \"status\" : \"" + versions[_version - 1].Status + "\", \"message\" : \"Public rule set amendment " + _decision + " by " + _approver + "\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end approve_public_ruleset")
+    return nil, nil
+}
+// ============================================================================================================================
+// getPublicRuleset - the approved public rule set version in force at a date: the latest effective one, the higher version on the same date
+// Arguments : asOf (Unix timestamp)
+// ============================================================================================================================
+func(t * ManageDeals) getPublicRuleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 1 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting asOf\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start getPublicRuleset")
+    _asOf, err:= strconv.ParseInt(args[0], 10, 64)
+    if err != nil {
+        errMsg:= "{ \"message\" : \"Invalid date " + args[0] + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    versions, err:= public_ruleset_versions(stub)
+    if err != nil {
+        return nil, err
+    }
+    inForce:= -1
+    var inForceFrom int64
+    for i, val:= range versions {
+        _effectiveFrom, _:= strconv.ParseInt(val.EffectiveFrom, 10, 64)
+        if val.Status == "Approved" && _effectiveFrom <= _asOf && (inForce < 0 || _effectiveFrom >= inForceFrom) {
+            inForce = i
+            inForceFrom = _effectiveFrom
+        }
+    }
+    if inForce < 0 {
+        errMsg:= "{ \"message\" : \"No approved public rule set in force on " + args[0] + ".\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("end getPublicRuleset")
+    return json.Marshal(versions[inForce])
+}
+// ============================================================================================================================
+// getPublicRulesetHistory - every amendment of the public rule set with who proposed and approved it, and its governance
+// ============================================================================================================================
+func(t * ManageDeals) getPublicRulesetHistory(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    fmt.Println("start getPublicRulesetHistory")
+    governance, err:= ruleset_governance(stub)
+    if err != nil {
+        return nil, err
+    }
+    versions, err:= public_ruleset_versions(stub)
+    if err != nil {
+        return nil, err
+    }
+    if versions == nil {
+        versions = [] RulesetVersions {}
+    }
+    fmt.Println("end getPublicRulesetHistory")
+    return json.Marshal(struct {
+        Governance RulesetGovernance `json:"governance"`
+        Versions [] RulesetVersions `json:"versions"`
+    } {governance, versions})
+}
@@ -0,0 +1,263 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "strconv"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim")
+
+var rulesetPrefix = "_ruleset_" //key prefix for the versions of the private ruleset agreed between a pledger and a pledgee, "_ruleset_<pledger>_<pledgee>"
+var CallerAttribute = "enrollmentId" //attribute of the caller's transaction certificate that names the party invoking
+
+type RulesetVersions struct { // One version of the private security ruleset of a pledger and pledgee, or of the public rule set
+    Version int `json:"version"`
+    EffectiveFrom string `json:"effectiveFrom"` // Unix timestamp in seconds the version applies from
+    Ruleset *json.RawMessage `json:"ruleset"` // the ruleset itself, as the Allocation chaincode reads it
+    ProposedBy string `json:"proposedBy"`
+    ApprovedBy []string `json:"approvedBy"` // parties that agreed to it, the proposer included for a private ruleset
+    Status string `json:"status"` // Pending Approval, Approved or Rejected
+}
+
+// ============================================================================================================================
+// caller_id - the party invoking the transaction, as named by its certificate; empty when the certificate does not name it
+// ============================================================================================================================
+func caller_id(stub shim.ChaincodeStubInterface) string {
+    callerAsBytes, err:= stub.ReadCertAttribute(CallerAttribute)
+    if err != nil {
+        fmt.Println("Failed to read " + CallerAttribute + " of the caller: " + err.Error())
+        return ""
+    }
+    return strings.TrimSpace(string(callerAsBytes))
+}
+// ============================================================================================================================
+// ruleset_versions - every version of the ruleset of a pledger and pledgee, oldest first
+// ============================================================================================================================
+func ruleset_versions(stub shim.ChaincodeStubInterface, _pledger string, _pledgee string) ([] RulesetVersions, error) {
+    var versions[] RulesetVersions
+    versionsAsBytes, err:= stub.GetState(rulesetPrefix + _pledger + "_" + _pledgee)
+    if err != nil {
+        return nil, errors.New("Failed to get ruleset of " + _pledger + " and " + _pledgee)
+    }
+    json.Unmarshal(versionsAsBytes, &versions)
+    return versions, nil
+}
+// ============================================================================================================================
+// propose_ruleset - pledger or pledgee proposes a new version of their private ruleset, it applies once the other approves
+// Arguments : pledger, pledgee, effectiveFrom (Unix timestamp), ruleset json. The caller is the proposer.
+// ============================================================================================================================
+func(t * ManageDeals) propose_ruleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 4 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 4\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start propose_ruleset")
+    _pledger:= args[0]
+    _pledgee:= args[1]
+    _proposer:= caller_id(stub)
+    _effectiveFrom:= args[2]
+    _ruleset:= args[3]
+
+    versions, err:= ruleset_versions(stub, _pledger, _pledgee)
+    if err != nil {
+        return nil, err
+    }
+    var parsed map[string]interface {}
+    errMsg:= ""
+    if _proposer == "" || (_proposer != _pledger && _proposer != _pledgee) {
+        errMsg = "{ \"message\" : \"Only " + _pledger + " or " + _pledgee + " can propose their ruleset.\", \"code\" : \"503\"}"
+    } else if _, err:= strconv.ParseInt(_effectiveFrom, 10, 64); err != nil {
+        errMsg = "{ \"message\" : \"Invalid effective from date " + _effectiveFrom + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+    } else if err:= json.Unmarshal([] byte(_ruleset), &parsed); err != nil {
+        errMsg = "{ \"message\" : \"Ruleset is not a json object.\", \"code\" : \"503\"}"
+    } else if len(versions) > 0 && versions[len(versions) - 1].Status == "Pending Approval" {
+        errMsg = "{ \"message\" : \"Version " + strconv.Itoa(versions[len(versions) - 1].Version) + " is still waiting for approval.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    _version:= len(versions) + 1
+    _rulesetJson:= json.RawMessage(_ruleset)
+    versions = append(versions, RulesetVersions {
+        Version: _version,
+        EffectiveFrom: _effectiveFrom,
+        Ruleset: &_rulesetJson,
+        ProposedBy: _proposer,
+        ApprovedBy: [] string {_proposer},
+        Status: "Pending Approval",
+    })
+    jsonAsBytes, _:= json.Marshal(versions)
+    err = stub.PutState(rulesetPrefix + _pledger + "_" + _pledgee, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"pledger\" : \"" + _pledger + "\", \"pledgee\" : \"" + _pledgee + "\", \"version\" : \"" + strconv.Itoa(_version) + "\", \"message\" : \"Ruleset proposed succcessfully, waiting for approval\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end propose_ruleset")
+    return nil, nil
+}
+// ============================================================================================================================
+// approve_ruleset - the party that did not propose a ruleset version approves or rejects it
+// Arguments : pledger, pledgee, version, 'Approved' or 'Rejected'. The caller is the approver.
+// ============================================================================================================================
+func(t * ManageDeals) approve_ruleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 4 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 4\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start approve_ruleset")
+    _pledger:= args[0]
+    _pledgee:= args[1]
+    _approver:= caller_id(stub)
+    _decision:= args[3]
+
+    versions, err:= ruleset_versions(stub, _pledger, _pledgee)
+    if err != nil {
+        return nil, err
+    }
+    _version, err:= strconv.Atoi(args[2])
+    errMsg:= ""
+    if err != nil || _version < 1 || _version > len(versions) {
+        errMsg = "{ \"message\" : \"Version " + args[2] + " of the ruleset of " + _pledger + " and " + _pledgee + " Not Found.\", \"code\" : \"503\"}"
+    } else if versions[_version - 1].Status != "Pending Approval" {
+        errMsg = "{ \"message\" : \"Version " + args[2] + " is " + versions[_version - 1].Status + ", not pending approval.\", \"code\" : \"503\"}"
+    } else if (_approver != _pledger && _approver != _pledgee) || _approver == versions[_version - 1].ProposedBy {
+        errMsg = "{ \"message\" : \"Only the party that did not propose version " + args[2] + " can approve it.\", \"code\" : \"503\"}"
+    } else if _decision != "Approved" && _decision != "Rejected" {
+        errMsg = "{ \"message\" : \"Decision has to be 'Approved' or 'Rejected'.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    versions[_version - 1].Status = _decision
+    if _decision == "Approved" {
+        versions[_version - 1].ApprovedBy = append(versions[_version - 1].ApprovedBy, _approver)
+    }
+    jsonAsBytes, _:= json.Marshal(versions)
+    err = stub.PutState(rulesetPrefix + _pledger + "_" + _pledgee, jsonAsBytes)
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"pledger\" : \"" + _pledger + "\", \"pledgee\" : \"" + _pledgee + "\", \"version\" : \"" + args[2] + "\", \"message\" : \"Ruleset " + _decision + "\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end approve_ruleset")
+    return nil, nil
+}
+// ============================================================================================================================
+// getRuleset - the approved ruleset version in force at a date: the latest effective one, the higher version on the same date
+// Arguments : pledger, pledgee, asOf (Unix timestamp)
+// ============================================================================================================================
+func(t * ManageDeals) getRuleset(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 3 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting pledger, pledgee and asOf\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start getRuleset")
+    _pledger:= args[0]
+    _pledgee:= args[1]
+    _asOf, err:= strconv.ParseInt(args[2], 10, 64)
+    if err != nil {
+        errMsg:= "{ \"message\" : \"Invalid date " + args[2] + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    versions, err:= ruleset_versions(stub, _pledger, _pledgee)
+    if err != nil {
+        return nil, err
+    }
+    inForce:= -1
+    var inForceFrom int64
+    for i, val:= range versions {
+        _effectiveFrom, _:= strconv.ParseInt(val.EffectiveFrom, 10, 64)
+        if val.Status == "Approved" && _effectiveFrom <= _asOf && (inForce < 0 || _effectiveFrom >= inForceFrom) {
+            inForce = i
+            inForceFrom = _effectiveFrom
+        }
+    }
+    if inForce < 0 {
+        errMsg:= "{ \"message\" : \"No approved ruleset of " + _pledger + " and " + _pledgee + " in force on " + args[2] + ".\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("end getRuleset")
+    return json.Marshal(versions[inForce])
+}
+// ============================================================================================================================
+// getRulesetHistory - every version of the ruleset of a pledger and pledgee with who proposed and approved it
+// ============================================================================================================================
+func(t * ManageDeals) getRulesetHistory(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting pledger and pledgee\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start getRulesetHistory")
+    versions, err:= ruleset_versions(stub, args[0], args[1])
+    if err != nil {
+        return nil, err
+    }
+    if versions == nil {
+        versions = [] RulesetVersions {}
+    }
+    fmt.Println("end getRulesetHistory")
+    return json.Marshal(versions)
+}
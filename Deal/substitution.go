@@ -0,0 +1,382 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+import ("errors"
+        "fmt"
+        "strings"
+        "encoding/json"
+        "github.com/hyperledger/fabric/core/chaincode/shim"
+        "github.com/mukutb/TCM-new/amount")
+
+type Substitutions struct { // Pledger's request to swap securities in the segregated account
+    SubstitutionId string `json:"substitutionId"`
+    DealID string `json:"dealId"`
+    TransactionID string `json:"transactionId"` //Transaction whose RQV the segregated account has to keep covering
+    Pledger string `json:"pledger"`
+    Pledgee string `json:"pledgee"`
+    Withdrawals string `json:"withdrawals"` //securityId:quantity,... coming back out of the segregated account
+    Replacements string `json:"replacements"` //securityId:quantity,... going in from the longbox account
+    RequestDate string `json:"requestDate"`
+    Status string `json:"status"` //Pending Approval, Approved, Rejected, Substituted or Substitution Failed
+    Reason string `json:"reason"` //Why the substitution was rejected or failed
+}
+
+// ============================================================================================================================
+// substitution_json - build the Substitution json string manually
+// ============================================================================================================================
+func substitution_json(res Substitutions) string {
+    return `{` +
+        `"substitutionId": "` + res.SubstitutionId + `" , ` +
+        `"dealId": "` + res.DealID + `" , ` +
+        `"transactionId": "` + res.TransactionID + `" , ` +
+        `"pledger": "` + res.Pledger + `" , ` +
+        `"pledgee": "` + res.Pledgee + `" , ` +
+        `"withdrawals": "` + res.Withdrawals + `" , ` +
+        `"replacements": "` + res.Replacements + `" , ` +
+        `"requestDate": "` + res.RequestDate + `" , ` +
+        `"status": "` + res.Status + `" , ` +
+        `"reason": "` + res.Reason + `" ` +
+    `}`
+}
+// ============================================================================================================================
+// valid_security_list - check a securityId:quantity,... list names at least one security with a positive quantity
+// ============================================================================================================================
+func valid_security_list(list string) bool {
+    if strings.TrimSpace(list) == "" {
+        return false
+    }
+    for _, line := range strings.Split(list, ",") {
+        parts := strings.Split(line, ":")
+        if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+            return false
+        }
+        quantity, err := amount.ParseQuantity(parts[1])
+        if err != nil || quantity.Sign() <= 0 {
+            return false
+        }
+    }
+    return true
+}
+// ============================================================================================================================
+// request_substitution - pledger asks to take securities out of the segregated account and put others in their place
+// ============================================================================================================================
+func(t * ManageDeals) request_substitution(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 6 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 6\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start request_substitution")
+    _substitutionId:= args[0]
+    _dealId:= args[1]
+    _transactionId:= args[2]
+    _withdrawals:= args[3]
+    _replacements:= args[4]
+    _requestDate:= args[5]
+
+    res:= Substitutions {}
+    substitutionAsBytes, err:= stub.GetState(_substitutionId)
+    if err != nil {
+        return nil, errors.New("Failed to get Substitution " + _substitutionId)
+    }
+    json.Unmarshal(substitutionAsBytes, &res)
+    if res.SubstitutionId == _substitutionId {
+        errMsg:= "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"This Substitution already exists\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    if !valid_security_list(_withdrawals) || !valid_security_list(_replacements) {
+        errMsg:= "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Withdrawals and replacements have to be given as securityId:quantity,...\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    // The deal has to exist and the transaction has to be one of its own
+    res_Deal:= Deals {}
+    dealAsBytes, err:= stub.GetState(_dealId)
+    if err != nil {
+        return nil, errors.New("Failed to get Deal " + _dealId)
+    }
+    json.Unmarshal(dealAsBytes, &res_Deal)
+    if res_Deal.DealID != _dealId {
+        errMsg:= "{ \"message\" : \"" + _dealId + " Not Found.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    res_Transaction:= Transactions {}
+    transactionAsBytes, err:= stub.GetState(_transactionId)
+    if err != nil {
+        return nil, errors.New("Failed to get Transaction " + _transactionId)
+    }
+    json.Unmarshal(transactionAsBytes, &res_Transaction)
+    if res_Transaction.TransactionId != _transactionId || res_Transaction.DealID != _dealId {
+        errMsg:= "{ \"message\" : \"" + _transactionId + " Not Found in " + _dealId + ".\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    // Deals that leave approval out let the substitution go straight through
+    _status:= "Approved"
+    if res_Deal.SubstitutionApproval == "Required" {
+        _status = "Pending Approval"
+    }
+    order:= substitution_json(Substitutions {
+        SubstitutionId: _substitutionId,
+        DealID: _dealId,
+        TransactionID: _transactionId,
+        Pledger: res_Deal.Pledger,
+        Pledgee: res_Deal.Pledgee,
+        Withdrawals: _withdrawals,
+        Replacements: _replacements,
+        RequestDate: _requestDate,
+        Status: _status,
+    })
+    fmt.Println(order);
+    err = stub.PutState(_substitutionId, [] byte(order))
+    if err != nil {
+        return nil, err
+    }
+
+    // Link it to the deal
+    if res_Deal.Substitutions == " " || res_Deal.Substitutions == "" {
+        res_Deal.Substitutions = _substitutionId
+    } else {
+        res_Deal.Substitutions = res_Deal.Substitutions + "," + _substitutionId
+    }
+    err = stub.PutState(_dealId, [] byte(deal_json(res_Deal)))
+    if err != nil {
+        return nil, err
+    }
+
+    tosend:= "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Substitution requested succcessfully with status " + _status + "\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end request_substitution")
+    return nil, nil
+}
+// ============================================================================================================================
+// approve_substitution - pledgee approves or rejects a substitution waiting on them
+// Arguments : substitutionId, 'Approved' or 'Rejected'. The caller is the approver.
+// ============================================================================================================================
+func(t * ManageDeals) approve_substitution(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting substitutionId and 'Approved' or 'Rejected'\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    fmt.Println("start approve_substitution")
+    _substitutionId:= args[0]
+    _pledgee:= caller_id(stub)
+    _decision:= args[1]
+
+    res:= Substitutions {}
+    substitutionAsBytes, err:= stub.GetState(_substitutionId)
+    if err != nil {
+        return nil, errors.New("Failed to get Substitution " + _substitutionId)
+    }
+    json.Unmarshal(substitutionAsBytes, &res)
+    errMsg:= ""
+    if res.SubstitutionId != _substitutionId {
+        errMsg = "{ \"message\" : \"" + _substitutionId + " Not Found.\", \"code\" : \"503\"}"
+    } else if _pledgee == "" || res.Pledgee != _pledgee {
+        errMsg = "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Only the pledgee " + res.Pledgee + " can approve this substitution.\", \"code\" : \"503\"}"
+    } else if res.Status != "Pending Approval" {
+        errMsg = "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Substitution is " + res.Status + ", not pending approval.\", \"code\" : \"503\"}"
+    } else if _decision != "Approved" && _decision != "Rejected" {
+        errMsg = "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Decision has to be 'Approved' or 'Rejected'.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+
+    res.Status = _decision
+    if _decision == "Rejected" {
+        res.Reason = "Rejected by " + _pledgee
+    }
+    err = stub.PutState(_substitutionId, [] byte(substitution_json(res)))
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Substitution " + _decision + "\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    fmt.Println("end approve_substitution")
+    return nil, nil
+}
+// ============================================================================================================================
+// update_substitution_status - record the outcome of a substitution, called from the Allocation chaincode
+// Only an approved substitution can be carried out, so it is the only one that can end as Substituted or Substitution Failed
+// ============================================================================================================================
+func(t * ManageDeals) update_substitution_status(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 3 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting substitutionId, status and reason\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    _substitutionId:= args[0]
+    res:= Substitutions {}
+    substitutionAsBytes, err:= stub.GetState(_substitutionId)
+    if err != nil {
+        return nil, errors.New("Failed to get Substitution " + _substitutionId)
+    }
+    json.Unmarshal(substitutionAsBytes, &res)
+    errMsg:= ""
+    if res.SubstitutionId != _substitutionId {
+        errMsg = "{ \"message\" : \"" + _substitutionId + " Not Found.\", \"code\" : \"503\"}"
+    } else if res.Status != "Approved" {
+        errMsg = "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Substitution is " + res.Status + ", only an approved substitution can be updated.\", \"code\" : \"503\"}"
+    } else if args[1] != "Substituted" && args[1] != "Substitution Failed" {
+        errMsg = "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Status has to be 'Substituted' or 'Substitution Failed'.\", \"code\" : \"503\"}"
+    }
+    if errMsg != "" {
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    res.Status = args[1]
+    res.Reason = args[2]
+    err = stub.PutState(_substitutionId, [] byte(substitution_json(res)))
+    if err != nil {
+        return nil, err
+    }
+    tosend:= "{ \"substitutionId\" : \"" + _substitutionId + "\", \"message\" : \"Substitution updated succcessfully with status " + res.Status + "\", \"code\" : \"200\"}"
+    err = stub.SetEvent("evtsender", [] byte(tosend))
+    if err != nil {
+        return nil, err
+    }
+    return nil, nil
+}
+// ============================================================================================================================
+// getSubstitution_byID - get Substitution details for a specific ID from chaincode state
+// ============================================================================================================================
+func(t * ManageDeals) getSubstitution_byID(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 1 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 'substitutionId' as an argument\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    valAsbytes, err:= stub.GetState(args[0])
+    if err != nil {
+        errMsg:= "{ \"message\" : \"" + args[0] + " not Found.\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    return valAsbytes, nil
+}
+// ============================================================================================================================
+// getSubstitutions_byDealID - get all Substitutions requested on a Deal
+// ============================================================================================================================
+func(t * ManageDeals) getSubstitutions_byDealID(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 1 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting 'dealId' as an argument\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    dealAsBytes, err:= stub.GetState(args[0])
+    if err != nil {
+        return nil, errors.New("Failed to get Deal " + args[0])
+    }
+    var res_Deal Deals
+    json.Unmarshal(dealAsBytes, &res_Deal)
+    jsonResp:= "["
+    if strings.TrimSpace(res_Deal.Substitutions) != "" {
+        _substitutionSplit:= strings.Split(res_Deal.Substitutions, ",")
+        for i:= range _substitutionSplit {
+            valueAsBytes, err:= stub.GetState(_substitutionSplit[i])
+            if err != nil {
+                errResp:= "{\"Error\":\"Failed to get state for " + _substitutionSplit[i] + "\"}"
+                return nil, errors.New(errResp)
+            }
+            jsonResp = jsonResp + string(valueAsBytes[: ])
+            if i < len(_substitutionSplit) - 1 {
+                jsonResp = jsonResp + ","
+            }
+        }
+    }
+    jsonResp = jsonResp + "]"
+    fmt.Println("jsonResp: " + jsonResp)
+    return []byte(jsonResp), nil
+}
+// ============================================================================================================================
+// set_substitution_approval - "Required" when the pledgee has to approve substitutions on a Deal, blank when they go straight through
+// ============================================================================================================================
+func(t * ManageDeals) set_substitution_approval(stub shim.ChaincodeStubInterface, args[] string)([] byte, error) {
+    var err error
+    if len(args) != 2 {
+        errMsg:= "{ \"message\" : \"Incorrect number of arguments. Expecting dealId and 'Required' or blank\", \"code\" : \"503\"}"
+        err = stub.SetEvent("errEvent", [] byte(errMsg))
+        if err != nil {
+            return nil, err
+        }
+        return nil,nil
+    }
+    return update_deal_fields(stub, args[0], "Deal substitution approval updated succcessfully", func(res * Deals) string {
+        if args[1] != "" && args[1] != "Required" {
+            return "{ \"dealId\" : \"" + args[0] + "\", \"message\" : \"Substitution approval must be 'Required' or blank.\", \"code\" : \"503\"}"
+        }
+        res.SubstitutionApproval = args[1]
+        return ""
+    })
+}
@@ -0,0 +1,596 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ManagePrices keeps the market prices allocation and revaluation value securities at
+type ManagePrices struct {
+}
+
+var PriceFeedAdminStr = "_PriceFeedAdmin" //name for the key/value that will store who may authorise price providers
+var ProviderIndexStr = "_ProviderIndex"   //name for the key/value that will store a list of all authorised providers
+var ProviderPrefix = "_provider_"         //prefix of the key each provider's public key is stored under
+var PricePrefix = "_price_"               //prefix of the key each security's price history is stored under
+
+// Number of prices kept in a security's history, older ones are dropped as new ones are published
+var MaxPriceHistory = 500
+
+// Attribute of the caller's transaction certificate that identifies them
+var CallerAttribute = "enrollmentId"
+
+type Providers struct {
+	ProviderId string `json:"providerId"`
+	PublicKey  string `json:"publicKey"` // PEM encoded ECDSA public key prices have to be signed with
+}
+
+type Prices struct { // A price published for a security
+	SecurityId string `json:"securityId"`
+	Price      string `json:"price"`
+	Currency   string `json:"currency"`
+	Timestamp  string `json:"timestamp"` // Unix timestamp in seconds the price was observed at
+	ProviderId string `json:"providerId"`
+	Signature  string `json:"signature"` // base64 ECDSA signature of price_message
+}
+
+// ============================================================================================================================
+// Main - start the chaincode for Price management
+// ============================================================================================================================
+func main() {
+	err := shim.Start(new(ManagePrices))
+	if err != nil {
+		fmt.Printf("Error starting Price management chaincode: %s", err)
+	}
+}
+
+// ============================================================================================================================
+// Init - reset all the things, args[0] is the enrollment ID of the administrator that authorises price providers
+// Only run at deployment, Invoke does not route "init" so the administrator cannot be replaced afterwards
+// ============================================================================================================================
+func (t *ManagePrices) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting the administrator as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	err = stub.PutState(PriceFeedAdminStr, []byte(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	var empty []string
+	jsonAsBytes, _ := json.Marshal(empty) //marshal an emtpy array of strings to clear the index
+	err = stub.PutState(ProviderIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"message\" : \"ManagePrices chaincode is deployed successfully.\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Run - Our entry point for Invocations - [LEGACY] obc-peer 4/25/2016
+// ============================================================================================================================
+func (t *ManagePrices) Run(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("run is running " + function)
+	return t.Invoke(stub, function, args)
+}
+
+// ============================================================================================================================
+// Invoke - Our entry point for Invocations
+// ============================================================================================================================
+func (t *ManagePrices) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("invoke is running " + function)
+
+	// Handle different functions
+	if function == "add_provider" { //authorise a price provider and its signing key
+		return t.add_provider(stub, args)
+	} else if function == "remove_provider" { //withdraw a price provider's authorisation
+		return t.remove_provider(stub, args)
+	} else if function == "publish_price" { //store a signed price for a security
+		return t.publish_price(stub, args)
+	}
+	fmt.Println("invoke did not find func: " + function)
+	errMsg := "{ \"message\" : \"Received unknown function invocation\", \"code\" : \"503\"}"
+	err := stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil //error
+}
+
+// ============================================================================================================================
+// Query - Our entry point for Queries
+// ============================================================================================================================
+func (t *ManagePrices) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+	fmt.Println("query is running " + function)
+
+	// Handle different functions
+	if function == "getPrice" { //Read the latest price of a security
+		return t.getPrice(stub, args)
+	} else if function == "getPrices_batch" { //Read the latest price of several securities at once
+		return t.getPrices_batch(stub, args)
+	} else if function == "getPriceAsOf" { //Read the price of a security in force at a date
+		return t.getPriceAsOf(stub, args)
+	} else if function == "get_AllProviders" { //Read every authorised price provider
+		return t.get_AllProviders(stub, args)
+	}
+	fmt.Println("query did not find func: " + function) //errors
+	errMsg := "{ \"message\" : \"Received unknown function query\", \"code\" : \"503\"}"
+	err := stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// add_provider - authorise a price provider, the prices it publishes have to be signed with the key given here
+// Arguments : providerId, PEM encoded ECDSA public key. The caller has to be the administrator.
+// ============================================================================================================================
+func (t *ManagePrices) add_provider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 2 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 2\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start add_provider")
+	_providerId := args[0]
+	_publicKey := args[1]
+
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	errMsg := ""
+	if !isAdmin {
+		errMsg = "{ \"message\" : \"Only the administrator can authorise price providers.\", \"code\" : \"503\"}"
+	} else if strings.TrimSpace(_providerId) == "" {
+		errMsg = "{ \"message\" : \"Provider ID is required.\", \"code\" : \"503\"}"
+	} else if _, err := public_key(_publicKey); err != nil {
+		errMsg = "{ \"providerId\" : \"" + _providerId + "\", \"message\" : \"" + err.Error() + "\", \"code\" : \"503\"}"
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	jsonAsBytes, _ := json.Marshal(Providers{ProviderId: _providerId, PublicKey: _publicKey})
+	err = stub.PutState(ProviderPrefix+_providerId, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	var ProviderIndex []string
+	indexAsBytes, err := stub.GetState(ProviderIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get Provider index")
+	}
+	json.Unmarshal(indexAsBytes, &ProviderIndex)
+	found := false
+	for _, val := range ProviderIndex {
+		if val == _providerId {
+			found = true
+		}
+	}
+	if !found {
+		ProviderIndex = append(ProviderIndex, _providerId)
+		jsonAsBytes, _ = json.Marshal(ProviderIndex)
+		err = stub.PutState(ProviderIndexStr, jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tosend := "{ \"providerId\" : \"" + _providerId + "\", \"message\" : \"Provider authorised succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end add_provider")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// remove_provider - withdraw a price provider's authorisation, the prices it already published stay
+// Arguments : providerId. The caller has to be the administrator.
+// ============================================================================================================================
+func (t *ManagePrices) remove_provider(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 1\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start remove_provider")
+	_providerId := args[0]
+
+	isAdmin, err := caller_is_admin(stub)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		errMsg := "{ \"message\" : \"Only the administrator can withdraw price providers.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	err = stub.DelState(ProviderPrefix + _providerId)
+	if err != nil {
+		return nil, errors.New("Failed to delete provider " + _providerId)
+	}
+	var ProviderIndex []string
+	indexAsBytes, err := stub.GetState(ProviderIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get Provider index")
+	}
+	json.Unmarshal(indexAsBytes, &ProviderIndex)
+	for i, val := range ProviderIndex {
+		if val == _providerId {
+			ProviderIndex = append(ProviderIndex[:i], ProviderIndex[i+1:]...)
+			break
+		}
+	}
+	jsonAsBytes, _ := json.Marshal(ProviderIndex)
+	err = stub.PutState(ProviderIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"providerId\" : \"" + _providerId + "\", \"message\" : \"Provider withdrawn succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end remove_provider")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// publish_price - store a price signed by an authorised provider in the security's price history
+// Arguments : providerId, securityId, price, currency, timestamp (Unix seconds), signature (base64 ECDSA over price_message)
+// ============================================================================================================================
+func (t *ManagePrices) publish_price(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 6 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 6\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start publish_price")
+	_price := Prices{
+		ProviderId: args[0],
+		SecurityId: args[1],
+		Price:      strings.TrimSpace(args[2]),
+		Currency:   args[3],
+		Timestamp:  strings.TrimSpace(args[4]),
+		Signature:  args[5],
+	}
+
+	providerAsBytes, err := stub.GetState(ProviderPrefix + _price.ProviderId)
+	if err != nil {
+		return nil, errors.New("Failed to get provider " + _price.ProviderId)
+	}
+	Provider := Providers{}
+	json.Unmarshal(providerAsBytes, &Provider)
+
+	var now int64
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil || txTimestamp == nil || txTimestamp.Seconds <= 0 {
+		fmt.Println("No transaction timestamp to check the price time against")
+	} else {
+		now = txTimestamp.Seconds
+	}
+
+	errMsg := ""
+	if Provider.ProviderId != _price.ProviderId {
+		errMsg = "{ \"message\" : \"" + _price.ProviderId + " is not an authorised price provider.\", \"code\" : \"503\"}"
+	} else if value, err := strconv.ParseFloat(_price.Price, 64); err != nil || value <= 0 {
+		errMsg = "{ \"securityId\" : \"" + _price.SecurityId + "\", \"message\" : \"Invalid price " + _price.Price + ", expecting a positive number.\", \"code\" : \"503\"}"
+	} else if Timestamp, err := strconv.ParseInt(_price.Timestamp, 10, 64); err != nil {
+		errMsg = "{ \"securityId\" : \"" + _price.SecurityId + "\", \"message\" : \"Invalid timestamp " + _price.Timestamp + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+	} else if now > 0 && Timestamp > now {
+		errMsg = "{ \"securityId\" : \"" + _price.SecurityId + "\", \"message\" : \"Timestamp " + _price.Timestamp + " is later than the transaction time " + strconv.FormatInt(now, 10) + ".\", \"code\" : \"503\"}"
+	} else if !signed_by(Provider, _price) {
+		errMsg = "{ \"securityId\" : \"" + _price.SecurityId + "\", \"message\" : \"Price is not signed by " + _price.ProviderId + ".\", \"code\" : \"503\"}"
+	}
+	if errMsg != "" {
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// The history is kept in timestamp order, a provider republishing the same timestamp corrects its price
+	History, err := price_history(stub, _price.SecurityId)
+	if err != nil {
+		return nil, err
+	}
+	replaced := false
+	for i, val := range History {
+		if val.Timestamp == _price.Timestamp && val.ProviderId == _price.ProviderId {
+			History[i] = _price
+			replaced = true
+		}
+	}
+	if !replaced {
+		History = append(History, _price)
+	}
+	sort.Stable(PricesByTimestamp(History))
+	if len(History) > MaxPriceHistory {
+		History = History[len(History)-MaxPriceHistory:]
+	}
+	jsonAsBytes, _ := json.Marshal(History)
+	err = stub.PutState(PricePrefix+_price.SecurityId, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	tosend := "{ \"securityId\" : \"" + _price.SecurityId + "\", \"price\" : \"" + _price.Price + "\", \"timestamp\" : \"" + _price.Timestamp + "\", \"message\" : \"Price published succcessfully\", \"code\" : \"200\"}"
+	err = stub.SetEvent("evtsender", []byte(tosend))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("end publish_price")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getPrice - the latest price of a security
+// ============================================================================================================================
+func (t *ManagePrices) getPrice(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'SecurityId' as an argument\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start getPrice")
+	History, err := price_history(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(History) == 0 {
+		errMsg := "{ \"message\" : \"No price for " + args[0] + ".\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("end getPrice")
+	return json.Marshal(History[len(History)-1])
+}
+
+// ============================================================================================================================
+// getPrices_batch - the latest price of each security asked for, keyed by security ID. Securities without a price are left out.
+// Arguments : one or more securityIds
+// ============================================================================================================================
+func (t *ManagePrices) getPrices_batch(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) < 1 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting at least one 'SecurityId'\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start getPrices_batch")
+	Latest := make(map[string]Prices)
+	for _, SecurityId := range args {
+		History, err := price_history(stub, SecurityId)
+		if err != nil {
+			return nil, err
+		}
+		if len(History) > 0 {
+			Latest[SecurityId] = History[len(History)-1]
+		}
+	}
+	fmt.Println("end getPrices_batch")
+	return json.Marshal(Latest)
+}
+
+// ============================================================================================================================
+// getPriceAsOf - the price of a security in force at a date, the latest one published for a time up to it
+// Arguments : securityId, asOf (Unix seconds)
+// ============================================================================================================================
+func (t *ManagePrices) getPriceAsOf(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	var err error
+	if len(args) != 2 {
+		errMsg := "{ \"message\" : \"Incorrect number of arguments. Expecting 'SecurityId' and 'AsOf' as arguments\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	fmt.Println("start getPriceAsOf")
+	AsOf, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		errMsg := "{ \"message\" : \"Invalid date " + args[1] + ", expecting a Unix timestamp.\", \"code\" : \"503\"}"
+		err = stub.SetEvent("errEvent", []byte(errMsg))
+		if err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	History, err := price_history(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	for i := len(History) - 1; i >= 0; i-- {
+		Timestamp, _ := strconv.ParseInt(History[i].Timestamp, 10, 64)
+		if Timestamp <= AsOf {
+			fmt.Println("end getPriceAsOf")
+			return json.Marshal(History[i])
+		}
+	}
+	errMsg := "{ \"message\" : \"No price for " + args[0] + " as of " + args[1] + ".\", \"code\" : \"503\"}"
+	err = stub.SetEvent("errEvent", []byte(errMsg))
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ============================================================================================================================
+// get_AllProviders - every authorised price provider with its public key
+// ============================================================================================================================
+func (t *ManagePrices) get_AllProviders(stub shim.ChaincodeStubInterface, args []string) ([]byte, error) {
+	fmt.Println("start get_AllProviders")
+	var ProviderIndex []string
+	indexAsBytes, err := stub.GetState(ProviderIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get Provider index")
+	}
+	json.Unmarshal(indexAsBytes, &ProviderIndex)
+	AllProviders := []Providers{}
+	for _, val := range ProviderIndex {
+		providerAsBytes, err := stub.GetState(ProviderPrefix + val)
+		if err != nil {
+			errResp := "{\"Error\":\"Failed to get state for " + ProviderPrefix + val + "\"}"
+			return nil, errors.New(errResp)
+		}
+		Provider := Providers{}
+		json.Unmarshal(providerAsBytes, &Provider)
+		AllProviders = append(AllProviders, Provider)
+	}
+	fmt.Println("end get_AllProviders")
+	return json.Marshal(AllProviders)
+}
+
+// price_history - the prices kept for a security, oldest first, at most MaxPriceHistory of them
+func price_history(stub shim.ChaincodeStubInterface, SecurityId string) ([]Prices, error) {
+	var History []Prices
+	historyAsBytes, err := stub.GetState(PricePrefix + SecurityId)
+	if err != nil {
+		return nil, errors.New("Failed to get prices of " + SecurityId)
+	}
+	json.Unmarshal(historyAsBytes, &History)
+	return History, nil
+}
+
+// Price history order, by the time the price was observed at
+type PricesByTimestamp []Prices
+
+func (slice PricesByTimestamp) Len() int { return len(slice) }
+func (slice PricesByTimestamp) Less(i, j int) bool {
+	Timestamp1, _ := strconv.ParseInt(slice[i].Timestamp, 10, 64)
+	Timestamp2, _ := strconv.ParseInt(slice[j].Timestamp, 10, 64)
+	return Timestamp1 < Timestamp2
+}
+func (slice PricesByTimestamp) Swap(i, j int) { slice[i], slice[j] = slice[j], slice[i] }
+
+// caller_is_admin - whether the certificate of the transaction's caller names the price feed administrator
+func caller_is_admin(stub shim.ChaincodeStubInterface) (bool, error) {
+	adminAsBytes, err := stub.GetState(PriceFeedAdminStr)
+	if err != nil {
+		return false, errors.New("Failed to get price feed administrator")
+	}
+	callerAsBytes, err := stub.ReadCertAttribute(CallerAttribute)
+	if err != nil {
+		// No such attribute in the certificate, the caller cannot be told apart from anyone else
+		fmt.Println("Failed to read " + CallerAttribute + " of the caller: " + err.Error())
+		return false, nil
+	}
+	_caller := strings.TrimSpace(string(callerAsBytes))
+	return _caller != "" && _caller == string(adminAsBytes), nil
+}
+
+// price_message - what a provider signs: securityId|price|currency|timestamp
+func price_message(Price Prices) []byte {
+	return []byte(Price.SecurityId + "|" + Price.Price + "|" + Price.Currency + "|" + Price.Timestamp)
+}
+
+// public_key - read a PEM encoded ECDSA public key
+func public_key(PublicKey string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(PublicKey))
+	if block == nil {
+		return nil, errors.New("Public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("Public key does not read: " + err.Error())
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Public key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// signed_by - whether the price carries a valid signature of the provider's key over its SHA-256 price_message
+func signed_by(Provider Providers, Price Prices) bool {
+	key, err := public_key(Provider.PublicKey)
+	if err != nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(Price.Signature)
+	if err != nil {
+		return false
+	}
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil || sig.R == nil || sig.S == nil {
+		return false
+	}
+	digest := sha256.Sum256(price_message(Price))
+	return ecdsa.Verify(key, digest[:], sig.R, sig.S)
+}
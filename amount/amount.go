@@ -0,0 +1,363 @@
+/*/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package amount - fixed point decimal amounts for money and quantities, shared by the Account, Allocation and Deal chaincodes
+package amount
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// How an amount is brought to fewer decimals
+type RoundingMode int
+
+const (
+	RoundHalfUp   RoundingMode = iota // nearest, ties away from zero
+	RoundHalfEven                     // nearest, ties to the even digit
+	RoundDown                         // towards zero
+	RoundUp                           // away from zero
+	RoundFloor                        // towards minus infinity
+	RoundCeiling                      // towards plus infinity
+)
+
+// Decimals kept for money in each currency, DefaultScale for the currencies not listed
+var CurrencyScale = map[string]int{"JPY": 0, "KRW": 0, "BHD": 3, "KWD": 3, "OMR": 3}
+var DefaultScale = 2
+
+// Decimals kept for security quantities
+var QuantityScale = 2
+
+// Decimals kept for prices, FX rates and percentages before they are multiplied out
+var RateScale = 8
+
+// Rounding applied when money or quantities are brought to their scale
+var DefaultRounding = RoundHalfUp
+
+// Amount - fixed point decimal of Units counted in 10^-Scale. Currency is empty for quantities, rates and percentages.
+type Amount struct {
+	Units    int64
+	Scale    int
+	Currency string
+}
+
+// ScaleOf - decimals kept for money in the currency
+func ScaleOf(Currency string) int {
+	if scale, found := CurrencyScale[Currency]; found {
+		return scale
+	}
+	return DefaultScale
+}
+
+// ============================================================================================================================
+// ParseDecimal - exact value of a plain decimal string such as "-1234.5678", rounded to scale decimals by mode
+// Exponents, thousand separators and blanks are rejected rather than read as zero
+// ============================================================================================================================
+func ParseDecimal(value string, scale int, mode RoundingMode) (Amount, error) {
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	integerPart, fractionPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		integerPart, fractionPart = s[:i], s[i+1:]
+	}
+	if integerPart == "" && fractionPart == "" {
+		return Amount{}, errors.New("Invalid decimal '" + value + "'")
+	}
+	for _, c := range integerPart + fractionPart {
+		if c < '0' || c > '9' {
+			return Amount{}, errors.New("Invalid decimal '" + value + "'")
+		}
+	}
+	n, _ := new(big.Int).SetString("0"+integerPart+fractionPart, 10)
+	if negative {
+		n.Neg(n)
+	}
+	units, err := to_units(rescale(n, len(fractionPart), scale, mode))
+	if err != nil {
+		return Amount{}, errors.New("Decimal '" + value + "' out of range")
+	}
+	return Amount{Units: units, Scale: scale}, nil
+}
+
+// ParseAmount - money in the currency, rounded to the decimals the currency keeps
+func ParseAmount(value string, Currency string) (Amount, error) {
+	amount, err := ParseDecimal(value, ScaleOf(Currency), DefaultRounding)
+	if err != nil {
+		return Amount{}, errors.New("Invalid amount '" + value + "'")
+	}
+	amount.Currency = Currency
+	return amount, nil
+}
+
+// ParseQuantity - a security quantity
+func ParseQuantity(value string) (Amount, error) {
+	quantity, err := ParseDecimal(value, QuantityScale, DefaultRounding)
+	if err != nil {
+		return Amount{}, errors.New("Invalid quantity '" + value + "'")
+	}
+	return quantity, nil
+}
+
+// ParseRate - a price, FX rate or percentage
+func ParseRate(value string) (Amount, error) {
+	rate, err := ParseDecimal(value, RateScale, DefaultRounding)
+	if err != nil {
+		return Amount{}, errors.New("Invalid rate '" + value + "'")
+	}
+	return rate, nil
+}
+
+// FromFloat - a float64 from outside, e.g. a decoded json number or a solver result, as an exact decimal
+func FromFloat(value float64, scale int, mode RoundingMode) (Amount, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Amount{}, errors.New("Invalid decimal " + strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	return ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64), scale, mode)
+}
+
+// DecimalPlaces - decimals written in a plain decimal string, the scale it reads at without rounding
+func DecimalPlaces(value string) int {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, "."); i >= 0 {
+		return len(value) - i - 1
+	}
+	return 0
+}
+
+// Zero - nothing of the currency
+func Zero(Currency string) Amount {
+	return Amount{Scale: ScaleOf(Currency), Currency: Currency}
+}
+
+// String - the amount with all its decimals, e.g. "1234.50"
+func (a Amount) String() string {
+	digits := strconv.FormatInt(a.Units, 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if a.Scale <= 0 {
+		return sign + digits + strings.Repeat("0", -a.Scale)
+	}
+	if len(digits) <= a.Scale {
+		digits = strings.Repeat("0", a.Scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-a.Scale] + "." + digits[len(digits)-a.Scale:]
+}
+
+// Float64 - nearest float64, for the allocation search only, never for amounts that are stored
+func (a Amount) Float64() float64 {
+	value, _ := strconv.ParseFloat(a.String(), 64)
+	return value
+}
+
+func (a Amount) Sign() int {
+	switch {
+	case a.Units > 0:
+		return 1
+	case a.Units < 0:
+		return -1
+	}
+	return 0
+}
+
+func (a Amount) Neg() Amount {
+	a.Units = -a.Units
+	return a
+}
+
+func (a Amount) Abs() Amount {
+	if a.Units < 0 {
+		a.Units = -a.Units
+	}
+	return a
+}
+
+// Round - the amount with scale decimals
+func (a Amount) Round(scale int, mode RoundingMode) (Amount, error) {
+	units, err := to_units(rescale(big.NewInt(a.Units), a.Scale, scale, mode))
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Units: units, Scale: scale, Currency: a.Currency}, nil
+}
+
+// Add - exact sum, at the larger scale of the two. Amounts in different currencies are not added.
+func (a Amount) Add(b Amount) (Amount, error) {
+	currency, err := common_currency(a, b)
+	if err != nil {
+		return Amount{}, err
+	}
+	scale := a.Scale
+	if b.Scale > scale {
+		scale = b.Scale
+	}
+	n := rescale(big.NewInt(a.Units), a.Scale, scale, RoundDown)
+	n.Add(n, rescale(big.NewInt(b.Units), b.Scale, scale, RoundDown))
+	units, err := to_units(n)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Units: units, Scale: scale, Currency: currency}, nil
+}
+
+// Sub - exact difference, at the larger scale of the two
+func (a Amount) Sub(b Amount) (Amount, error) {
+	return a.Add(b.Neg())
+}
+
+// Cmp - -1, 0 or +1 as a is less than, equal to or more than b, whatever their scales
+func (a Amount) Cmp(b Amount) int {
+	scale := a.Scale
+	if b.Scale > scale {
+		scale = b.Scale
+	}
+	return rescale(big.NewInt(a.Units), a.Scale, scale, RoundDown).Cmp(rescale(big.NewInt(b.Units), b.Scale, scale, RoundDown))
+}
+
+// ============================================================================================================================
+// Mul - product rounded once to scale decimals, e.g. a quantity times a unit value
+// The product takes the currency of whichever side has one
+// ============================================================================================================================
+func (a Amount) Mul(b Amount, scale int, mode RoundingMode) (Amount, error) {
+	currency := a.Currency
+	if currency == "" {
+		currency = b.Currency
+	}
+	n := new(big.Int).Mul(big.NewInt(a.Units), big.NewInt(b.Units))
+	units, err := to_units(rescale(n, a.Scale+b.Scale, scale, mode))
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Units: units, Scale: scale, Currency: currency}, nil
+}
+
+// ============================================================================================================================
+// Div - quotient rounded once to scale decimals, e.g. a price over an FX rate
+// Keeps the currency of a, a ratio of two amounts in the same currency has none
+// ============================================================================================================================
+func (a Amount) Div(b Amount, scale int, mode RoundingMode) (Amount, error) {
+	if b.Units == 0 {
+		return Amount{}, errors.New("Division of " + a.String() + " by zero")
+	}
+	currency := a.Currency
+	if currency == b.Currency {
+		currency = ""
+	}
+	// a/b at scale decimals is a.Units * 10^(scale - a.Scale + b.Scale) / b.Units
+	n := big.NewInt(a.Units)
+	d := big.NewInt(b.Units)
+	if shift := scale - a.Scale + b.Scale; shift >= 0 {
+		n.Mul(n, pow10(shift))
+	} else {
+		d.Mul(d, pow10(-shift))
+	}
+	units, err := to_units(round_quotient(n, d, mode))
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Units: units, Scale: scale, Currency: currency}, nil
+}
+
+// common_currency - currency of a sum, amounts without one go with anything
+func common_currency(a Amount, b Amount) (string, error) {
+	if a.Currency != "" && b.Currency != "" && a.Currency != b.Currency {
+		return "", errors.New("Cannot combine " + a.Currency + " " + a.String() + " with " + b.Currency + " " + b.String())
+	}
+	if a.Currency != "" {
+		return a.Currency, nil
+	}
+	return b.Currency, nil
+}
+
+// rescale - units counted in 10^-from as units counted in 10^-to, rounded by mode when decimals are dropped
+func rescale(n *big.Int, from int, to int, mode RoundingMode) *big.Int {
+	if to >= from {
+		return new(big.Int).Mul(n, pow10(to-from))
+	}
+	return round_quotient(n, pow10(from-to), mode)
+}
+
+// round_quotient - n / d rounded to a whole number by mode
+func round_quotient(n *big.Int, d *big.Int, mode RoundingMode) *big.Int {
+	if d.Sign() < 0 {
+		n = new(big.Int).Neg(n)
+		d = new(big.Int).Neg(d)
+	}
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	// q is truncated towards zero, away takes it one further from zero
+	away := false
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		away = true
+	case RoundFloor:
+		away = n.Sign() < 0
+	case RoundCeiling:
+		away = n.Sign() > 0
+	default:
+		twice := new(big.Int).Abs(r)
+		c := twice.Lsh(twice, 1).Cmp(d)
+		away = c > 0 || (c == 0 && (mode == RoundHalfUp || q.Bit(0) == 1))
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(n.Sign())))
+	}
+	return q
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+func to_units(n *big.Int) (int64, error) {
+	if !n.IsInt64() {
+		return 0, errors.New("Amount " + n.String() + " out of range")
+	}
+	return n.Int64(), nil
+}
+
+// ParseRoundingMode - a rounding mode by name, e.g. "Half Up", "Half Even", "Down", "Up", "Floor" or "Ceiling"
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch strings.Replace(strings.ToLower(name), " ", "", -1) {
+	case "halfup", "":
+		return RoundHalfUp, nil
+	case "halfeven":
+		return RoundHalfEven, nil
+	case "down":
+		return RoundDown, nil
+	case "up":
+		return RoundUp, nil
+	case "floor":
+		return RoundFloor, nil
+	case "ceiling":
+		return RoundCeiling, nil
+	}
+	return RoundHalfUp, errors.New("Unknown rounding mode '" + name + "'")
+}
@@ -0,0 +1,180 @@
+package amount
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParseDecimalRounding(t *testing.T) {
+	tests := []struct {
+		value string
+		scale int
+		mode  RoundingMode
+		want  string
+	}{
+		{"1.005", 2, RoundHalfUp, "1.01"},
+		{"-1.005", 2, RoundHalfUp, "-1.01"},
+		{"1.005", 2, RoundHalfEven, "1.00"},
+		{"1.015", 2, RoundHalfEven, "1.02"},
+		{"-1.025", 2, RoundHalfEven, "-1.02"},
+		{"1.009", 2, RoundDown, "1.00"},
+		{"-1.009", 2, RoundDown, "-1.00"},
+		{"1.001", 2, RoundUp, "1.01"},
+		{"-1.001", 2, RoundUp, "-1.01"},
+		{"1.009", 2, RoundFloor, "1.00"},
+		{"-1.001", 2, RoundFloor, "-1.01"},
+		{"1.001", 2, RoundCeiling, "1.01"},
+		{"-1.009", 2, RoundCeiling, "-1.00"},
+		{".5", 0, RoundHalfEven, "0"},
+		{"2.5", 0, RoundHalfEven, "2"},
+		{"12", 0, RoundDown, "12"},
+		{"0.07", 3, RoundUp, "0.070"},
+		{"+3.10", 2, RoundHalfUp, "3.10"},
+	}
+	for _, test := range tests {
+		got, err := ParseDecimal(test.value, test.scale, test.mode)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q, %d, %d) error: %v", test.value, test.scale, test.mode, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("ParseDecimal(%q, %d, %d) = %s, want %s", test.value, test.scale, test.mode, got, test.want)
+		}
+	}
+}
+
+func TestParseDecimalRejects(t *testing.T) {
+	for _, value := range []string{"", " ", "-", ".", "1e5", "1,000", "abc", "1.2.3", "--1"} {
+		if got, err := ParseDecimal(value, 2, DefaultRounding); err == nil {
+			t.Errorf("ParseDecimal(%q) = %s, want an error", value, got)
+		}
+	}
+}
+
+func TestParseAmountCurrencyScale(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     string
+	}{
+		{"1234.56", "JPY", "1235"},
+		{"1.2345", "BHD", "1.235"},
+		{"0.125", "EUR", "0.13"},
+		{"50000.07", "USD", "50000.07"},
+	}
+	for _, test := range tests {
+		got, err := ParseAmount(test.value, test.currency)
+		if err != nil || got.String() != test.want || got.Currency != test.currency {
+			t.Errorf("ParseAmount(%q, %s) = %s %s, %v, want %s", test.value, test.currency, got, got.Currency, err, test.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, _ := ParseAmount("0.1", "USD")
+	b, _ := ParseAmount("0.2", "USD")
+	sum, err := a.Add(b)
+	if err != nil || sum.String() != "0.30" {
+		t.Errorf("0.1 + 0.2 = %s, %v, want 0.30", sum, err)
+	}
+	difference, err := a.Sub(b)
+	if err != nil || difference.String() != "-0.10" || difference.Sign() != -1 {
+		t.Errorf("0.1 - 0.2 = %s, %v, want -0.10", difference, err)
+	}
+	if _, err := a.Add(Amount{Units: 1, Scale: 2, Currency: "EUR"}); err == nil {
+		t.Error("USD + EUR added, want an error")
+	}
+	if a.Cmp(Amount{Units: 1000, Scale: 4, Currency: "USD"}) != 0 {
+		t.Error("0.10 and 0.1000 compare unequal")
+	}
+
+	quantity, _ := ParseQuantity("3")
+	price, _ := ParseRate("100.10")
+	product, err := price.Mul(quantity, 2, DefaultRounding)
+	if err != nil || product.String() != "300.30" {
+		t.Errorf("100.10 x 3 = %s, %v, want 300.30", product, err)
+	}
+
+	third, err := Amount{Units: 100, Scale: 2, Currency: "EUR"}.Div(Amount{Units: 3}, 2, RoundHalfUp)
+	if err != nil || third.String() != "0.33" || third.Currency != "EUR" {
+		t.Errorf("1.00 / 3 = %s %s, %v, want EUR 0.33", third, third.Currency, err)
+	}
+	ratio, err := Amount{Units: 9000, Scale: 2, Currency: "EUR"}.Div(Amount{Units: 10000, Scale: 2, Currency: "EUR"}, 4, RoundHalfUp)
+	if err != nil || ratio.String() != "0.9000" || ratio.Currency != "" {
+		t.Errorf("90.00 / 100.00 = %s %s, %v, want 0.9000 without currency", ratio, ratio.Currency, err)
+	}
+	if _, err := a.Div(Zero("USD"), 2, DefaultRounding); err == nil {
+		t.Error("division by zero, want an error")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	largest := Amount{Units: math.MaxInt64, Scale: 2}
+	if _, err := largest.Add(Amount{Units: 1, Scale: 2}); err == nil {
+		t.Error("MaxInt64 + 1 units, want an out of range error")
+	}
+	if _, err := largest.Neg().Sub(Amount{Units: 2, Scale: 2}); err == nil {
+		t.Error("-MaxInt64 - 2 units, want an out of range error")
+	}
+	if _, err := largest.Mul(Amount{Units: 2}, 2, DefaultRounding); err == nil {
+		t.Error("MaxInt64 units x 2, want an out of range error")
+	}
+	if _, err := largest.Round(4, DefaultRounding); err == nil {
+		t.Error("MaxInt64 units at 2 more decimals, want an out of range error")
+	}
+	if _, err := ParseDecimal(strconv.FormatUint(math.MaxUint64, 10), 0, DefaultRounding); err == nil {
+		t.Error("MaxUint64 parsed, want an out of range error")
+	}
+	// Products wider than int64 are still rounded exactly when the result fits
+	got, err := largest.Mul(Amount{Units: 1, Scale: 4}, 2, RoundDown)
+	if err != nil || got.Units != math.MaxInt64/10000 {
+		t.Errorf("MaxInt64 units x 0.0001 = %d, %v, want %d", got.Units, err, int64(math.MaxInt64/10000))
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		scale int
+		mode  RoundingMode
+		want  string
+	}{
+		{0.1 + 0.2, 2, RoundHalfUp, "0.30"},
+		{1.005, 2, RoundHalfUp, "1.01"},
+		{270.27, 2, RoundDown, "270.27"},
+		{-2.5, 0, RoundHalfEven, "-2"},
+	}
+	for _, test := range tests {
+		got, err := FromFloat(test.value, test.scale, test.mode)
+		if err != nil || got.String() != test.want {
+			t.Errorf("FromFloat(%v, %d, %d) = %s, %v, want %s", test.value, test.scale, test.mode, got, err, test.want)
+		}
+	}
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e300} {
+		if _, err := FromFloat(value, 2, DefaultRounding); err == nil {
+			t.Errorf("FromFloat(%v) accepted, want an error", value)
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	tests := map[string]RoundingMode{
+		"":          RoundHalfUp,
+		"Half Up":   RoundHalfUp,
+		"half even": RoundHalfEven,
+		"Down":      RoundDown,
+		"UP":        RoundUp,
+		"Floor":     RoundFloor,
+		"Ceiling":   RoundCeiling,
+	}
+	for name, want := range tests {
+		got, err := ParseRoundingMode(name)
+		if err != nil || got != want {
+			t.Errorf("ParseRoundingMode(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := ParseRoundingMode("Banker's"); err == nil {
+		t.Error("ParseRoundingMode(\"Banker's\") accepted, want an error")
+	}
+}